@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -16,7 +17,12 @@ import (
 
 	"github.com/truora/microservice/internal/database"
 	truoraHttp "github.com/truora/microservice/internal/delivery/http"
+	"github.com/truora/microservice/internal/domain"
+	"github.com/truora/microservice/internal/httpclient"
+	"github.com/truora/microservice/internal/ratingfile"
+	"github.com/truora/microservice/internal/ratingscale"
 	"github.com/truora/microservice/internal/repository"
+	"github.com/truora/microservice/internal/ticker"
 	"github.com/truora/microservice/internal/usecase"
 )
 
@@ -30,12 +36,102 @@ type Config struct {
 		SSLMode  string `yaml:"sslmode"`
 	} `yaml:"database"`
 	ExternalAPI struct {
-		BaseURL string `yaml:"base_url"`
-		Timeout int    `yaml:"timeout"`
-		Token   string `yaml:"token"`
+		BaseURL     string `yaml:"base_url"`
+		Timeout     int    `yaml:"timeout"`
+		SyncTimeout int    `yaml:"sync_timeout"`
+		Token       string `yaml:"token"`
+		Retry       struct {
+			// MaxRetries defaults to 3 when unset; 0 disables retries
+			MaxRetries       *int `yaml:"max_retries"`
+			InitialBackoffMs int  `yaml:"initial_backoff_ms"`
+			MaxBackoffMs     int  `yaml:"max_backoff_ms"`
+		} `yaml:"retry"`
+		CircuitBreaker struct {
+			FailureThreshold int `yaml:"failure_threshold"`
+			Cooldown         int `yaml:"cooldown"`
+		} `yaml:"circuit_breaker"`
 	} `yaml:"external_api"`
+	// Sources lists the rating sources available for syncing. When empty, only
+	// the external API is registered.
+	Sources []struct {
+		Name string `yaml:"name"`
+		Type string `yaml:"type"`
+		Path string `yaml:"path"`
+	} `yaml:"sources"`
+	// Queue configures the worker pool that runs sync and import jobs
+	Queue struct {
+		Workers       int    `yaml:"workers"`
+		PollInterval  int    `yaml:"poll_interval"`
+		LeaseDuration int    `yaml:"lease_duration"`
+		MaxAttempts   int    `yaml:"max_attempts"`
+		RetryBackoff  int    `yaml:"retry_backoff"`
+		SpoolDir      string `yaml:"spool_dir"`
+	} `yaml:"queue"`
+	Webhooks struct {
+		// Secret signs every webhook payload with HMAC-SHA256; webhooks are
+		// disabled without it
+		Secret         string `yaml:"secret"`
+		Timeout        int    `yaml:"timeout"`
+		MaxAttempts    int    `yaml:"max_attempts"`
+		InitialBackoff int    `yaml:"initial_backoff"`
+		MaxBackoff     int    `yaml:"max_backoff"`
+		// AllowedHosts may receive webhooks despite resolving to internal addresses
+		AllowedHosts []string `yaml:"allowed_hosts"`
+	} `yaml:"webhooks"`
+	// Retention configures how long finished jobs are kept
+	Retention struct {
+		Interval  int  `yaml:"interval"`
+		BatchSize int  `yaml:"batch_size"`
+		Archive   bool `yaml:"archive"`
+		Rules     []struct {
+			Type       string `yaml:"type"`
+			Status     string `yaml:"status"`
+			MaxAgeDays int    `yaml:"max_age_days"`
+		} `yaml:"rules"`
+	} `yaml:"retention"`
+	Scheduler struct {
+		Enabled bool `yaml:"enabled"`
+		// LockKey identifies the Postgres advisory lock replicas compete for
+		LockKey   int64 `yaml:"lock_key"`
+		Schedules []struct {
+			Name   string `yaml:"name"`
+			Source string `yaml:"source"`
+			Mode   string `yaml:"mode"`
+			Cron   string `yaml:"cron"`
+		} `yaml:"schedules"`
+	} `yaml:"scheduler"`
+	// RatingScale adds raw ratings to the built-in mapping, keyed by level
+	// (strong_sell, sell, hold, buy or strong_buy)
+	RatingScale map[string][]string `yaml:"rating_scale"`
+	// Brokerages declares canonical brokerage names and their spellings
+	Brokerages []struct {
+		Name    string   `yaml:"name"`
+		Aliases []string `yaml:"aliases"`
+	} `yaml:"brokerages"`
+	// Companies declares exchanges and ticker aliases of companies
+	Companies []struct {
+		Ticker   string   `yaml:"ticker"`
+		Exchange string   `yaml:"exchange"`
+		Aliases  []string `yaml:"aliases"`
+	} `yaml:"companies"`
+	// DataQuality configures the periodic scan of stored ratings
+	DataQuality struct {
+		Interval   int             `yaml:"interval"`
+		SampleSize int             `yaml:"sample_size"`
+		Rules      map[string]bool `yaml:"rules"`
+	} `yaml:"data_quality"`
+	// ReconcileLockKey identifies the Postgres advisory lock taken by the
+	// replica reconciling stored ratings at startup
+	ReconcileLockKey int64 `yaml:"reconcile_lock_key"`
 }
 
+const (
+	// defaultSchedulerLockKey is used when scheduler.lock_key is not set
+	defaultSchedulerLockKey = 727001
+	// defaultReconcileLockKey is used when reconcile_lock_key is not set
+	defaultReconcileLockKey = 727002
+)
+
 func main() {
 	// Load environment variables
 	if err := godotenv.Load(); err != nil {
@@ -79,21 +175,159 @@ func main() {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
 
+	ratingScale, err := ratingscale.New(config.RatingScale)
+	if err != nil {
+		log.Fatalf("Failed to configure rating scale: %v", err)
+	}
+
+	tickerNormalizer, err := ticker.NewNormalizer(buildTickerAliases(config))
+	if err != nil {
+		log.Fatalf("Failed to configure ticker aliases: %v", err)
+	}
+
 	// Initialize repositories
-	stockRatingRepo := repository.NewStockRatingRepository(db)
+	stockRatingRepo := repository.NewStockRatingRepository(db, ratingScale, tickerNormalizer)
 	jobRepo := repository.NewJobRepository(db)
+	syncStateRepo := repository.NewSyncStateRepository(db)
+	jobErrorRepo := repository.NewJobErrorRepository(db)
+	scheduledRunRepo := repository.NewScheduledRunRepository(db)
+	webhookRepo := repository.NewWebhookRepository(db)
+	brokerageRepo := repository.NewBrokerageRepository(db)
+	companyRepo := repository.NewCompanyRepository(db)
+	dataQualityRepo := repository.NewDataQualityRepository(db)
+	externalAPIClient := httpclient.New(httpclient.Config{
+		Timeout:          time.Duration(config.ExternalAPI.Timeout) * time.Second,
+		MaxRetries:       config.ExternalAPI.Retry.MaxRetries,
+		InitialBackoff:   time.Duration(config.ExternalAPI.Retry.InitialBackoffMs) * time.Millisecond,
+		MaxBackoff:       time.Duration(config.ExternalAPI.Retry.MaxBackoffMs) * time.Millisecond,
+		FailureThreshold: config.ExternalAPI.CircuitBreaker.FailureThreshold,
+		Cooldown:         time.Duration(config.ExternalAPI.CircuitBreaker.Cooldown) * time.Second,
+	})
 	externalAPIRepo := repository.NewExternalAPIRepository(
+		domain.ExternalAPISource,
 		config.ExternalAPI.BaseURL,
-		time.Duration(config.ExternalAPI.Timeout)*time.Second,
+		externalAPIClient,
 		config.ExternalAPI.Token,
 	)
 
+	sourceRegistry, err := buildSourceRegistry(config, externalAPIRepo)
+	if err != nil {
+		log.Fatalf("Failed to configure rating sources: %v", err)
+	}
+
 	// Initialize services
-	stockRatingSvc := usecase.NewStockRatingService(stockRatingRepo, jobRepo, externalAPIRepo)
+	stockRatingSvc := usecase.NewStockRatingService(stockRatingRepo, jobRepo)
 	stockAlgorithmSvc := usecase.NewStockAlgorithmService(stockRatingRepo)
+	jobTracker := usecase.NewJobTracker()
+	jobQueue := usecase.NewJobQueue(jobRepo, jobTracker, usecase.QueueConfig{
+		Workers:       config.Queue.Workers,
+		PollInterval:  time.Duration(config.Queue.PollInterval) * time.Second,
+		LeaseDuration: time.Duration(config.Queue.LeaseDuration) * time.Second,
+		MaxAttempts:   config.Queue.MaxAttempts,
+		RetryBackoff:  time.Duration(config.Queue.RetryBackoff) * time.Second,
+		// Whole-job deadline, independent of the per-request timeout
+		JobTimeout: time.Duration(config.ExternalAPI.SyncTimeout) * time.Second,
+	})
+	if config.Webhooks.Secret == "" {
+		log.Printf("Warning: webhooks.secret is not set, webhooks are disabled")
+	}
+	webhookSvc := usecase.NewWebhookService(jobRepo, webhookRepo, jobQueue, usecase.WebhookConfig{
+		Secret:         config.Webhooks.Secret,
+		AllowedHosts:   config.Webhooks.AllowedHosts,
+		Timeout:        time.Duration(config.Webhooks.Timeout) * time.Second,
+		MaxAttempts:    config.Webhooks.MaxAttempts,
+		InitialBackoff: time.Duration(config.Webhooks.InitialBackoff) * time.Second,
+		MaxBackoff:     time.Duration(config.Webhooks.MaxBackoff) * time.Second,
+	})
+	syncSvc := usecase.NewSyncService(stockRatingRepo, jobRepo, jobErrorRepo, syncStateRepo, sourceRegistry, jobQueue, webhookSvc)
+	importSvc := usecase.NewImportService(stockRatingRepo, jobRepo, jobErrorRepo, jobQueue, config.Queue.SpoolDir)
+	jobEventHub := usecase.NewJobEventHub(repository.NewJobEventListener(db))
+	jobSvc := usecase.NewJobService(jobRepo, jobErrorRepo, jobTracker, jobEventHub)
+	ratingScaleSvc := usecase.NewRatingScaleService(stockRatingRepo)
+
+	brokerageSvc, err := usecase.NewBrokerageService(brokerageRepo, buildBrokerages(config))
+	if err != nil {
+		log.Fatalf("Failed to configure brokerages: %v", err)
+	}
+	companySvc := usecase.NewCompanyService(companyRepo, tickerNormalizer, buildCompanies(config))
+
+	retentionSvc, err := usecase.NewRetentionService(jobRepo, buildRetentionConfig(config))
+	if err != nil {
+		log.Fatalf("Failed to configure job retention: %v", err)
+	}
+
+	dataQualitySvc, err := usecase.NewDataQualityService(dataQualityRepo, jobRepo, jobQueue, buildDataQualityConfig(config))
+	if err != nil {
+		log.Fatalf("Failed to configure data quality scans: %v", err)
+	}
+
+	lockKey := config.Scheduler.LockKey
+	if lockKey == 0 {
+		lockKey = defaultSchedulerLockKey
+	}
+	reconcileLockKey := config.ReconcileLockKey
+	if reconcileLockKey == 0 {
+		reconcileLockKey = defaultReconcileLockKey
+	}
+	if reconcileLockKey == lockKey {
+		log.Fatalf("Failed to configure locks: reconcile_lock_key and scheduler.lock_key are both %d", lockKey)
+	}
+	schedulerSvc, err := usecase.NewSchedulerService(
+		syncSvc,
+		scheduledRunRepo,
+		repository.NewAdvisoryLock(db, lockKey),
+		buildSchedules(config),
+	)
+	if err != nil {
+		log.Fatalf("Failed to configure scheduler: %v", err)
+	}
+
+	// Relay job changes published by any replica to local event streams
+	go jobEventHub.Run(context.Background())
+
+	// Deliver webhooks of finished jobs; dispatchers on all replicas share the work
+	go webhookSvc.Run(context.Background())
+
+	// Start the workers; they also recover jobs orphaned by a crashed replica
+	go jobQueue.Run(context.Background())
+
+	// Bring stored ratings in line with the configured tickers, brokerages
+	// and rating scale and with the price parser and action rules, which may
+	// have changed since they were stored. The passes rewrite the same rows, so they run
+	// one after another, and only on the replica that takes the lock.
+	go func() {
+		ctx := context.Background()
+		lock := repository.NewAdvisoryLock(db, reconcileLockKey)
+		acquired, err := lock.TryAcquire(ctx)
+		if err != nil {
+			log.Printf("Failed to take the reconcile lock: %v", err)
+			return
+		}
+		if !acquired {
+			log.Printf("Another replica is reconciling stored ratings")
+			return
+		}
+		defer lock.Release(ctx)
+
+		companySvc.Run(ctx)
+		brokerageSvc.Run(ctx)
+		ratingScaleSvc.Run(ctx)
+		stockRatingSvc.Run(ctx)
+	}()
+
+	// Prune expired jobs; janitors on all replicas skip each other's rows
+	go retentionSvc.Run(context.Background())
+
+	// Queue data-quality scans; only one scan runs at a time across replicas
+	go dataQualitySvc.Run(context.Background())
+
+	// Start scheduled syncs; replicas elect a leader through the advisory lock
+	if config.Scheduler.Enabled {
+		go schedulerSvc.Run(context.Background())
+	}
 
 	// Initialize handler
-	handler := truoraHttp.NewHandler(stockRatingSvc, stockAlgorithmSvc)
+	handler := truoraHttp.NewHandler(stockRatingSvc, stockAlgorithmSvc, syncSvc, importSvc, schedulerSvc, jobSvc, webhookSvc, retentionSvc, ratingScaleSvc, brokerageSvc, companySvc, dataQualitySvc)
 
 	// Initialize router
 	r := chi.NewRouter()
@@ -103,7 +337,7 @@ func main() {
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
-	r.Use(middleware.Timeout(60 * time.Second))
+	r.Use(truoraHttp.TimeoutUnlessStreaming(60 * time.Second))
 
 	// Register routes
 	handler.RegisterRoutes(r)
@@ -119,3 +353,128 @@ func main() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+// buildSourceRegistry registers the rating sources listed in config. The
+// external API is configured through its own section and listed with type api.
+func buildSourceRegistry(config *Config, externalAPIRepo repository.ExternalAPIRepository) (*repository.RatingSourceRegistry, error) {
+	if len(config.Sources) == 0 {
+		return repository.NewRatingSourceRegistry(externalAPIRepo)
+	}
+
+	var sources []repository.RatingSource
+	for _, source := range config.Sources {
+		if source.Type == "api" {
+			if source.Name != "" && source.Name != externalAPIRepo.Name() {
+				return nil, fmt.Errorf("the api source must be named %q", externalAPIRepo.Name())
+			}
+			sources = append(sources, externalAPIRepo)
+			continue
+		}
+
+		if source.Name == "" || source.Path == "" {
+			return nil, fmt.Errorf("file sources need a name and a path")
+		}
+		format, err := ratingfile.ParseFormat(source.Type)
+		if err != nil {
+			return nil, fmt.Errorf("source %s: %w", source.Name, err)
+		}
+		sources = append(sources, repository.NewFileRatingSource(source.Name, source.Path, format))
+	}
+
+	return repository.NewRatingSourceRegistry(sources...)
+}
+
+// buildSchedules fills in defaults for the configured sync schedules: the
+// source defaults to the external API, the mode to incremental and the name
+// to the source
+func buildSchedules(config *Config) []usecase.ScheduleConfig {
+	schedules := make([]usecase.ScheduleConfig, len(config.Scheduler.Schedules))
+	for i, sched := range config.Scheduler.Schedules {
+		schedules[i] = usecase.ScheduleConfig{
+			Name:   sched.Name,
+			Source: sched.Source,
+			Mode:   domain.SyncMode(sched.Mode),
+			Cron:   sched.Cron,
+		}
+		if schedules[i].Source == "" {
+			schedules[i].Source = domain.ExternalAPISource
+		}
+		if schedules[i].Mode == "" {
+			schedules[i].Mode = domain.SyncModeIncremental
+		}
+		if schedules[i].Name == "" {
+			schedules[i].Name = schedules[i].Source
+		}
+	}
+	return schedules
+}
+
+// buildRetentionConfig converts the retention section, whose ages are in days
+// and interval in seconds
+func buildRetentionConfig(config *Config) usecase.RetentionConfig {
+	retention := usecase.RetentionConfig{
+		Interval:  time.Duration(config.Retention.Interval) * time.Second,
+		BatchSize: config.Retention.BatchSize,
+		Archive:   config.Retention.Archive,
+		Rules:     make([]usecase.RetentionRule, len(config.Retention.Rules)),
+		// The data-quality report is the latest completed scan
+		KeepLatest: []string{usecase.DataQualityJobType},
+	}
+	for i, rule := range config.Retention.Rules {
+		retention.Rules[i] = usecase.RetentionRule{
+			JobType: rule.Type,
+			Status:  domain.JobStatus(rule.Status),
+			MaxAge:  time.Duration(rule.MaxAgeDays) * 24 * time.Hour,
+		}
+	}
+	return retention
+}
+
+// buildBrokerages converts the brokerages section
+func buildBrokerages(config *Config) []usecase.BrokerageAliases {
+	brokerages := make([]usecase.BrokerageAliases, len(config.Brokerages))
+	for i, brokerage := range config.Brokerages {
+		brokerages[i] = usecase.BrokerageAliases{
+			Name:    brokerage.Name,
+			Aliases: brokerage.Aliases,
+		}
+	}
+	return brokerages
+}
+
+// buildTickerAliases maps every configured alias to its company's ticker
+func buildTickerAliases(config *Config) map[string]string {
+	aliases := make(map[string]string)
+	for _, company := range config.Companies {
+		for _, alias := range company.Aliases {
+			aliases[alias] = company.Ticker
+		}
+	}
+	return aliases
+}
+
+// buildCompanies converts the companies section
+func buildCompanies(config *Config) []usecase.CompanyReference {
+	companies := make([]usecase.CompanyReference, len(config.Companies))
+	for i, company := range config.Companies {
+		companies[i] = usecase.CompanyReference{
+			Ticker:   company.Ticker,
+			Exchange: company.Exchange,
+		}
+	}
+	return companies
+}
+
+// buildDataQualityConfig converts the data_quality section, whose interval is
+// in seconds
+func buildDataQualityConfig(config *Config) usecase.DataQualityConfig {
+	dataQuality := usecase.DataQualityConfig{
+		Interval:   time.Duration(config.DataQuality.Interval) * time.Second,
+		SampleSize: config.DataQuality.SampleSize,
+		Rules:      make(map[domain.DataQualityRule]bool, len(config.DataQuality.Rules)),
+	}
+	for rule, enabled := range config.DataQuality.Rules {
+		dataQuality.Rules[domain.DataQualityRule(rule)] = enabled
+	}
+	return dataQuality
+}
@@ -1,26 +1,66 @@
 package truoraHttp
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"path"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/truora/microservice/internal/domain"
 	"github.com/truora/microservice/internal/dto"
+	"github.com/truora/microservice/internal/ratingfile"
 	"github.com/truora/microservice/internal/usecase"
 )
 
 type Handler struct {
 	stockRatingSvc    usecase.StockRatingService
 	stockAlgorithmSvc usecase.StockAlgorithmService
+	syncSvc           usecase.SyncService
+	importSvc         usecase.ImportService
+	schedulerSvc      usecase.SchedulerService
+	jobSvc            usecase.JobService
+	webhookSvc        usecase.WebhookService
+	retentionSvc      usecase.RetentionService
+	ratingScaleSvc    usecase.RatingScaleService
+	brokerageSvc      usecase.BrokerageService
+	companySvc        usecase.CompanyService
+	dataQualitySvc    usecase.DataQualityService
 }
 
-func NewHandler(stockRatingSvc usecase.StockRatingService, stockAlgorithmSvc usecase.StockAlgorithmService) *Handler {
+// maxImportSize caps the size of an uploaded ratings file
+const maxImportSize = 100 << 20
+
+// sseKeepAliveInterval is how often an idle event stream sends a comment
+const sseKeepAliveInterval = 15 * time.Second
+
+// maxSearchQueryLength caps the text of a company search
+const maxSearchQueryLength = 100
+
+func NewHandler(stockRatingSvc usecase.StockRatingService, stockAlgorithmSvc usecase.StockAlgorithmService, syncSvc usecase.SyncService, importSvc usecase.ImportService, schedulerSvc usecase.SchedulerService, jobSvc usecase.JobService, webhookSvc usecase.WebhookService, retentionSvc usecase.RetentionService, ratingScaleSvc usecase.RatingScaleService, brokerageSvc usecase.BrokerageService, companySvc usecase.CompanyService, dataQualitySvc usecase.DataQualityService) *Handler {
 	return &Handler{
 		stockRatingSvc:    stockRatingSvc,
 		stockAlgorithmSvc: stockAlgorithmSvc,
+		syncSvc:           syncSvc,
+		importSvc:         importSvc,
+		schedulerSvc:      schedulerSvc,
+		jobSvc:            jobSvc,
+		webhookSvc:        webhookSvc,
+		retentionSvc:      retentionSvc,
+		ratingScaleSvc:    ratingScaleSvc,
+		brokerageSvc:      brokerageSvc,
+		companySvc:        companySvc,
+		dataQualitySvc:    dataQualitySvc,
 	}
 }
 
@@ -28,15 +68,46 @@ func (h *Handler) RegisterRoutes(r chi.Router) {
 	r.Get("/api/hello", h.HelloWorld)
 	r.Get("/api/external/hello", h.GetExternalHello)
 
+	r.Route("/api/sources", func(r chi.Router) {
+		r.Get("/", h.ListSources)
+		r.Post("/{source}/sync", h.SyncSource)
+	})
+
+	r.Get("/api/schedules/runs", h.GetScheduledRuns)
+
+	r.Route("/api/webhooks", func(r chi.Router) {
+		r.Get("/", h.ListWebhookSubscriptions)
+		r.Post("/", h.CreateWebhookSubscription)
+		r.Delete("/{id}", h.DeleteWebhookSubscription)
+	})
+
 	r.Route("/api/stock-ratings", func(r chi.Router) {
 		r.Get("/", h.GetPaginatedStockRatings)
 		r.Post("/", h.CreateStockRating)
 		r.Post("/batch", h.CreateStockRatingBatch)
+		r.Post("/import", h.ImportStockRatings)
 		r.Get("/{id}", h.GetStockRatingByID)
 		r.Get("/ticker/{ticker}", h.GetStockRatingsByTicker)
 		r.Get("/ticker/{ticker}/latest", h.GetLatestStockRatingByTicker)
 	})
 
+	r.Route("/api/brokerages", func(r chi.Router) {
+		r.Get("/", h.ListBrokerages)
+		r.Get("/{id}", h.GetBrokerage)
+	})
+
+	r.Route("/api/companies", func(r chi.Router) {
+		r.Get("/", h.ListCompanies)
+		r.Get("/{ticker}", h.GetCompany)
+	})
+
+	r.Get("/api/search", h.Search)
+
+	r.Route("/api/data-quality", func(r chi.Router) {
+		r.Get("/", h.GetDataQualityReport)
+		r.Post("/scan", h.StartDataQualityScan)
+	})
+
 	r.Route("/api/algorithms", func(r chi.Router) {
 		r.Get("/best-time-to-buy-sell/{ticker}", h.GetBestTimeToBuyAndSell)
 		r.Post("/best-time-to-buy-sell/multiple", h.GetBestTimeToBuyAndSellMultiple)
@@ -44,31 +115,529 @@ func (h *Handler) RegisterRoutes(r chi.Router) {
 	})
 
 	r.Route("/api/jobs", func(r chi.Router) {
+		r.Get("/", h.ListJobs)
+		r.Get("/summary", h.GetJobSummary)
 		r.Get("/{jobId}", h.GetJobByID)
+		r.Post("/{jobId}/resume", h.ResumeJob)
+		r.Post("/{jobId}/retry", h.RetryJob)
+		r.Post("/{jobId}/cancel", h.CancelJob)
+		r.Get("/{jobId}/events", h.StreamJobEvents)
+		r.Get("/{jobId}/webhooks", h.GetJobWebhookDeliveries)
+		r.Get("/{jobId}/errors", h.GetJobErrors)
+		r.Get("/{jobId}/report", h.GetJobReport)
+	})
+
+	r.Post("/api/admin/jobs/prune", h.PruneJobs)
+	r.Get("/api/admin/ratings/unmapped", h.GetUnmappedRatings)
+	r.Post("/api/admin/ratings/normalize", h.NormalizeRatings)
+}
+
+func (h *Handler) HelloWorld(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, map[string]string{
+		"message": "Hello World!",
+	})
+}
+
+func (h *Handler) GetExternalHello(w http.ResponseWriter, r *http.Request) {
+	h.startSync(w, r, domain.ExternalAPISource)
+}
+
+func (h *Handler) ListSources(w http.ResponseWriter, r *http.Request) {
+	sources, err := h.syncSvc.ListSources(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, sources)
+}
+
+func (h *Handler) SyncSource(w http.ResponseWriter, r *http.Request) {
+	h.startSync(w, r, chi.URLParam(r, "source"))
+}
+
+func (h *Handler) GetScheduledRuns(w http.ResponseWriter, r *http.Request) {
+	// Parse query parameters
+	upcoming := 5
+	if upcomingStr := r.URL.Query().Get("upcoming"); upcomingStr != "" {
+		if u, err := strconv.Atoi(upcomingStr); err == nil && u >= 0 && u <= 50 {
+			upcoming = u
+		} else {
+			respondWithError(w, http.StatusBadRequest, "Invalid upcoming parameter (must be between 0 and 50)")
+			return
+		}
+	}
+
+	past := 20
+	if pastStr := r.URL.Query().Get("past"); pastStr != "" {
+		if p, err := strconv.Atoi(pastStr); err == nil && p >= 0 && p <= 100 {
+			past = p
+		} else {
+			respondWithError(w, http.StatusBadRequest, "Invalid past parameter (must be between 0 and 100)")
+			return
+		}
+	}
+
+	runs, err := h.schedulerSvc.GetRuns(r.Context(), upcoming, past)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, runs)
+}
+
+// startSync creates a sync job for source in the mode given by the optional
+// mode query parameter. An optional callback_url is notified through a signed
+// webhook when the job finishes.
+func (h *Handler) startSync(w http.ResponseWriter, r *http.Request, source string) {
+	// Parse sync mode, defaulting to incremental
+	mode := domain.SyncModeIncremental
+	if modeStr := r.URL.Query().Get("mode"); modeStr != "" {
+		switch domain.SyncMode(modeStr) {
+		case domain.SyncModeFull, domain.SyncModeIncremental:
+			mode = domain.SyncMode(modeStr)
+		default:
+			respondWithError(w, http.StatusBadRequest, "Invalid mode parameter (must be full or incremental)")
+			return
+		}
+	}
+
+	job, err := h.syncSvc.StartSync(r.Context(), source, mode, r.URL.Query().Get("callback_url"))
+	if err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrSyncInProgress):
+			respondWithSyncInProgress(w, job)
+		case errors.Is(err, usecase.ErrSourceNotFound):
+			respondWithError(w, http.StatusNotFound, "Rating source not found")
+		case errors.Is(err, usecase.ErrInvalidCallbackURL):
+			respondWithError(w, http.StatusBadRequest, "Invalid callback_url parameter (must be an absolute http or https URL of a public host)")
+		case errors.Is(err, usecase.ErrWebhooksDisabled):
+			respondWithError(w, http.StatusServiceUnavailable, "Webhooks are disabled (webhooks.secret is not set)")
+		default:
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"job_id":  job.ID,
+		"type":    job.Type,
+		"status":  job.Status,
+		"mode":    job.Mode,
+		"message": "Job created successfully. Use /api/jobs/{job_id} to check status.",
 	})
 }
 
-func (h *Handler) HelloWorld(w http.ResponseWriter, r *http.Request) {
-	respondWithJSON(w, http.StatusOK, map[string]string{
-		"message": "Hello World!",
-	})
-}
+func (h *Handler) ListWebhookSubscriptions(w http.ResponseWriter, r *http.Request) {
+	subscriptions, err := h.webhookSvc.ListSubscriptions(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, subscriptions)
+}
+
+func (h *Handler) CreateWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	var request dto.WebhookSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	subscription, err := h.webhookSvc.CreateSubscription(r.Context(), &request)
+	if err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrInvalidCallbackURL):
+			respondWithError(w, http.StatusBadRequest, "Invalid url (must be an absolute http or https URL of a public host)")
+		case errors.Is(err, usecase.ErrWebhooksDisabled):
+			respondWithError(w, http.StatusServiceUnavailable, "Webhooks are disabled (webhooks.secret is not set)")
+		default:
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, subscription)
+}
+
+func (h *Handler) DeleteWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	if err := h.webhookSvc.DeleteSubscription(r.Context(), uint(id)); err != nil {
+		if errors.Is(err, usecase.ErrSubscriptionNotFound) {
+			respondWithError(w, http.StatusNotFound, "Webhook subscription not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) GetJobByID(w http.ResponseWriter, r *http.Request) {
+	jobIDStr := chi.URLParam(r, "jobId")
+	jobID, err := uuid.Parse(jobIDStr)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid job ID format")
+		return
+	}
+
+	job, err := h.stockRatingSvc.GetJobByID(r.Context(), jobID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if job == nil {
+		respondWithError(w, http.StatusNotFound, "Job not found")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, job)
+}
+
+func (h *Handler) ListJobs(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseJobFilter(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Parse pagination parameters
+	page := 1
+	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		} else {
+			respondWithError(w, http.StatusBadRequest, "Invalid page parameter")
+			return
+		}
+	}
+
+	pageSize := 20
+	if pageSizeStr := r.URL.Query().Get("page_size"); pageSizeStr != "" {
+		if ps, err := strconv.Atoi(pageSizeStr); err == nil && ps > 0 && ps <= 100 {
+			pageSize = ps
+		} else {
+			respondWithError(w, http.StatusBadRequest, "Invalid page_size parameter (must be between 1 and 100)")
+			return
+		}
+	}
+
+	response, err := h.jobSvc.ListJobs(r.Context(), filter, page, pageSize)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (h *Handler) GetJobSummary(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseJobFilter(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	summary, err := h.jobSvc.GetJobSummary(r.Context(), filter)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, summary)
+}
+
+func (h *Handler) GetJobErrors(w http.ResponseWriter, r *http.Request) {
+	jobIDStr := chi.URLParam(r, "jobId")
+	jobID, err := uuid.Parse(jobIDStr)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid job ID format")
+		return
+	}
+
+	// Parse pagination parameters
+	page := 1
+	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		} else {
+			respondWithError(w, http.StatusBadRequest, "Invalid page parameter")
+			return
+		}
+	}
+
+	pageSize := 20
+	if pageSizeStr := r.URL.Query().Get("page_size"); pageSizeStr != "" {
+		if ps, err := strconv.Atoi(pageSizeStr); err == nil && ps > 0 && ps <= 100 {
+			pageSize = ps
+		} else {
+			respondWithError(w, http.StatusBadRequest, "Invalid page_size parameter (must be between 1 and 100)")
+			return
+		}
+	}
+
+	response, err := h.jobSvc.ListJobErrors(r.Context(), jobID, page, pageSize)
+	if err != nil {
+		if errors.Is(err, usecase.ErrJobNotFound) {
+			respondWithError(w, http.StatusNotFound, "Job not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// PruneJobs applies the job retention policy right away and reports what it
+// removed, or with dry_run=true what it would remove
+func (h *Handler) PruneJobs(w http.ResponseWriter, r *http.Request) {
+	dryRun := false
+	if dryRunStr := r.URL.Query().Get("dry_run"); dryRunStr != "" {
+		parsed, err := strconv.ParseBool(dryRunStr)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid dry_run parameter (must be true or false)")
+			return
+		}
+		dryRun = parsed
+	}
+
+	report, err := h.retentionSvc.Prune(r.Context(), dryRun)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, report)
+}
+
+// GetUnmappedRatings lists the raw ratings the rating scale has no level for,
+// so they can be added to the rating_scale config
+func (h *Handler) GetUnmappedRatings(w http.ResponseWriter, r *http.Request) {
+	response, err := h.ratingScaleSvc.GetUnmappedRatings(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// NormalizeRatings maps the stored ratings again with the current scale
+func (h *Handler) NormalizeRatings(w http.ResponseWriter, r *http.Request) {
+	result, err := h.ratingScaleSvc.Renormalize(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+// GetDataQualityReport returns the findings of the latest completed
+// data-quality scan
+func (h *Handler) GetDataQualityReport(w http.ResponseWriter, r *http.Request) {
+	report, err := h.dataQualitySvc.GetReport(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if report == nil {
+		respondWithError(w, http.StatusNotFound, "No data quality scan has completed yet")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, report)
+}
+
+// StartDataQualityScan queues a data-quality scan of the stored ratings
+func (h *Handler) StartDataQualityScan(w http.ResponseWriter, r *http.Request) {
+	job, err := h.dataQualitySvc.StartScan(r.Context())
+	if err != nil {
+		if errors.Is(err, usecase.ErrScanInProgress) {
+			respondWithSyncInProgress(w, job)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"job_id":  job.ID,
+		"type":    job.Type,
+		"status":  job.Status,
+		"message": "Scan started. Use /api/jobs/{job_id} to check status and /api/data-quality for the findings.",
+	})
+}
+
+func (h *Handler) ResumeJob(w http.ResponseWriter, r *http.Request) {
+	jobIDStr := chi.URLParam(r, "jobId")
+	jobID, err := uuid.Parse(jobIDStr)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid job ID format")
+		return
+	}
+
+	job, err := h.syncSvc.ResumeJob(r.Context(), jobID)
+	if err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrJobNotFound):
+			respondWithError(w, http.StatusNotFound, "Job not found")
+		case errors.Is(err, usecase.ErrJobNotResumable):
+			respondWithError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, usecase.ErrJobRetried):
+			respondWithError(w, http.StatusConflict, "Job has already been retried; resume its retry instead")
+		case errors.Is(err, usecase.ErrSyncInProgress):
+			respondWithSyncInProgress(w, job)
+		default:
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"job_id":  job.ID,
+		"status":  job.Status,
+		"cursor":  job.Cursor,
+		"message": "Job resumed from its last checkpoint. Use /api/jobs/{job_id} to check status.",
+	})
+}
+
+func (h *Handler) RetryJob(w http.ResponseWriter, r *http.Request) {
+	jobIDStr := chi.URLParam(r, "jobId")
+	jobID, err := uuid.Parse(jobIDStr)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid job ID format")
+		return
+	}
+
+	job, err := h.syncSvc.RetryJob(r.Context(), jobID)
+	if err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrJobNotFound):
+			respondWithError(w, http.StatusNotFound, "Job not found")
+		case errors.Is(err, usecase.ErrJobNotRetryable):
+			respondWithError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, usecase.ErrJobRetried):
+			respondWithJSON(w, http.StatusConflict, map[string]interface{}{
+				"error":         "Job has already been retried",
+				"job_id":        job.ID,
+				"parent_job_id": job.ParentJobID,
+				"status":        job.Status,
+				"message":       "Use /api/jobs/{job_id} to check the existing retry.",
+			})
+		case errors.Is(err, usecase.ErrSyncInProgress):
+			respondWithSyncInProgress(w, job)
+		default:
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"job_id":        job.ID,
+		"parent_job_id": job.ParentJobID,
+		"chain_attempt": job.ChainAttempt,
+		"status":        job.Status,
+		"cursor":        job.Cursor,
+		"message":       "Retry job created from the last checkpoint of its parent. Use /api/jobs/{job_id} to check status.",
+	})
+}
+
+func (h *Handler) CancelJob(w http.ResponseWriter, r *http.Request) {
+	jobIDStr := chi.URLParam(r, "jobId")
+	jobID, err := uuid.Parse(jobIDStr)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid job ID format")
+		return
+	}
+
+	job, err := h.jobSvc.CancelJob(r.Context(), jobID)
+	if err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrJobNotFound):
+			respondWithError(w, http.StatusNotFound, "Job not found")
+		case errors.Is(err, usecase.ErrJobFinished):
+			respondWithError(w, http.StatusConflict, fmt.Sprintf("Job has already finished with status %s and cannot be cancelled", job.Status))
+		default:
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"job_id":   job.ID,
+		"status":   job.Status,
+		"progress": job.Progress,
+		"message":  "Job cancelled. Items stored before it stopped are kept; use /api/jobs/{job_id}/resume to continue it.",
+	})
+}
+
+// StreamJobEvents streams a job's status and progress as Server-Sent Events,
+// starting with its current state and ending once it finishes
+func (h *Handler) StreamJobEvents(w http.ResponseWriter, r *http.Request) {
+	jobIDStr := chi.URLParam(r, "jobId")
+	jobID, err := uuid.Parse(jobIDStr)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid job ID format")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
 
-func (h *Handler) GetExternalHello(w http.ResponseWriter, r *http.Request) {
-	job, err := h.stockRatingSvc.GetHello(r.Context())
+	events, err := h.jobSvc.WatchJob(r.Context(), jobID)
 	if err != nil {
+		if errors.Is(err, usecase.ErrJobNotFound) {
+			respondWithError(w, http.StatusNotFound, "Job not found")
+			return
+		}
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
-		"job_id":  job.ID,
-		"status":  job.Status,
-		"message": "Job created successfully. Use /api/jobs/{job_id} to check status.",
-	})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// Comments keep proxies from closing an idle stream
+	keepAlive := time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, "event: job\ndata: %s\n\n", data)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		}
+		flusher.Flush()
+	}
 }
 
-func (h *Handler) GetJobByID(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetJobWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
 	jobIDStr := chi.URLParam(r, "jobId")
 	jobID, err := uuid.Parse(jobIDStr)
 	if err != nil {
@@ -76,18 +645,17 @@ func (h *Handler) GetJobByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	job, err := h.stockRatingSvc.GetJobByID(r.Context(), jobID)
+	deliveries, err := h.webhookSvc.GetDeliveries(r.Context(), jobID)
 	if err != nil {
+		if errors.Is(err, usecase.ErrJobNotFound) {
+			respondWithError(w, http.StatusNotFound, "Job not found")
+			return
+		}
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	if job == nil {
-		respondWithError(w, http.StatusNotFound, "Job not found")
-		return
-	}
-
-	respondWithJSON(w, http.StatusOK, job)
+	respondWithJSON(w, http.StatusOK, deliveries)
 }
 
 func (h *Handler) CreateStockRating(w http.ResponseWriter, r *http.Request) {
@@ -120,6 +688,73 @@ func (h *Handler) CreateStockRatingBatch(w http.ResponseWriter, r *http.Request)
 	respondWithJSON(w, http.StatusCreated, ratings)
 }
 
+// ImportStockRatings accepts a CSV or NDJSON file, either as the "file" part
+// of a multipart form or as the raw request body, and imports it in a job
+func (h *Handler) ImportStockRatings(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	body := io.Reader(r.Body)
+	filename := ""
+	contentType := r.Header.Get("Content-Type")
+
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "multipart/form-data" {
+		part, err := findFilePart(r)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid multipart payload: "+err.Error())
+			return
+		}
+		defer part.Close()
+
+		body = part
+		filename = part.FileName()
+		contentType = part.Header.Get("Content-Type")
+	}
+
+	format, err := detectImportFormat(r.URL.Query().Get("format"), filename, contentType)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid import format: "+err.Error())
+		return
+	}
+
+	job, err := h.importSvc.StartImport(r.Context(), format, body)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"job_id":  job.ID,
+		"type":    job.Type,
+		"status":  job.Status,
+		"message": "Import started. Use /api/jobs/{job_id} to check status and /api/jobs/{job_id}/report to download rejected lines.",
+	})
+}
+
+func (h *Handler) GetJobReport(w http.ResponseWriter, r *http.Request) {
+	jobIDStr := chi.URLParam(r, "jobId")
+	jobID, err := uuid.Parse(jobIDStr)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid job ID format")
+		return
+	}
+
+	// Render into a buffer so errors can still be reported as JSON
+	var report bytes.Buffer
+	if err := h.importSvc.WriteReport(r.Context(), jobID, &report); err != nil {
+		if errors.Is(err, usecase.ErrJobNotFound) {
+			respondWithError(w, http.StatusNotFound, "Job not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"job-%s-report.csv\"", jobID))
+	w.WriteHeader(http.StatusOK)
+	w.Write(report.Bytes())
+}
+
 func (h *Handler) GetStockRatingByID(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.ParseUint(idStr, 10, 32)
@@ -149,7 +784,13 @@ func (h *Handler) GetStockRatingsByTicker(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	ratings, err := h.stockRatingSvc.GetStockRatingsByTicker(r.Context(), ticker)
+	filter, err := parseStockRatingFilter(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ratings, err := h.stockRatingSvc.GetStockRatingsByTicker(r.Context(), ticker, filter)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -180,6 +821,12 @@ func (h *Handler) GetLatestStockRatingByTicker(w http.ResponseWriter, r *http.Re
 }
 
 func (h *Handler) GetPaginatedStockRatings(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseStockRatingFilter(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// Parse query parameters
 	pageStr := r.URL.Query().Get("page")
 	pageSizeStr := r.URL.Query().Get("page_size")
@@ -208,8 +855,179 @@ func (h *Handler) GetPaginatedStockRatings(w http.ResponseWriter, r *http.Reques
 		}
 	}
 
+	// A cursor parameter, empty for the first page, switches to keyset pagination
+	if r.URL.Query().Has("cursor") {
+		h.getStockRatingsByCursor(w, r, filter, pageSize)
+		return
+	}
+
 	// Get paginated ratings
-	response, err := h.stockRatingSvc.GetPaginatedStockRatings(r.Context(), page, pageSize)
+	response, err := h.stockRatingSvc.GetPaginatedStockRatings(r.Context(), filter, page, pageSize)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// getStockRatingsByCursor serves a page of the rating listing by cursor,
+// which only the default time order supports
+func (h *Handler) getStockRatingsByCursor(w http.ResponseWriter, r *http.Request, filter *dto.StockRatingFilter, pageSize int) {
+	if r.URL.Query().Get("page") != "" {
+		respondWithError(w, http.StatusBadRequest, "Pass either page or cursor, not both")
+		return
+	}
+	if filter.SortBy != "time" {
+		respondWithError(w, http.StatusBadRequest, "Cursor pagination only supports sort=time")
+		return
+	}
+
+	var cursor *dto.RatingCursor
+	if encoded := r.URL.Query().Get("cursor"); encoded != "" {
+		var err error
+		if cursor, err = dto.DecodeRatingCursor(encoded); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid cursor parameter")
+			return
+		}
+	}
+
+	response, err := h.stockRatingSvc.GetStockRatingsByCursor(r.Context(), filter, cursor, pageSize)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (h *Handler) ListBrokerages(w http.ResponseWriter, r *http.Request) {
+	response, err := h.brokerageSvc.ListBrokerages(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// GetBrokerage returns a brokerage with the tickers it covers, its rating
+// activity and its latest ratings
+func (h *Handler) GetBrokerage(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	brokerage, err := h.brokerageSvc.GetBrokerage(r.Context(), uint(id))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if brokerage == nil {
+		respondWithError(w, http.StatusNotFound, "Brokerage not found")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, brokerage)
+}
+
+func (h *Handler) ListCompanies(w http.ResponseWriter, r *http.Request) {
+	page := 1
+	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		} else {
+			respondWithError(w, http.StatusBadRequest, "Invalid page parameter")
+			return
+		}
+	}
+
+	pageSize := 20
+	if pageSizeStr := r.URL.Query().Get("page_size"); pageSizeStr != "" {
+		if ps, err := strconv.Atoi(pageSizeStr); err == nil && ps > 0 && ps <= 100 {
+			pageSize = ps
+		} else {
+			respondWithError(w, http.StatusBadRequest, "Invalid page_size parameter (must be between 1 and 100)")
+			return
+		}
+	}
+
+	response, err := h.companySvc.ListCompanies(r.Context(), page, pageSize)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// GetCompany returns a company with its name history and rating statistics.
+// Any case or alias of the ticker finds it.
+func (h *Handler) GetCompany(w http.ResponseWriter, r *http.Request) {
+	ticker := chi.URLParam(r, "ticker")
+	if ticker == "" {
+		respondWithError(w, http.StatusBadRequest, "Ticker is required")
+		return
+	}
+
+	company, err := h.companySvc.GetCompany(r.Context(), ticker)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if company == nil {
+		respondWithError(w, http.StatusNotFound, "Company not found")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, company)
+}
+
+// Search finds companies by ticker or name. The default full mode matches
+// fuzzily and ranks by match quality and recent activity; mode=autocomplete
+// only matches prefixes and returns tickers and names, for search-as-you-type.
+func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		respondWithError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+	if len([]rune(query)) > maxSearchQueryLength {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("q exceeds %d characters", maxSearchQueryLength))
+		return
+	}
+
+	mode := r.URL.Query().Get("mode")
+	limit, maxLimit := 20, 50
+	switch mode {
+	case "", "full":
+	case "autocomplete":
+		limit, maxLimit = 8, 20
+	default:
+		respondWithError(w, http.StatusBadRequest, "Invalid mode parameter (must be full or autocomplete)")
+		return
+	}
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= maxLimit {
+			limit = l
+		} else {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid limit parameter (must be between 1 and %d)", maxLimit))
+			return
+		}
+	}
+
+	var response interface{}
+	var err error
+	if mode == "autocomplete" {
+		response, err = h.companySvc.Autocomplete(r.Context(), query, limit)
+	} else {
+		response, err = h.companySvc.Search(r.Context(), query, limit)
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -333,6 +1151,211 @@ func (h *Handler) GetBestTimeToBuyAndSellGlobal(w http.ResponseWriter, r *http.R
 	respondWithJSON(w, http.StatusOK, recommendation)
 }
 
+// findFilePart streams the multipart body up to the "file" part without
+// buffering the upload in memory
+func findFilePart(r *http.Request) (*multipart.Part, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, errors.New("no file part")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "file" {
+			return part, nil
+		}
+		part.Close()
+	}
+}
+
+// detectImportFormat picks the file format from the format query parameter,
+// then the file extension, then the content type
+func detectImportFormat(format, filename, contentType string) (ratingfile.Format, error) {
+	if format != "" {
+		return ratingfile.ParseFormat(format)
+	}
+
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".csv":
+		return ratingfile.FormatCSV, nil
+	case ".ndjson", ".jsonl":
+		return ratingfile.FormatNDJSON, nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/csv":
+		return ratingfile.FormatCSV, nil
+	case "application/x-ndjson", "application/jsonl":
+		return ratingfile.FormatNDJSON, nil
+	}
+
+	return "", errors.New("unable to detect file format; pass format=csv or format=ndjson")
+}
+
+// parseJobFilter reads the job list filters: comma-separated status and type
+// values, a created_from/created_to range and sort/order
+func parseJobFilter(r *http.Request) (*dto.JobFilter, error) {
+	query := r.URL.Query()
+	filter := &dto.JobFilter{SortBy: "created_at", SortDesc: true}
+
+	for _, status := range splitParam(query.Get("status")) {
+		jobStatus := domain.JobStatus(status)
+		switch jobStatus {
+		case domain.JobStatusPending, domain.JobStatusProcessing, domain.JobStatusCompleted, domain.JobStatusFailed, domain.JobStatusCancelled:
+			filter.Statuses = append(filter.Statuses, jobStatus)
+		default:
+			return nil, fmt.Errorf("Invalid status %q", status)
+		}
+	}
+	filter.Types = splitParam(query.Get("type"))
+
+	var err error
+	if filter.CreatedFrom, err = parseTimeParam(query.Get("created_from"), false); err != nil {
+		return nil, fmt.Errorf("Invalid created_from format. Use YYYY-MM-DD or RFC3339")
+	}
+	if filter.CreatedTo, err = parseTimeParam(query.Get("created_to"), true); err != nil {
+		return nil, fmt.Errorf("Invalid created_to format. Use YYYY-MM-DD or RFC3339")
+	}
+	if filter.CreatedFrom != nil && filter.CreatedTo != nil && !filter.CreatedFrom.Before(*filter.CreatedTo) {
+		return nil, fmt.Errorf("created_from must be before created_to")
+	}
+
+	if sortBy := query.Get("sort"); sortBy != "" {
+		if _, ok := dto.JobSortFields[sortBy]; !ok {
+			return nil, fmt.Errorf("Invalid sort parameter %q", sortBy)
+		}
+		filter.SortBy = sortBy
+	}
+	switch query.Get("order") {
+	case "", "desc":
+	case "asc":
+		filter.SortDesc = false
+	default:
+		return nil, fmt.Errorf("Invalid order parameter (must be asc or desc)")
+	}
+
+	return filter, nil
+}
+
+// parseStockRatingFilter reads the filters shared by the rating listings:
+// comma-separated ticker, brokerage_id, action, action_type, rating_from and
+// rating_to values, brokerage names (repeated, as names may contain commas),
+// a time_from/time_to range, a target_min/target_max range and sort/order
+func parseStockRatingFilter(r *http.Request) (*dto.StockRatingFilter, error) {
+	query := r.URL.Query()
+	filter := &dto.StockRatingFilter{SortBy: "time", SortDesc: true}
+
+	for _, value := range splitParam(query.Get("action_type")) {
+		actionType := domain.ActionType(value)
+		if !actionType.IsValid() {
+			return nil, fmt.Errorf("Invalid action_type %q", value)
+		}
+		filter.ActionTypes = append(filter.ActionTypes, actionType)
+	}
+	filter.Tickers = splitParam(query.Get("ticker"))
+	for _, name := range query["brokerage"] {
+		if name = strings.TrimSpace(name); name != "" {
+			filter.Brokerages = append(filter.Brokerages, name)
+		}
+	}
+	for _, value := range splitParam(query.Get("brokerage_id")) {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid brokerage_id %q", value)
+		}
+		filter.BrokerageIDs = append(filter.BrokerageIDs, uint(id))
+	}
+	filter.Actions = splitParam(query.Get("action"))
+	filter.RatingsFrom = splitParam(query.Get("rating_from"))
+	filter.RatingsTo = splitParam(query.Get("rating_to"))
+
+	var err error
+	if filter.TimeFrom, err = parseTimeParam(query.Get("time_from"), false); err != nil {
+		return nil, fmt.Errorf("Invalid time_from format. Use YYYY-MM-DD or RFC3339")
+	}
+	if filter.TimeTo, err = parseTimeParam(query.Get("time_to"), true); err != nil {
+		return nil, fmt.Errorf("Invalid time_to format. Use YYYY-MM-DD or RFC3339")
+	}
+	if filter.TimeFrom != nil && filter.TimeTo != nil && !filter.TimeFrom.Before(*filter.TimeTo) {
+		return nil, fmt.Errorf("time_from must be before time_to")
+	}
+
+	if filter.TargetMin, err = parsePriceParam(query.Get("target_min")); err != nil {
+		return nil, fmt.Errorf("Invalid target_min parameter (must be a non-negative number)")
+	}
+	if filter.TargetMax, err = parsePriceParam(query.Get("target_max")); err != nil {
+		return nil, fmt.Errorf("Invalid target_max parameter (must be a non-negative number)")
+	}
+	if filter.TargetMin != nil && filter.TargetMax != nil && *filter.TargetMin > *filter.TargetMax {
+		return nil, fmt.Errorf("target_min must not be above target_max")
+	}
+
+	if sortBy := query.Get("sort"); sortBy != "" {
+		if _, ok := dto.StockRatingSortFields[sortBy]; !ok {
+			return nil, fmt.Errorf("Invalid sort parameter %q", sortBy)
+		}
+		filter.SortBy = sortBy
+	}
+	switch query.Get("order") {
+	case "", "desc":
+	case "asc":
+		filter.SortDesc = false
+	default:
+		return nil, fmt.Errorf("Invalid order parameter (must be asc or desc)")
+	}
+
+	return filter, nil
+}
+
+// parsePriceParam parses an optional non-negative price bound
+func parsePriceParam(value string) (*float64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil || parsed < 0 || math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+		return nil, errors.New("invalid price")
+	}
+	return &parsed, nil
+}
+
+// splitParam splits a comma-separated query value, dropping empty entries
+func splitParam(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// parseTimeParam parses an RFC3339 timestamp or a YYYY-MM-DD date. Dates used
+// as an exclusive upper bound cover the whole day.
+func parseTimeParam(value string, endOfDay bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	response, err := json.Marshal(payload)
 	if err != nil {
@@ -349,3 +1372,15 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 func respondWithError(w http.ResponseWriter, code int, message string) {
 	respondWithJSON(w, code, map[string]string{"error": message})
 }
+
+// respondWithSyncInProgress points the client at the sync job that is already
+// running instead of starting another one
+func respondWithSyncInProgress(w http.ResponseWriter, job *domain.Job) {
+	respondWithJSON(w, http.StatusConflict, map[string]interface{}{
+		"error":   fmt.Sprintf("A %s job is already %s", job.Type, job.Status),
+		"job_id":  job.ID,
+		"type":    job.Type,
+		"status":  job.Status,
+		"message": "Use /api/jobs/{job_id} to check its status.",
+	})
+}
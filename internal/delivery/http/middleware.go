@@ -0,0 +1,44 @@
+package truoraHttp
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// streamingRoutes are the patterns of the Server-Sent Events routes
+var streamingRoutes = map[string]bool{
+	"/api/jobs/{jobId}/events": true,
+}
+
+// TimeoutUnlessStreaming applies chi's request timeout to every request except
+// the Server-Sent Events streams, which stay open until their job finishes.
+// It runs before routing, so the request is matched against the router to
+// find its route pattern.
+func TimeoutUnlessStreaming(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		timed := middleware.Timeout(timeout)(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isStreaming(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			timed.ServeHTTP(w, r)
+		})
+	}
+}
+
+func isStreaming(r *http.Request) bool {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil || rctx.Routes == nil {
+		return false
+	}
+
+	match := chi.NewRouteContext()
+	if !rctx.Routes.Match(match, r.Method, r.URL.Path) {
+		return false
+	}
+	return streamingRoutes[match.RoutePattern()]
+}
@@ -0,0 +1,49 @@
+package truoraHttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestTimeoutUnlessStreaming(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(TimeoutUnlessStreaming(time.Minute))
+
+	// Handlers report whether the request got the timeout's deadline
+	deadline := func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Deadline(); ok {
+			w.Header().Set("X-Deadline", "true")
+		}
+	}
+	r.Route("/api/jobs", func(r chi.Router) {
+		r.Get("/{jobId}", deadline)
+		r.Get("/{jobId}/events", deadline)
+		r.Post("/{jobId}/cancel", deadline)
+	})
+	r.Get("/api/companies/{ticker}", deadline)
+	r.Get("/api/reports/events", deadline)
+
+	tests := []struct {
+		method string
+		path   string
+		timed  bool
+	}{
+		{http.MethodGet, "/api/jobs/550e8400-e29b-41d4-a716-446655440000/events", false},
+		{http.MethodGet, "/api/jobs/550e8400-e29b-41d4-a716-446655440000", true},
+		{http.MethodPost, "/api/jobs/550e8400-e29b-41d4-a716-446655440000/cancel", true},
+		{http.MethodGet, "/api/companies/events", true},
+		{http.MethodGet, "/api/reports/events", true},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+
+		if timed := rec.Header().Get("X-Deadline") == "true"; timed != tt.timed {
+			t.Errorf("%s %s: timed out = %v, want %v", tt.method, tt.path, timed, tt.timed)
+		}
+	}
+}
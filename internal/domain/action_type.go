@@ -0,0 +1,56 @@
+package domain
+
+import "strings"
+
+// ActionType classifies the free-form action of a rating, such as
+// "target raised by" or "upgraded by", into a structured event
+type ActionType string
+
+const (
+	ActionTypeUpgrade         ActionType = "upgrade"
+	ActionTypeDowngrade       ActionType = "downgrade"
+	ActionTypeTargetRaise     ActionType = "target_raise"
+	ActionTypeTargetLower     ActionType = "target_lower"
+	ActionTypeInitiation      ActionType = "initiation"
+	ActionTypeReiteration     ActionType = "reiteration"
+	ActionTypeCoverageDropped ActionType = "coverage_dropped"
+)
+
+// actionKeywords are tried in order, so a rating change wins over a target
+// change reported in the same action. Stored ratings are classified again at
+// startup, so edits here apply to them too.
+var actionKeywords = []struct {
+	actionType ActionType
+	keywords   []string
+}{
+	{ActionTypeUpgrade, []string{"upgrade"}},
+	{ActionTypeDowngrade, []string{"downgrade"}},
+	{ActionTypeCoverageDropped, []string{"dropped", "terminat", "discontinu", "suspend"}},
+	{ActionTypeInitiation, []string{"initiat", "resum", "assum"}},
+	{ActionTypeTargetRaise, []string{"raise", "boost", "increase"}},
+	{ActionTypeTargetLower, []string{"lower", "cut", "decrease"}},
+	{ActionTypeReiteration, []string{"reiterat", "maintain", "affirm"}},
+}
+
+// ClassifyAction returns the type of a raw action, or "" when it matches none
+func ClassifyAction(action string) ActionType {
+	action = strings.ToLower(action)
+	for _, rule := range actionKeywords {
+		for _, keyword := range rule.keywords {
+			if strings.Contains(action, keyword) {
+				return rule.actionType
+			}
+		}
+	}
+	return ""
+}
+
+// IsValid reports whether t is one of the known action types
+func (t ActionType) IsValid() bool {
+	for _, rule := range actionKeywords {
+		if rule.actionType == t {
+			return true
+		}
+	}
+	return false
+}
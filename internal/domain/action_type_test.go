@@ -0,0 +1,39 @@
+package domain
+
+import "testing"
+
+func TestClassifyAction(t *testing.T) {
+	tests := []struct {
+		action string
+		want   ActionType
+	}{
+		{"upgraded by", ActionTypeUpgrade},
+		{"Downgraded by", ActionTypeDowngrade},
+		{"target raised by", ActionTypeTargetRaise},
+		{"target lowered by", ActionTypeTargetLower},
+		{"target cut by", ActionTypeTargetLower},
+		{"initiated by", ActionTypeInitiation},
+		{"coverage resumed by", ActionTypeInitiation},
+		{"reiterated by", ActionTypeReiteration},
+		{"target set by", ""},
+		{"", ""},
+		// A rating change wins over the target change reported with it
+		{"upgraded by, target raised", ActionTypeUpgrade},
+		{"target raised, downgraded by", ActionTypeDowngrade},
+		// Dropped coverage wins over the target it last published
+		{"coverage dropped, target lowered", ActionTypeCoverageDropped},
+		{"initiated by, target boosted", ActionTypeInitiation},
+		{"target raised, reiterated by", ActionTypeTargetRaise},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			got := ClassifyAction(tt.action)
+			if got != tt.want {
+				t.Errorf("ClassifyAction(%q) = %q, want %q", tt.action, got, tt.want)
+			}
+			if got != "" && !got.IsValid() {
+				t.Errorf("ClassifyAction(%q) = %q, which is not valid", tt.action, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package domain
+
+import (
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Brokerage is the canonical entity behind the brokerage names of ratings
+type Brokerage struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BrokerageAlias maps every spelling with the same BrokerageKey to a brokerage
+type BrokerageAlias struct {
+	AliasKey    string    `json:"-" gorm:"primaryKey"`
+	Alias       string    `json:"alias"`
+	BrokerageID uint      `json:"brokerage_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// brokerageSuffixes are dropped from the end of names, so "Goldman Sachs
+// Group, Inc." and "Goldman Sachs" share a key
+var brokerageSuffixes = map[string]struct{}{
+	"inc": {}, "incorporated": {}, "llc": {}, "ltd": {}, "limited": {}, "plc": {},
+	"corp": {}, "corporation": {}, "co": {}, "company": {}, "group": {},
+	"lp": {}, "llp": {}, "sa": {}, "ag": {}, "and": {},
+}
+
+// BrokerageKey reduces a brokerage name to the letters and digits that tell
+// brokerages apart: lower case, without punctuation, spacing, a leading "the"
+// or trailing legal suffixes. "J.P. Morgan" and "JPMorgan" share a key.
+func BrokerageKey(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(strings.ReplaceAll(name, "&", " and ")), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > 1 && words[0] == "the" {
+		words = words[1:]
+	}
+
+	end := len(words)
+	for end > 1 {
+		if _, ok := brokerageSuffixes[words[end-1]]; !ok {
+			break
+		}
+		end--
+	}
+	// Joining without spaces undoes the split of dotted initials
+	return strings.Join(words[:end], "")
+}
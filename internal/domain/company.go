@@ -0,0 +1,23 @@
+package domain
+
+import "time"
+
+// Company is the reference entry of a canonical ticker. Name follows the
+// most recently rated company name of the ticker.
+type Company struct {
+	Ticker    string    `json:"ticker" gorm:"primaryKey"`
+	Name      string    `json:"name"`
+	Exchange  string    `json:"exchange"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CompanyName is a name a ticker was rated under, with the span of ratings
+// that used it
+type CompanyName struct {
+	ID          uint      `json:"-" gorm:"primaryKey"`
+	Ticker      string    `json:"-"`
+	Name        string    `json:"name"`
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+}
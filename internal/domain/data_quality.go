@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DataQualityRule names a check the data-quality scan runs against the
+// stored ratings
+type DataQualityRule string
+
+const (
+	DataQualityEmptyTarget             DataQualityRule = "empty_target"
+	DataQualityFutureTimestamp         DataQualityRule = "future_timestamp"
+	DataQualityTargetDirectionMismatch DataQualityRule = "target_direction_mismatch"
+	DataQualityUnknownRating           DataQualityRule = "unknown_rating"
+	DataQualityUnclassifiedAction      DataQualityRule = "unclassified_action"
+	DataQualityMixedTargetCurrency     DataQualityRule = "mixed_target_currency"
+)
+
+// DataQualityRules lists every rule in the order scans run them
+var DataQualityRules = []DataQualityRule{
+	DataQualityEmptyTarget,
+	DataQualityFutureTimestamp,
+	DataQualityTargetDirectionMismatch,
+	DataQualityUnknownRating,
+	DataQualityUnclassifiedAction,
+	DataQualityMixedTargetCurrency,
+}
+
+var dataQualityDescriptions = map[DataQualityRule]string{
+	DataQualityEmptyTarget:             "The rating has no target_to price",
+	DataQualityFutureTimestamp:         "The rating is dated in the future",
+	DataQualityTargetDirectionMismatch: "The target moved against the action, e.g. a raised target with target_from above target_to",
+	DataQualityUnknownRating:           "rating_from or rating_to is not on the rating scale",
+	DataQualityUnclassifiedAction:      "The action matches no action type",
+	DataQualityMixedTargetCurrency:     "target_from and target_to are prices in different currencies, so neither was parsed",
+}
+
+// IsValid reports whether r is a known rule
+func (r DataQualityRule) IsValid() bool {
+	_, ok := dataQualityDescriptions[r]
+	return ok
+}
+
+// Description explains what the rule flags
+func (r DataQualityRule) Description() string {
+	return dataQualityDescriptions[r]
+}
+
+// DataQualityFinding is what one rule found in one scan: how many ratings
+// break it and the IDs of the most recent ones
+type DataQualityFinding struct {
+	JobID     uuid.UUID       `json:"job_id" gorm:"type:uuid;primaryKey"`
+	Rule      DataQualityRule `json:"rule" gorm:"type:varchar(50);primaryKey"`
+	Count     int64           `json:"count"`
+	SampleIDs []uint          `json:"sample_ids" gorm:"type:jsonb;serializer:json"`
+	CreatedAt time.Time       `json:"created_at"`
+}
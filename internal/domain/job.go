@@ -13,16 +13,116 @@ const (
 	JobStatusProcessing JobStatus = "processing"
 	JobStatusCompleted  JobStatus = "completed"
 	JobStatusFailed     JobStatus = "failed"
+	JobStatusCancelled  JobStatus = "cancelled"
 )
 
+// IsFinished reports whether a job in this status will not run again on its own
+func (s JobStatus) IsFinished() bool {
+	return s == JobStatusCompleted || s == JobStatusFailed || s == JobStatusCancelled
+}
+
+// SyncJobType is the job type used for syncs of the named rating source
+func SyncJobType(source string) string {
+	return source + "_sync"
+}
+
 type Job struct {
-	ID           uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	Status       JobStatus  `json:"status" gorm:"type:varchar(20);not null;default:'pending'"`
-	Type         string     `json:"type" gorm:"type:varchar(50);not null"`
-	Progress     int        `json:"progress" gorm:"default:0"`
-	TotalItems   int        `json:"total_items" gorm:"default:0"`
-	ErrorMessage *string    `json:"error_message,omitempty"`
-	CreatedAt    time.Time  `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
-	UpdatedAt    time.Time  `json:"updated_at" gorm:"default:CURRENT_TIMESTAMP"`
-	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+	ID             uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Status         JobStatus  `json:"status" gorm:"type:varchar(20);not null;default:'pending'"`
+	Type           string     `json:"type" gorm:"type:varchar(50);not null"`
+	Source         string     `json:"source" gorm:"type:varchar(50);not null"`
+	Mode           SyncMode   `json:"mode" gorm:"type:varchar(20);not null;default:'incremental'"`
+	Progress       int        `json:"progress" gorm:"default:0"`
+	TotalItems     int        `json:"total_items" gorm:"default:0"`
+	InsertedItems  int        `json:"inserted_items" gorm:"default:0"`
+	UpdatedItems   int        `json:"updated_items" gorm:"default:0"`
+	UnchangedItems int        `json:"unchanged_items" gorm:"default:0"`
+	RejectedItems  int        `json:"rejected_items" gorm:"default:0"`
+	SkippedItems   int        `json:"skipped_items" gorm:"default:0"`
+	DuplicateItems int        `json:"duplicate_items" gorm:"default:0"`
+	Pages          int        `json:"pages" gorm:"default:0"`
+	Cursor         string     `json:"cursor,omitempty" gorm:"type:varchar(255);not null;default:''"`
+	Since          *time.Time `json:"since,omitempty"`
+	LatestItemTime *time.Time `json:"latest_item_time,omitempty"`
+	ErrorMessage   *string    `json:"error_message,omitempty"`
+	Attempts       int        `json:"attempts" gorm:"not null;default:0"`
+	MaxAttempts    int        `json:"max_attempts" gorm:"not null;default:3"`
+	RunAfter       *time.Time `json:"run_after,omitempty"`
+	LockedBy       *string    `json:"locked_by,omitempty"`
+	HeartbeatAt    *time.Time `json:"heartbeat_at,omitempty"`
+	LeaseExpiresAt *time.Time `json:"lease_expires_at,omitempty"`
+	InputPath      string     `json:"-" gorm:"not null;default:''"`
+	CallbackURL    string     `json:"callback_url,omitempty" gorm:"not null;default:''"`
+	Exclusive      bool       `json:"-" gorm:"not null;default:false"`
+	ParentJobID    *uuid.UUID `json:"parent_job_id,omitempty" gorm:"type:uuid"`
+	ChildJobID     *uuid.UUID `json:"child_job_id,omitempty" gorm:"type:uuid"`
+	ChainAttempt   int        `json:"chain_attempt" gorm:"not null;default:1"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt      time.Time  `json:"updated_at" gorm:"default:CURRENT_TIMESTAMP"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty"`
+	// NotifiedAt is when the webhook deliveries of the finished job were queued
+	NotifiedAt *time.Time `json:"-"`
+}
+
+// NewRetry returns a pending job that repeats j with the same parameters,
+// continuing from j's saved checkpoint and linked to it as its child
+func (j *Job) NewRetry() *Job {
+	parentID := j.ID
+	return &Job{
+		ID:             uuid.New(),
+		Status:         JobStatusPending,
+		Type:           j.Type,
+		Source:         j.Source,
+		Mode:           j.Mode,
+		Progress:       j.Progress,
+		TotalItems:     j.TotalItems,
+		InsertedItems:  j.InsertedItems,
+		UpdatedItems:   j.UpdatedItems,
+		UnchangedItems: j.UnchangedItems,
+		RejectedItems:  j.RejectedItems,
+		SkippedItems:   j.SkippedItems,
+		DuplicateItems: j.DuplicateItems,
+		Pages:          j.Pages,
+		Cursor:         j.Cursor,
+		Since:          j.Since,
+		LatestItemTime: j.LatestItemTime,
+		InputPath:      j.InputPath,
+		CallbackURL:    j.CallbackURL,
+		Exclusive:      j.Exclusive,
+		ParentJobID:    &parentID,
+		ChainAttempt:   j.ChainAttempt + 1,
+	}
+}
+
+// JobCheckpoint is the resumable state of a sync job, saved after every page
+// so a failed job can continue where it stopped
+type JobCheckpoint struct {
+	Cursor         string
+	LatestItemTime *time.Time
+	Progress       int
+	Pages          int
+	// Rejected counts malformed items and Skipped the ones filtered out as
+	// older than the job's since mark
+	Rejected int
+	Skipped  int
+	Result   UpsertResult
+}
+
+// Checkpoint returns the counters the job has saved so far, which is where a
+// retried or resumed run continues from
+func (j *Job) Checkpoint() *JobCheckpoint {
+	return &JobCheckpoint{
+		Cursor:         j.Cursor,
+		LatestItemTime: j.LatestItemTime,
+		Progress:       j.Progress,
+		Pages:          j.Pages,
+		Rejected:       j.RejectedItems,
+		Skipped:        j.SkippedItems,
+		Result: UpsertResult{
+			Inserted:  j.InsertedItems,
+			Updated:   j.UpdatedItems,
+			Unchanged: j.UnchangedItems,
+			Duplicate: j.DuplicateItems,
+		},
+	}
 }
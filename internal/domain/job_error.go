@@ -0,0 +1,19 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// JobError records one item a job could not store, such as a malformed line
+// of an imported file. Line is only set for items read from a file.
+type JobError struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	JobID      uuid.UUID `json:"job_id" gorm:"type:uuid;not null"`
+	Page       int       `json:"page"`
+	Line       int       `json:"line,omitempty"`
+	Reason     string    `json:"reason"`
+	RawPayload string    `json:"raw_payload,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
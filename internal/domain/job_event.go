@@ -0,0 +1,38 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// JobEvent is a snapshot of a job's status and progress, published whenever
+// either changes
+type JobEvent struct {
+	JobID          uuid.UUID `json:"job_id"`
+	Status         JobStatus `json:"status"`
+	Progress       int       `json:"progress"`
+	TotalItems     int       `json:"total_items"`
+	InsertedItems  int       `json:"inserted_items"`
+	UpdatedItems   int       `json:"updated_items"`
+	UnchangedItems int       `json:"unchanged_items"`
+	RejectedItems  int       `json:"rejected_items"`
+	ErrorMessage   *string   `json:"error_message,omitempty"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Event returns the current state of the job as an event
+func (j *Job) Event() *JobEvent {
+	return &JobEvent{
+		JobID:          j.ID,
+		Status:         j.Status,
+		Progress:       j.Progress,
+		TotalItems:     j.TotalItems,
+		InsertedItems:  j.InsertedItems,
+		UpdatedItems:   j.UpdatedItems,
+		UnchangedItems: j.UnchangedItems,
+		RejectedItems:  j.RejectedItems,
+		ErrorMessage:   j.ErrorMessage,
+		UpdatedAt:      j.UpdatedAt,
+	}
+}
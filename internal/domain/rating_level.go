@@ -0,0 +1,33 @@
+package domain
+
+// RatingLevel is the canonical five-level scale vendor ratings such as
+// "Outperform" or "Sector Perform" are mapped to
+type RatingLevel string
+
+const (
+	RatingLevelStrongSell RatingLevel = "strong_sell"
+	RatingLevelSell       RatingLevel = "sell"
+	RatingLevelHold       RatingLevel = "hold"
+	RatingLevelBuy        RatingLevel = "buy"
+	RatingLevelStrongBuy  RatingLevel = "strong_buy"
+)
+
+// RatingLevels lists the levels from most bearish to most bullish
+var RatingLevels = []RatingLevel{
+	RatingLevelStrongSell,
+	RatingLevelSell,
+	RatingLevelHold,
+	RatingLevelBuy,
+	RatingLevelStrongBuy,
+}
+
+// Score places the level on a 1 (strong sell) to 5 (strong buy) scale. It is
+// 0 for anything else.
+func (l RatingLevel) Score() int {
+	for i, level := range RatingLevels {
+		if level == l {
+			return i + 1
+		}
+	}
+	return 0
+}
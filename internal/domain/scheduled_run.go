@@ -0,0 +1,21 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ScheduledRun records a sync triggered by the scheduler for one slot of a
+// cron schedule
+type ScheduledRun struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	Schedule     string     `json:"schedule"`
+	Source       string     `json:"source"`
+	ScheduledFor time.Time  `json:"scheduled_for"`
+	JobID        *uuid.UUID `json:"job_id,omitempty" gorm:"type:uuid"`
+	ErrorMessage *string    `json:"error_message,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	// JobStatus is read from the linked job when listing runs
+	JobStatus *JobStatus `json:"job_status,omitempty" gorm:"->"`
+}
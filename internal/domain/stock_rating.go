@@ -1,6 +1,11 @@
 package domain
 
-import "time"
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
 
 // StockRating represents the database model for stock ratings
 type StockRating struct {
@@ -14,6 +19,58 @@ type StockRating struct {
 	RatingFrom string    `json:"rating_from"`
 	RatingTo   string    `json:"rating_to"`
 	Time       time.Time `json:"time"`
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
+	// ActionType classifies Action at ingest, empty when it is not recognized
+	ActionType ActionType `json:"action_type,omitempty" gorm:"type:varchar(20);not null;default:''"`
+	// BrokerageID links the rating to the canonical brokerage of its name
+	BrokerageID *uint `json:"brokerage_id,omitempty"`
+	// TargetFromValue and TargetToValue are the targets parsed at ingest,
+	// nil when the raw value is blank or not a price
+	TargetFromValue *float64 `json:"target_from_value,omitempty" gorm:"type:numeric(14,4)"`
+	TargetToValue   *float64 `json:"target_to_value,omitempty" gorm:"type:numeric(14,4)"`
+	TargetCurrency  string   `json:"target_currency,omitempty" gorm:"type:varchar(3);not null;default:''"`
+	// TargetCurrencyMixed flags targets priced in different currencies,
+	// which are left without values
+	TargetCurrencyMixed bool `json:"target_currency_mixed,omitempty" gorm:"not null;default:false"`
+	// Ratings mapped to the canonical scale at ingest, empty when unmapped
+	RatingFromNormalized RatingLevel `json:"rating_from_normalized,omitempty" gorm:"type:varchar(20);not null;default:''"`
+	RatingFromScore      *int        `json:"rating_from_score,omitempty" gorm:"type:smallint"`
+	RatingToNormalized   RatingLevel `json:"rating_to_normalized,omitempty" gorm:"type:varchar(20);not null;default:''"`
+	RatingToScore        *int        `json:"rating_to_score,omitempty" gorm:"type:smallint"`
+	// Source and SourceJobID record where the rating was first ingested from
+	Source      string     `json:"source" gorm:"default:manual"`
+	SourceJobID *uuid.UUID `json:"source_job_id,omitempty" gorm:"type:uuid"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// NaturalKey identifies a rating by its content rather than its surrogate ID,
+// so the same upstream record always maps to the same row
+func (r *StockRating) NaturalKey() string {
+	return strings.Join([]string{
+		r.Ticker,
+		r.Brokerage,
+		r.Time.UTC().Format(time.RFC3339Nano),
+		r.Action,
+		r.RatingFrom,
+		r.RatingTo,
+		r.TargetFrom,
+		r.TargetTo,
+	}, "|")
+}
+
+// UpsertResult summarizes how a batch of ratings was applied to the store.
+// Duplicate counts ratings repeating the key of an earlier one in the batch.
+type UpsertResult struct {
+	Inserted  int `json:"inserted"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Duplicate int `json:"duplicate"`
+}
+
+// Add accumulates the counters of another result into r
+func (r *UpsertResult) Add(other *UpsertResult) {
+	r.Inserted += other.Inserted
+	r.Updated += other.Updated
+	r.Unchanged += other.Unchanged
+	r.Duplicate += other.Duplicate
 }
@@ -0,0 +1,24 @@
+package domain
+
+import "time"
+
+// ExternalAPISource is the name of the rating source backed by the vendor
+// list API, synced through /api/external/hello
+const ExternalAPISource = "external_api"
+
+type SyncMode string
+
+const (
+	// SyncModeIncremental stops paging once the upstream reaches ratings older
+	// than the last successfully ingested one
+	SyncModeIncremental SyncMode = "incremental"
+	// SyncModeFull downloads the whole upstream history
+	SyncModeFull SyncMode = "full"
+)
+
+// SyncState persists how far a source has been ingested
+type SyncState struct {
+	Source        string     `json:"source" gorm:"primaryKey"`
+	HighWaterMark *time.Time `json:"high_water_mark,omitempty"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,48 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WebhookSubscription registers a URL notified when jobs finish. An empty
+// JobType matches every job.
+type WebhookSubscription struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	URL       string    `json:"url"`
+	JobType   string    `json:"job_type"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliveryDelivered WebhookDeliveryStatus = "delivered"
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "failed"
+)
+
+// WebhookEvent is the name of the event sent when a job reaches status
+func WebhookEvent(status JobStatus) string {
+	return "job." + string(status)
+}
+
+// WebhookDelivery is one finished job notification to one URL, together with
+// the outcome of its latest attempt
+type WebhookDelivery struct {
+	ID             uint                  `json:"id" gorm:"primaryKey"`
+	JobID          uuid.UUID             `json:"job_id" gorm:"type:uuid;not null"`
+	SubscriptionID *uint                 `json:"subscription_id,omitempty"`
+	URL            string                `json:"url"`
+	Event          string                `json:"event"`
+	Payload        string                `json:"-"`
+	Status         WebhookDeliveryStatus `json:"status" gorm:"type:varchar(20);not null;default:'pending'"`
+	Attempts       int                   `json:"attempts"`
+	NextAttemptAt  time.Time             `json:"next_attempt_at"`
+	LastStatusCode *int                  `json:"last_status_code,omitempty"`
+	LastError      *string               `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time            `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time             `json:"created_at"`
+	UpdatedAt      time.Time             `json:"updated_at"`
+}
@@ -0,0 +1,55 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/truora/microservice/internal/domain"
+)
+
+// BrokerageSummary is a brokerage with its aliases and rating totals
+type BrokerageSummary struct {
+	ID           uint       `json:"id"`
+	Name         string     `json:"name"`
+	Aliases      []string   `json:"aliases" gorm:"-"`
+	RatingCount  int64      `json:"rating_count"`
+	TickerCount  int64      `json:"ticker_count"`
+	LastRatingAt *time.Time `json:"last_rating_at,omitempty"`
+}
+
+// BrokerageListResponse lists every brokerage by name
+type BrokerageListResponse struct {
+	TotalCount int                 `json:"total_count"`
+	Brokerages []*BrokerageSummary `json:"brokerages"`
+}
+
+// BrokerageCoverage is what a brokerage last said about one ticker
+type BrokerageCoverage struct {
+	Ticker                 string             `json:"ticker"`
+	Company                string             `json:"company"`
+	RatingCount            int64              `json:"rating_count"`
+	LatestRating           string             `json:"latest_rating"`
+	LatestRatingNormalized domain.RatingLevel `json:"latest_rating_normalized,omitempty"`
+	LatestTarget           string             `json:"latest_target"`
+	LastRatingAt           time.Time          `json:"last_rating_at"`
+}
+
+// BrokerageActivity summarizes how often and how a brokerage rates.
+// ByActionType counts unclassified actions under "other".
+type BrokerageActivity struct {
+	RatingCount   int64            `json:"rating_count"`
+	Last30Days    int64            `json:"last_30_days" gorm:"column:last30_days"`
+	FirstRatingAt *time.Time       `json:"first_rating_at,omitempty"`
+	LastRatingAt  *time.Time       `json:"last_rating_at,omitempty"`
+	ByActionType  map[string]int64 `json:"by_action_type" gorm:"-"`
+}
+
+// BrokerageDetailResponse is a brokerage with its coverage, activity and
+// latest ratings
+type BrokerageDetailResponse struct {
+	ID            uint                   `json:"id"`
+	Name          string                 `json:"name"`
+	Aliases       []string               `json:"aliases"`
+	Activity      *BrokerageActivity     `json:"activity"`
+	Coverage      []*BrokerageCoverage   `json:"coverage"`
+	RecentRatings []*StockRatingResponse `json:"recent_ratings"`
+}
@@ -0,0 +1,86 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/truora/microservice/internal/domain"
+)
+
+// CompanySummary is a company with its rating totals
+type CompanySummary struct {
+	Ticker       string     `json:"ticker"`
+	Name         string     `json:"name"`
+	Exchange     string     `json:"exchange"`
+	RatingCount  int64      `json:"rating_count"`
+	LastRatingAt *time.Time `json:"last_rating_at,omitempty"`
+}
+
+// CompanyListResponse is a page of companies ordered by ticker
+type CompanyListResponse struct {
+	Data       []*CompanySummary `json:"data"`
+	Page       int               `json:"page"`
+	PageSize   int               `json:"page_size"`
+	TotalCount int64             `json:"total_count"`
+	TotalPages int               `json:"total_pages"`
+	HasNext    bool              `json:"has_next"`
+	HasPrev    bool              `json:"has_prev"`
+}
+
+// CompanyRatingStats summarizes the ratings of a company. ByActionType
+// counts unclassified actions under "other".
+type CompanyRatingStats struct {
+	RatingCount    int64            `json:"rating_count"`
+	BrokerageCount int64            `json:"brokerage_count"`
+	Last30Days     int64            `json:"last_30_days" gorm:"column:last30_days"`
+	FirstRatingAt  *time.Time       `json:"first_rating_at,omitempty"`
+	LastRatingAt   *time.Time       `json:"last_rating_at,omitempty"`
+	ByActionType   map[string]int64 `json:"by_action_type" gorm:"-"`
+}
+
+// CompanyConsensus aggregates the latest rating of each brokerage covering a
+// company. Ratings off the canonical scale are counted but not scored.
+type CompanyConsensus struct {
+	BrokerageCount int64                        `json:"brokerage_count"`
+	AverageScore   *float64                     `json:"average_score"`
+	Ratings        map[domain.RatingLevel]int64 `json:"ratings" gorm:"-"`
+}
+
+// CompanyDetailResponse is a company with its history and rating statistics
+type CompanyDetailResponse struct {
+	*domain.Company
+	Aliases     []string              `json:"aliases"`
+	NameHistory []*domain.CompanyName `json:"name_history"`
+	Stats       *CompanyRatingStats   `json:"stats"`
+	Consensus   *CompanyConsensus     `json:"consensus"`
+}
+
+// SearchResult is a company matching a search. MatchedName is the former
+// name that matched, when the current one did not.
+type SearchResult struct {
+	Ticker        string     `json:"ticker"`
+	Name          string     `json:"name"`
+	Exchange      string     `json:"exchange"`
+	MatchedName   *string    `json:"matched_name,omitempty"`
+	MatchScore    float64    `json:"match_score"`
+	RecentRatings int64      `json:"recent_ratings"`
+	LastRatingAt  *time.Time `json:"last_rating_at,omitempty"`
+}
+
+// SearchResponse lists the companies matching a query, best match first
+type SearchResponse struct {
+	Query string          `json:"query"`
+	Data  []*SearchResult `json:"data"`
+}
+
+// AutocompleteSuggestion is a company whose ticker or name starts with the
+// typed text
+type AutocompleteSuggestion struct {
+	Ticker string `json:"ticker"`
+	Name   string `json:"name"`
+}
+
+// AutocompleteResponse lists suggestions for the typed text
+type AutocompleteResponse struct {
+	Query string                    `json:"query"`
+	Data  []*AutocompleteSuggestion `json:"data"`
+}
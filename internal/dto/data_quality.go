@@ -0,0 +1,25 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/truora/microservice/internal/domain"
+)
+
+// DataQualityRuleResult is what one rule found in a scan
+type DataQualityRuleResult struct {
+	Rule        domain.DataQualityRule `json:"rule"`
+	Description string                 `json:"description"`
+	Count       int64                  `json:"count"`
+	SampleIDs   []uint                 `json:"sample_ids"`
+}
+
+// DataQualityReport lists the findings of the latest completed scan, in the
+// order the rules ran. Rules disabled at the time are left out.
+type DataQualityReport struct {
+	JobID         uuid.UUID                `json:"job_id"`
+	ScannedAt     *time.Time               `json:"scanned_at"`
+	TotalFindings int64                    `json:"total_findings"`
+	Rules         []*DataQualityRuleResult `json:"rules"`
+}
@@ -0,0 +1,96 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/truora/microservice/internal/domain"
+)
+
+// JobSortFields maps the accepted sort parameters of the job list to columns
+var JobSortFields = map[string]string{
+	"created_at":   "created_at",
+	"updated_at":   "updated_at",
+	"completed_at": "completed_at",
+	"status":       "status",
+	"type":         "type",
+	"progress":     "progress",
+}
+
+// JobFilter narrows job listings and summaries. Empty fields match every job.
+type JobFilter struct {
+	Statuses []domain.JobStatus
+	Types    []string
+	// CreatedFrom is inclusive and CreatedTo exclusive
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	// SortBy is a key of JobSortFields, defaulting to created_at
+	SortBy   string
+	SortDesc bool
+}
+
+// JobListResponse is a page of jobs with pagination metadata
+type JobListResponse struct {
+	Data       []*domain.Job `json:"data"`
+	Page       int           `json:"page"`
+	PageSize   int           `json:"page_size"`
+	TotalCount int64         `json:"total_count"`
+	TotalPages int           `json:"total_pages"`
+	HasNext    bool          `json:"has_next"`
+	HasPrev    bool          `json:"has_prev"`
+}
+
+// JobErrorListResponse is a page of the item-level errors of a job
+type JobErrorListResponse struct {
+	Data       []*domain.JobError `json:"data"`
+	Page       int                `json:"page"`
+	PageSize   int                `json:"page_size"`
+	TotalCount int64              `json:"total_count"`
+	TotalPages int                `json:"total_pages"`
+	HasNext    bool               `json:"has_next"`
+	HasPrev    bool               `json:"has_prev"`
+}
+
+// JobRetentionCriteria selects up to Limit finished jobs of one status that
+// last changed before Before. Types and ExcludeTypes are ignored when empty.
+type JobRetentionCriteria struct {
+	Status       domain.JobStatus
+	Types        []string
+	ExcludeTypes []string
+	Before       time.Time
+	Limit        int
+	// KeepLatestTypes are job types whose latest completed job is kept
+	KeepLatestTypes []string
+}
+
+// PruneRuleResult reports what one retention rule removed
+type PruneRuleResult struct {
+	JobType    string           `json:"job_type,omitempty"`
+	Status     domain.JobStatus `json:"status"`
+	MaxAgeDays int              `json:"max_age_days"`
+	OlderThan  time.Time        `json:"older_than"`
+	Removed    int64            `json:"removed"`
+}
+
+// PruneReport summarizes a pruning pass. In a dry run Removed counts the jobs
+// that would have been removed.
+type PruneReport struct {
+	DryRun       bool               `json:"dry_run"`
+	Archived     bool               `json:"archived"`
+	TotalRemoved int64              `json:"total_removed"`
+	Rules        []*PruneRuleResult `json:"rules"`
+}
+
+// JobStats aggregates the jobs of one type and status. AvgDurationSeconds is
+// only set for finished statuses.
+type JobStats struct {
+	Type               string           `json:"type"`
+	Status             domain.JobStatus `json:"status"`
+	Count              int64            `json:"count"`
+	AvgDurationSeconds *float64         `json:"avg_duration_seconds"`
+}
+
+// JobSummaryResponse reports job counts and durations per type and status
+type JobSummaryResponse struct {
+	TotalCount int64       `json:"total_count"`
+	Stats      []*JobStats `json:"stats"`
+}
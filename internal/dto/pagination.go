@@ -1,5 +1,12 @@
 package dto
 
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
 // PaginatedResponse represents a paginated response with metadata
 type PaginatedResponse struct {
 	Data       []*StockRatingResponse `json:"data"`
@@ -10,3 +17,45 @@ type PaginatedResponse struct {
 	HasNext    bool                   `json:"has_next"`
 	HasPrev    bool                   `json:"has_prev"`
 }
+
+// CursorPaginatedResponse is a page of a cursor-paginated listing. The
+// cursors are nil at either end of the listing.
+type CursorPaginatedResponse struct {
+	Data       []*StockRatingResponse `json:"data"`
+	PageSize   int                    `json:"page_size"`
+	NextCursor *string                `json:"next_cursor"`
+	PrevCursor *string                `json:"prev_cursor"`
+	HasNext    bool                   `json:"has_next"`
+	HasPrev    bool                   `json:"has_prev"`
+}
+
+// ErrInvalidCursor is returned for cursors this service did not issue
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// RatingCursor is a position between two ratings of a listing ordered by
+// (time, id)
+type RatingCursor struct {
+	Time time.Time `json:"t"`
+	ID   uint      `json:"i"`
+	// Backward pages towards the start of the listing instead of its end
+	Backward bool `json:"b,omitempty"`
+}
+
+// Encode returns the opaque form of the cursor handed to clients
+func (c *RatingCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeRatingCursor reads a cursor returned by Encode
+func DecodeRatingCursor(encoded string) (*RatingCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor RatingCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == 0 || cursor.Time.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
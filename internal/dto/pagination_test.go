@@ -0,0 +1,56 @@
+package dto
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRatingCursorRoundTrip(t *testing.T) {
+	at := time.Date(2024, 3, 1, 14, 30, 0, 123456789, time.UTC)
+	for _, cursor := range []RatingCursor{
+		{Time: at, ID: 42},
+		{Time: at, ID: 7, Backward: true},
+	} {
+		encoded := cursor.Encode()
+		if strings.ContainsAny(encoded, "+/=") {
+			t.Errorf("Encode() = %q, which is not URL safe", encoded)
+		}
+		got, err := DecodeRatingCursor(encoded)
+		if err != nil {
+			t.Fatalf("DecodeRatingCursor(%q) error = %v", encoded, err)
+		}
+		if !got.Time.Equal(cursor.Time) || got.ID != cursor.ID || got.Backward != cursor.Backward {
+			t.Errorf("DecodeRatingCursor(%q) = %+v, want %+v", encoded, *got, cursor)
+		}
+	}
+}
+
+func TestDecodeRatingCursorRejectsForeignCursors(t *testing.T) {
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	valid := (&RatingCursor{Time: time.Now(), ID: 1}).Encode()
+
+	tests := map[string]string{
+		"empty":         "",
+		"not base64":    "not a cursor!",
+		"padded base64": base64.URLEncoding.EncodeToString([]byte(`{"t":"2024-03-01T00:00:00Z","i":1}`)),
+		"truncated":     valid[:len(valid)-4],
+		"not JSON":      encode("page=2"),
+		"wrong types":   encode(`{"t":"yesterday","i":1}`),
+		"negative id":   encode(`{"t":"2024-03-01T00:00:00Z","i":-1}`),
+		"zero id":       encode(`{"t":"2024-03-01T00:00:00Z","i":0}`),
+		"missing id":    encode(`{"t":"2024-03-01T00:00:00Z"}`),
+		"missing time":  encode(`{"i":1}`),
+		"empty object":  encode(`{}`),
+		"offset cursor": encode(`{"offset":20}`),
+	}
+	for name, encoded := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := DecodeRatingCursor(encoded); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("DecodeRatingCursor(%q) error = %v, want %v", encoded, err, ErrInvalidCursor)
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+package dto
+
+import "time"
+
+// RatingSourceResponse describes a configured rating source
+type RatingSourceResponse struct {
+	Name          string     `json:"name"`
+	Kind          string     `json:"kind"`
+	JobType       string     `json:"job_type"`
+	HighWaterMark *time.Time `json:"high_water_mark,omitempty"`
+}
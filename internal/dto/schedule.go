@@ -0,0 +1,25 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/truora/microservice/internal/domain"
+)
+
+// ScheduleResponse describes a configured sync schedule and its next slots
+type ScheduleResponse struct {
+	Name     string      `json:"name"`
+	Source   string      `json:"source"`
+	Mode     string      `json:"mode"`
+	Cron     string      `json:"cron"`
+	Upcoming []time.Time `json:"upcoming"`
+}
+
+// ScheduleRunsResponse lists upcoming and past scheduled runs
+type ScheduleRunsResponse struct {
+	// Leader reports whether the replica that served the request is the one
+	// triggering scheduled runs
+	Leader    bool                   `json:"leader"`
+	Schedules []*ScheduleResponse    `json:"schedules"`
+	Past      []*domain.ScheduledRun `json:"past"`
+}
@@ -1,9 +1,12 @@
 package dto
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/truora/microservice/internal/domain"
+	"github.com/truora/microservice/internal/price"
 )
 
 type Response struct {
@@ -22,11 +25,28 @@ type StockRatingResponse struct {
 	RatingFrom string    `json:"rating_from"`
 	RatingTo   string    `json:"rating_to"`
 	Time       time.Time `json:"time"`
+	Source     string    `json:"source,omitempty"`
+	// ActionType classifies Action, filled in from the stored rating
+	ActionType domain.ActionType `json:"action_type,omitempty"`
+	// BrokerageID is the canonical brokerage, resolved from Brokerage
+	BrokerageID *uint `json:"brokerage_id,omitempty"`
+	// Parsed targets, filled in from the stored rating
+	TargetFromValue *float64 `json:"target_from_value,omitempty"`
+	TargetToValue   *float64 `json:"target_to_value,omitempty"`
+	TargetCurrency  string   `json:"target_currency,omitempty"`
+	// TargetCurrencyMixed is set when the targets use different currencies
+	TargetCurrencyMixed bool `json:"target_currency_mixed,omitempty"`
+	// Ratings on the canonical scale, filled in from the stored rating
+	RatingFromNormalized domain.RatingLevel `json:"rating_from_normalized,omitempty"`
+	RatingFromScore      *int               `json:"rating_from_score,omitempty"`
+	RatingToNormalized   domain.RatingLevel `json:"rating_to_normalized,omitempty"`
+	RatingToScore        *int               `json:"rating_to_score,omitempty"`
 }
 
-// ToDomain converts the DTO to a domain model
+// ToDomain converts the DTO to a domain model, parsing the price targets and
+// classifying the action
 func (dto *StockRatingResponse) ToDomain() *domain.StockRating {
-	return &domain.StockRating{
+	rating := &domain.StockRating{
 		Ticker:     dto.Ticker,
 		TargetFrom: dto.TargetFrom,
 		TargetTo:   dto.TargetTo,
@@ -36,7 +56,15 @@ func (dto *StockRatingResponse) ToDomain() *domain.StockRating {
 		RatingFrom: dto.RatingFrom,
 		RatingTo:   dto.RatingTo,
 		Time:       dto.Time,
+		ActionType: domain.ClassifyAction(dto.Action),
 	}
+
+	targets := price.ParseTargets(dto.TargetFrom, dto.TargetTo)
+	rating.TargetFromValue = targets.From
+	rating.TargetToValue = targets.To
+	rating.TargetCurrency = targets.Currency
+	rating.TargetCurrencyMixed = targets.Mixed
+	return rating
 }
 
 // FromDomain creates a DTO from a domain model
@@ -51,5 +79,111 @@ func FromDomain(model *domain.StockRating) *StockRatingResponse {
 		RatingFrom: model.RatingFrom,
 		RatingTo:   model.RatingTo,
 		Time:       model.Time,
+		Source:     model.Source,
+		ActionType: model.ActionType,
+
+		BrokerageID: model.BrokerageID,
+
+		TargetFromValue: model.TargetFromValue,
+		TargetToValue:   model.TargetToValue,
+		TargetCurrency:  model.TargetCurrency,
+
+		TargetCurrencyMixed: model.TargetCurrencyMixed,
+
+		RatingFromNormalized: model.RatingFromNormalized,
+		RatingFromScore:      model.RatingFromScore,
+		RatingToNormalized:   model.RatingToNormalized,
+		RatingToScore:        model.RatingToScore,
+	}
+}
+
+// Validate checks that the rating can be stored, mirroring the column limits
+// of the stock_ratings table
+func (dto *StockRatingResponse) Validate() error {
+	if dto.Ticker == "" {
+		return errors.New("ticker is required")
+	}
+	if dto.Time.IsZero() {
+		return errors.New("time is required")
+	}
+
+	limits := []struct {
+		name  string
+		value string
+		max   int
+	}{
+		{"ticker", dto.Ticker, 10},
+		{"target_from", dto.TargetFrom, 50},
+		{"target_to", dto.TargetTo, 50},
+		{"company", dto.Company, 255},
+		{"action", dto.Action, 50},
+		{"brokerage", dto.Brokerage, 255},
+		{"rating_from", dto.RatingFrom, 50},
+		{"rating_to", dto.RatingTo, 50},
 	}
+	for _, limit := range limits {
+		if len([]rune(limit.value)) > limit.max {
+			return fmt.Errorf("%s exceeds %d characters", limit.name, limit.max)
+		}
+	}
+	return nil
+}
+
+// StockRatingSortFields maps the accepted sort parameters of the rating
+// listings to columns. Ratings sort by their score on the canonical scale and
+// targets by their parsed value.
+var StockRatingSortFields = map[string]string{
+	"time":        "time",
+	"ticker":      "ticker",
+	"company":     "company",
+	"brokerage":   "brokerage",
+	"action":      "action",
+	"action_type": "action_type",
+	"rating_from": "rating_from_score",
+	"rating_to":   "rating_to_score",
+	"target_from": "target_from_value",
+	"target_to":   "target_to_value",
+	"created_at":  "created_at",
+	"updated_at":  "updated_at",
+}
+
+// StockRatingFilter narrows rating listings. Empty fields match every rating.
+type StockRatingFilter struct {
+	ActionTypes []domain.ActionType
+	// Tickers are normalized, so aliases match their company's ratings
+	Tickers []string
+	// Brokerages are matched by brokerage key, so any known spelling works
+	Brokerages   []string
+	BrokerageIDs []uint
+	// Actions, RatingsFrom and RatingsTo match the raw values ignoring case
+	Actions     []string
+	RatingsFrom []string
+	RatingsTo   []string
+	// TimeFrom is inclusive and TimeTo exclusive
+	TimeFrom *time.Time
+	TimeTo   *time.Time
+	// TargetMin and TargetMax bound the parsed target_to, both inclusive
+	TargetMin *float64
+	TargetMax *float64
+	// SortBy is a key of StockRatingSortFields, defaulting to time
+	SortBy   string
+	SortDesc bool
+}
+
+// UnmappedRating is a raw rating the rating scale has no level for
+type UnmappedRating struct {
+	Value       string    `json:"value"`
+	Occurrences int64     `json:"occurrences"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+// UnmappedRatingsResponse lists the unmapped ratings, most frequent first
+type UnmappedRatingsResponse struct {
+	TotalCount int               `json:"total_count"`
+	Ratings    []*UnmappedRating `json:"ratings"`
+}
+
+// RatingNormalizationResult reports how many ratings a renormalization changed
+type RatingNormalizationResult struct {
+	Updated int64 `json:"updated"`
 }
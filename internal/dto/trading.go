@@ -21,6 +21,7 @@ type DateRange struct {
 // TradingRecommendation represents a trading recommendation from the algorithm
 type TradingRecommendation struct {
 	Ticker           string    `json:"ticker"`
+	Currency         string    `json:"currency"`
 	BuyPrice         float64   `json:"buy_price"`
 	SellPrice        float64   `json:"sell_price"`
 	MaxProfit        float64   `json:"max_profit"`
@@ -0,0 +1,16 @@
+package dto
+
+import "github.com/truora/microservice/internal/domain"
+
+// WebhookPayload is the body POSTed to webhook URLs when a job finishes
+type WebhookPayload struct {
+	Event string      `json:"event"`
+	Job   *domain.Job `json:"job"`
+}
+
+// WebhookSubscriptionRequest registers a webhook URL. An empty JobType
+// subscribes to every job.
+type WebhookSubscriptionRequest struct {
+	URL     string `json:"url"`
+	JobType string `json:"job_type"`
+}
@@ -0,0 +1,72 @@
+package httpclient
+
+import (
+	"sync"
+	"time"
+)
+
+// circuitBreaker opens after a run of consecutive failures and rejects calls
+// until the cooldown elapses. After that it is half-open: one trial call goes
+// through while the others are still rejected, and the trial's success closes
+// it again while its failure re-opens it.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openedAt  time.Time
+	// probing is set while the trial call of the half-open breaker runs
+	probing bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// allow reports whether a call may go through, and whether it is the trial
+// call of the half-open breaker. A trial must end in recordSuccess,
+// recordFailure or abandonTrial, or the breaker stays open.
+func (b *circuitBreaker) allow() (allowed, trial bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true, false
+	}
+	if b.probing || time.Since(b.openedAt) < b.cooldown {
+		return false, false
+	}
+	b.probing = true
+	return true, true
+}
+
+func (b *circuitBreaker) recordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+}
+
+func (b *circuitBreaker) recordFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.failures >= b.threshold {
+		b.openedAt = time.Now()
+	}
+}
+
+// abandonTrial lets the next call make the trial when the current one ended
+// without telling whether the upstream recovered
+func (b *circuitBreaker) abandonTrial() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
@@ -0,0 +1,220 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting the server while the circuit
+// breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// Config controls the retry and circuit breaker behaviour of a Client. Zero
+// values fall back to the defaults below.
+type Config struct {
+	// Timeout bounds a single attempt, independently of the caller's context
+	Timeout time.Duration
+	// MaxRetries is the number of retries after the first attempt. Nil
+	// falls back to the default and zero disables retries.
+	MaxRetries     *int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// FailureThreshold is the number of consecutive failed attempts that opens
+	// the circuit breaker
+	FailureThreshold int
+	// Cooldown is how long the breaker stays open before letting a trial
+	// request through
+	Cooldown time.Duration
+}
+
+const (
+	defaultTimeout          = 30 * time.Second
+	defaultMaxRetries       = 3
+	defaultInitialBackoff   = 500 * time.Millisecond
+	defaultMaxBackoff       = 30 * time.Second
+	defaultFailureThreshold = 5
+	defaultCooldown         = time.Minute
+)
+
+func (c Config) withDefaults() Config {
+	if c.Timeout <= 0 {
+		c.Timeout = defaultTimeout
+	}
+	if c.MaxRetries == nil {
+		maxRetries := defaultMaxRetries
+		c.MaxRetries = &maxRetries
+	} else if *c.MaxRetries < 0 {
+		maxRetries := 0
+		c.MaxRetries = &maxRetries
+	}
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = defaultInitialBackoff
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = defaultMaxBackoff
+	}
+	if c.FailureThreshold <= 0 {
+		c.FailureThreshold = defaultFailureThreshold
+	}
+	if c.Cooldown <= 0 {
+		c.Cooldown = defaultCooldown
+	}
+	return c
+}
+
+// Client is an HTTP client meant to be shared by every request to one
+// upstream. It retries transient failures (network errors, 5xx and 429) with
+// exponential backoff and jitter, honours Retry-After and stops calling the
+// upstream altogether while its circuit breaker is open.
+type Client struct {
+	httpClient *http.Client
+	config     Config
+	breaker    *circuitBreaker
+}
+
+func New(config Config) *Client {
+	config = config.withDefaults()
+	return &Client{
+		httpClient: &http.Client{Timeout: config.Timeout},
+		config:     config,
+		breaker:    newCircuitBreaker(config.FailureThreshold, config.Cooldown),
+	}
+}
+
+// Do sends req, retrying transient failures until MaxRetries is exhausted or
+// the request context is done. Only the last response is returned, and a
+// non-retryable status such as 404 is returned as-is for the caller to handle.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	for attempt := 0; ; attempt++ {
+		attemptReq, err := cloneRequest(req)
+		if err != nil {
+			return nil, err
+		}
+
+		allowed, trial := c.breaker.allow()
+		if !allowed {
+			return nil, ErrCircuitOpen
+		}
+
+		resp, err := c.httpClient.Do(attemptReq)
+		if err != nil && ctx.Err() != nil {
+			// The caller gave up, which says nothing about the upstream's health
+			if trial {
+				c.breaker.abandonTrial()
+			}
+			return nil, ctx.Err()
+		}
+
+		wait, retryable := c.retryDelay(resp, err, attempt)
+		if !retryable {
+			c.breaker.recordSuccess()
+			return resp, nil
+		}
+		c.breaker.recordFailure()
+
+		if attempt >= *c.config.MaxRetries {
+			if err != nil {
+				return nil, fmt.Errorf("giving up after %d attempts: %w", attempt+1, err)
+			}
+			return resp, nil
+		}
+
+		// Close the failed response so the connection can be reused
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		if err := sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryDelay reports whether an attempt failed transiently and how long to
+// wait before the next one
+func (c *Client) retryDelay(resp *http.Response, err error, attempt int) (time.Duration, bool) {
+	if err != nil {
+		return c.backoff(attempt), true
+	}
+
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+		return 0, false
+	}
+
+	// Retry-After is capped like the backoff so an upstream cannot stall the
+	// caller for longer
+	if wait, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+		if wait > c.config.MaxBackoff {
+			wait = c.config.MaxBackoff
+		}
+		return wait, true
+	}
+	return c.backoff(attempt), true
+}
+
+// backoff returns an exponentially growing delay with equal jitter, capped at
+// MaxBackoff
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := c.config.InitialBackoff << uint(attempt)
+	if delay <= 0 || delay > c.config.MaxBackoff {
+		delay = c.config.MaxBackoff
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// parseRetryAfter understands both forms allowed by RFC 9110: a number of
+// seconds or an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+// cloneRequest gives each attempt its own copy of req, rewinding the body
+// when the request has one
+func cloneRequest(req *http.Request) (*http.Request, error) {
+	clone := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return clone, nil
+	}
+	if req.GetBody == nil {
+		return nil, errors.New("request body cannot be replayed for retries")
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, fmt.Errorf("failed to rewind request body: %w", err)
+	}
+	clone.Body = body
+	return clone, nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,315 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// statusServer answers each request with the next status of statuses,
+// repeating the last one, and counts the requests it received
+func statusServer(t *testing.T, header http.Header, statuses ...int) (*httptest.Server, *int32) {
+	t.Helper()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&requests, 1))
+		if n > len(statuses) {
+			n = len(statuses)
+		}
+		for key, values := range header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(statuses[n-1])
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func retries(n int) *int {
+	return &n
+}
+
+func fastConfig() Config {
+	return Config{
+		Timeout:          time.Second,
+		MaxRetries:       retries(3),
+		InitialBackoff:   time.Millisecond,
+		MaxBackoff:       5 * time.Millisecond,
+		FailureThreshold: 100,
+		Cooldown:         time.Minute,
+	}
+}
+
+func get(t *testing.T, client *Client, url string) (*http.Response, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if resp != nil {
+		resp.Body.Close()
+	}
+	return resp, err
+}
+
+func TestDoRetriesTransientStatuses(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+	}{
+		{"server errors", []int{http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusOK}},
+		{"too many requests", []int{http.StatusTooManyRequests, http.StatusOK}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := statusServer(t, nil, tt.statuses...)
+
+			resp, err := get(t, New(fastConfig()), server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("got status %d, want 200", resp.StatusCode)
+			}
+			if int(*requests) != len(tt.statuses) {
+				t.Errorf("sent %d requests, want %d", *requests, len(tt.statuses))
+			}
+		})
+	}
+}
+
+func TestDoReturnsOtherClientErrorsWithoutRetrying(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound} {
+		server, requests := statusServer(t, nil, status)
+
+		resp, err := get(t, New(fastConfig()), server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != status || *requests != 1 {
+			t.Errorf("status %d: got %d after %d requests, want it after 1", status, resp.StatusCode, *requests)
+		}
+	}
+}
+
+func TestDoReturnsLastResponseOnceRetriesAreExhausted(t *testing.T) {
+	server, requests := statusServer(t, nil, http.StatusBadGateway)
+	config := fastConfig()
+	config.MaxRetries = retries(2)
+
+	resp, err := get(t, New(config), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusBadGateway || *requests != 3 {
+		t.Errorf("got %d after %d requests, want 502 after 3", resp.StatusCode, *requests)
+	}
+}
+
+func TestDoWithRetriesDisabled(t *testing.T) {
+	server, requests := statusServer(t, nil, http.StatusServiceUnavailable, http.StatusOK)
+	config := fastConfig()
+	config.MaxRetries = retries(0)
+
+	resp, err := get(t, New(config), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable || *requests != 1 {
+		t.Errorf("got %d after %d requests, want 503 after 1", resp.StatusCode, *requests)
+	}
+}
+
+func TestMaxRetriesDefaultsOnlyWhenUnset(t *testing.T) {
+	if got := *(Config{}).withDefaults().MaxRetries; got != defaultMaxRetries {
+		t.Errorf("unset MaxRetries became %d, want %d", got, defaultMaxRetries)
+	}
+	if got := *(Config{MaxRetries: retries(0)}).withDefaults().MaxRetries; got != 0 {
+		t.Errorf("zero MaxRetries became %d, want 0", got)
+	}
+}
+
+func TestDoCapsRetryAfterAtMaxBackoff(t *testing.T) {
+	header := http.Header{"Retry-After": []string{"86400"}}
+	server, requests := statusServer(t, header, http.StatusServiceUnavailable, http.StatusOK)
+
+	start := time.Now()
+	resp, err := get(t, New(fastConfig()), server.URL)
+	if err != nil {
+		t.Fatalf("request did not finish: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || *requests != 2 {
+		t.Errorf("got %d after %d requests, want 200 after 2", resp.StatusCode, *requests)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("waited %v for a retry capped at 5ms", elapsed)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		value    string
+		min, max time.Duration
+		ok       bool
+	}{
+		{"seconds", "120", 120 * time.Second, 120 * time.Second, true},
+		{"zero seconds", "0", 0, 0, true},
+		{"http date", now.Add(30 * time.Second).UTC().Format(http.TimeFormat), 28 * time.Second, 30 * time.Second, true},
+		{"past http date", now.Add(-time.Hour).UTC().Format(http.TimeFormat), 0, 0, true},
+		{"empty", "", 0, 0, false},
+		{"negative seconds", "-5", 0, 0, false},
+		{"garbage", "soon", 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wait, ok := parseRetryAfter(tt.value)
+			if ok != tt.ok {
+				t.Fatalf("parseRetryAfter(%q) ok = %v, want %v", tt.value, ok, tt.ok)
+			}
+			if wait < tt.min || wait > tt.max {
+				t.Errorf("parseRetryAfter(%q) = %v, want between %v and %v", tt.value, wait, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestDoHonoursRetryAfterDate(t *testing.T) {
+	// The header format drops sub-second precision, so a date two seconds
+	// ahead still asks for a wait of more than one second
+	header := http.Header{"Retry-After": []string{time.Now().Add(2 * time.Second).UTC().Format(http.TimeFormat)}}
+	server, requests := statusServer(t, header, http.StatusTooManyRequests, http.StatusOK)
+	config := fastConfig()
+	config.MaxBackoff = 5 * time.Second
+
+	start := time.Now()
+	resp, err := get(t, New(config), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || *requests != 2 {
+		t.Errorf("got %d after %d requests, want 200 after 2", resp.StatusCode, *requests)
+	}
+	if elapsed := time.Since(start); elapsed < 500*time.Millisecond {
+		t.Errorf("retried after %v, before the Retry-After date", elapsed)
+	}
+}
+
+func TestCircuitBreakerOpensAndHalfOpens(t *testing.T) {
+	server, requests := statusServer(t, nil,
+		http.StatusInternalServerError, http.StatusInternalServerError, // open the breaker
+		http.StatusInternalServerError, // failed trial re-opens it
+		http.StatusOK)                  // successful trial closes it
+	config := fastConfig()
+	config.MaxRetries = retries(0)
+	config.FailureThreshold = 2
+	config.Cooldown = 100 * time.Millisecond
+	client := New(config)
+
+	for i := 0; i < 2; i++ {
+		if _, err := get(t, client, server.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := get(t, client, server.URL); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got %v with the breaker open, want ErrCircuitOpen", err)
+	}
+	if *requests != 2 {
+		t.Fatalf("open breaker let a request through: %d requests", *requests)
+	}
+
+	time.Sleep(config.Cooldown)
+	resp, err := get(t, client, server.URL)
+	if err != nil || resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("half-open breaker did not let the trial through: %v", err)
+	}
+	if _, err := get(t, client, server.URL); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got %v after a failed trial, want ErrCircuitOpen", err)
+	}
+
+	time.Sleep(config.Cooldown)
+	for i := 0; i < 2; i++ {
+		resp, err := get(t, client, server.URL)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("breaker did not close after a successful trial: %v", err)
+		}
+	}
+	if *requests != 5 {
+		t.Errorf("sent %d requests, want 5", *requests)
+	}
+}
+
+func TestCircuitBreakerLetsOneTrialThroughWhileHalfOpen(t *testing.T) {
+	var requests int32
+	trialStarted, finishTrial := make(chan struct{}), make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&requests, 1) {
+		case 1:
+			w.WriteHeader(http.StatusInternalServerError)
+		case 2:
+			close(trialStarted)
+			<-finishTrial
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	config := fastConfig()
+	config.MaxRetries = retries(0)
+	config.FailureThreshold = 1
+	config.Cooldown = 50 * time.Millisecond
+	client := New(config)
+
+	if _, err := get(t, client, server.URL); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(config.Cooldown)
+
+	trial := make(chan error, 1)
+	go func() {
+		_, err := get(t, client, server.URL)
+		trial <- err
+	}()
+	<-trialStarted
+
+	for i := 0; i < 3; i++ {
+		if _, err := get(t, client, server.URL); !errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("got %v during the trial, want ErrCircuitOpen", err)
+		}
+	}
+
+	close(finishTrial)
+	if err := <-trial; err != nil {
+		t.Fatalf("trial failed: %v", err)
+	}
+	if _, err := get(t, client, server.URL); err != nil {
+		t.Fatalf("breaker did not close after the trial: %v", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Errorf("sent %d requests, want 3", n)
+	}
+}
+
+func TestCircuitBreakerAbandonedTrialLetsTheNextOneThrough(t *testing.T) {
+	breaker := newCircuitBreaker(1, 0)
+	breaker.recordFailure()
+
+	if allowed, trial := breaker.allow(); !allowed || !trial {
+		t.Fatalf("allow() = %v, %v, want the trial", allowed, trial)
+	}
+	if allowed, _ := breaker.allow(); allowed {
+		t.Fatal("a second call went through during the trial")
+	}
+
+	breaker.abandonTrial()
+	if allowed, trial := breaker.allow(); !allowed || !trial {
+		t.Fatalf("allow() = %v, %v after an abandoned trial, want a new trial", allowed, trial)
+	}
+}
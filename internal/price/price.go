@@ -0,0 +1,149 @@
+// Package price parses the free-form price targets published by brokerages,
+// such as "$1,234.50", "€12,50" or "1 234 USD".
+package price
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultCurrency is assumed for prices without a currency symbol or code
+	DefaultCurrency = "USD"
+	// maxValue bounds plausible prices, which are stored as NUMERIC(14,4)
+	maxValue = 1e10
+)
+
+var (
+	// ErrNoPrice is returned for blanks and placeholders such as "N/A"
+	ErrNoPrice = errors.New("no price")
+	// ErrInvalidPrice is returned for text that is not a price
+	ErrInvalidPrice = errors.New("invalid price")
+)
+
+// Amount is a parsed price
+type Amount struct {
+	Value float64
+	// Currency is an ISO 4217 code
+	Currency string
+}
+
+// placeholders are the values brokerages publish instead of a target
+var placeholders = map[string]struct{}{
+	"-": {}, "--": {}, "—": {}, "n/a": {}, "na": {}, "none": {}, "null": {},
+}
+
+// currencySymbols maps symbols to ISO codes, longest first so "US$" wins over "$"
+var currencySymbols = []struct {
+	symbol string
+	code   string
+}{
+	{"US$", "USD"}, {"CA$", "CAD"}, {"AU$", "AUD"}, {"HK$", "HKD"},
+	{"C$", "CAD"}, {"A$", "AUD"}, {"R$", "BRL"},
+	{"$", "USD"}, {"€", "EUR"}, {"£", "GBP"}, {"¥", "JPY"}, {"₹", "INR"},
+}
+
+var (
+	isoPrefix = regexp.MustCompile(`^([A-Z]{3})\s*(.*)$`)
+	isoSuffix = regexp.MustCompile(`^(.*?)\s*([A-Z]{3})$`)
+	// Digits with "," or "." separators, the only text left once the currency
+	// and group spacing are removed
+	numeric       = regexp.MustCompile(`^[0-9.,]*[0-9][0-9.,]*$`)
+	commaGroups   = regexp.MustCompile(`^[0-9]{1,3}(,[0-9]{3})+$`)
+	commaDecimal  = regexp.MustCompile(`^[0-9]*,[0-9]+$`)
+	dotGroups     = regexp.MustCompile(`^[0-9]{1,3}(\.[0-9]{3}){2,}$`)
+	groupSpacings = strings.NewReplacer(" ", "", " ", "", " ", "", "'", "")
+)
+
+// Parse reads a price target. Thousands separators may be "," "." spaces or
+// apostrophes; when a number has both "," and "." the last one is the decimal
+// mark, and a lone "," is a decimal mark unless it groups three digits.
+func Parse(raw string) (*Amount, error) {
+	s := strings.TrimSpace(raw)
+	if _, ok := placeholders[strings.ToLower(s)]; ok || s == "" {
+		return nil, ErrNoPrice
+	}
+
+	currency := ""
+	if m := isoPrefix.FindStringSubmatch(s); m != nil {
+		currency, s = m[1], m[2]
+	} else if m := isoSuffix.FindStringSubmatch(s); m != nil {
+		s, currency = m[1], m[2]
+	} else {
+		for _, cs := range currencySymbols {
+			if strings.HasPrefix(s, cs.symbol) {
+				currency, s = cs.code, strings.TrimPrefix(s, cs.symbol)
+				break
+			}
+			if strings.HasSuffix(s, cs.symbol) {
+				currency, s = cs.code, strings.TrimSuffix(s, cs.symbol)
+				break
+			}
+		}
+	}
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+
+	s = groupSpacings.Replace(strings.TrimSpace(s))
+	if !numeric.MatchString(s) {
+		return nil, fmt.Errorf("%w %q", ErrInvalidPrice, raw)
+	}
+
+	lastDot, lastComma := strings.LastIndex(s, "."), strings.LastIndex(s, ",")
+	switch {
+	case lastDot >= 0 && lastComma >= 0 && lastDot > lastComma:
+		s = strings.ReplaceAll(s, ",", "")
+	case lastDot >= 0 && lastComma >= 0:
+		s = strings.ReplaceAll(strings.ReplaceAll(s, ".", ""), ",", ".")
+	case commaGroups.MatchString(s):
+		s = strings.ReplaceAll(s, ",", "")
+	case commaDecimal.MatchString(s):
+		s = strings.ReplaceAll(s, ",", ".")
+	case lastComma >= 0:
+		return nil, fmt.Errorf("%w %q", ErrInvalidPrice, raw)
+	case dotGroups.MatchString(s):
+		s = strings.ReplaceAll(s, ".", "")
+	}
+
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || value >= maxValue {
+		return nil, fmt.Errorf("%w %q", ErrInvalidPrice, raw)
+	}
+	return &Amount{Value: value, Currency: currency}, nil
+}
+
+// Targets are the parsed price targets of a rating, which share a currency
+type Targets struct {
+	From *float64
+	To   *float64
+	// Currency is the ISO 4217 code of the parsed values
+	Currency string
+	// Mixed is set when the targets are prices in different currencies.
+	// Neither value is kept then, since they cannot be compared.
+	Mixed bool
+}
+
+// ParseTargets parses the from and to targets of a rating. A target that is
+// blank or not a price has no value.
+func ParseTargets(from, to string) Targets {
+	fromAmount, fromErr := Parse(from)
+	toAmount, toErr := Parse(to)
+	if fromErr == nil && toErr == nil && fromAmount.Currency != toAmount.Currency {
+		return Targets{Mixed: true}
+	}
+
+	var targets Targets
+	if fromErr == nil {
+		targets.From = &fromAmount.Value
+		targets.Currency = fromAmount.Currency
+	}
+	if toErr == nil {
+		targets.To = &toAmount.Value
+		targets.Currency = toAmount.Currency
+	}
+	return targets
+}
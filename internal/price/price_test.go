@@ -0,0 +1,93 @@
+package price
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		raw      string
+		value    float64
+		currency string
+		err      error
+	}{
+		{raw: "$1,234.56", value: 1234.56, currency: "USD"},
+		{raw: "€12", value: 12, currency: "EUR"},
+		{raw: "€12,50", value: 12.5, currency: "EUR"},
+		{raw: "12,345", value: 12345, currency: "USD"},
+		{raw: "1.234,5 €", value: 1234.5, currency: "EUR"},
+		{raw: "1.234.567", value: 1234567, currency: "USD"},
+		{raw: "1 234 USD", value: 1234, currency: "USD"},
+		{raw: "GBP 1'000", value: 1000, currency: "GBP"},
+		{raw: "US$5", value: 5, currency: "USD"},
+		{raw: "C$7.25", value: 7.25, currency: "CAD"},
+		{raw: " 42 ", value: 42, currency: "USD"},
+		{raw: "", err: ErrNoPrice},
+		{raw: "N/A", err: ErrNoPrice},
+		{raw: "--", err: ErrNoPrice},
+		{raw: "$10-$12", err: ErrInvalidPrice},
+		{raw: "10 - 12", err: ErrInvalidPrice},
+		{raw: "1,23,4", err: ErrInvalidPrice},
+		{raw: "twelve", err: ErrInvalidPrice},
+		{raw: "$", err: ErrInvalidPrice},
+		{raw: "99999999999", err: ErrInvalidPrice},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := Parse(tt.raw)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Parse(%q) error = %v, want %v", tt.raw, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.raw, err)
+			}
+			if got.Value != tt.value || got.Currency != tt.currency {
+				t.Errorf("Parse(%q) = %v %s, want %v %s", tt.raw, got.Value, got.Currency, tt.value, tt.currency)
+			}
+		})
+	}
+}
+
+func TestParseTargets(t *testing.T) {
+	value := func(v float64) *float64 { return &v }
+	tests := []struct {
+		name     string
+		from, to string
+		want     Targets
+	}{
+		{"same currency", "$10", "$12.50", Targets{From: value(10), To: value(12.5), Currency: "USD"}},
+		{"default currency", "10", "12 USD", Targets{From: value(10), To: value(12), Currency: "USD"}},
+		{"one price", "N/A", "€12", Targets{To: value(12), Currency: "EUR"}},
+		{"no prices", "", "-", Targets{}},
+		{"mixed currencies", "$10", "€12", Targets{Mixed: true}},
+		{"mixed with a code", "GBP 10", "10", Targets{Mixed: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseTargets(tt.from, tt.to)
+			if !sameValue(got.From, tt.want.From) || !sameValue(got.To, tt.want.To) ||
+				got.Currency != tt.want.Currency || got.Mixed != tt.want.Mixed {
+				t.Errorf("ParseTargets(%q, %q) = %s, want %s", tt.from, tt.to, format(got), format(tt.want))
+			}
+		})
+	}
+}
+
+func sameValue(a, b *float64) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+func format(t Targets) string {
+	value := func(v *float64) string {
+		if v == nil {
+			return "nil"
+		}
+		return fmt.Sprint(*v)
+	}
+	return fmt.Sprintf("{From: %s, To: %s, Currency: %q, Mixed: %v}", value(t.From), value(t.To), t.Currency, t.Mixed)
+}
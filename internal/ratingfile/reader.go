@@ -0,0 +1,294 @@
+package ratingfile
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/truora/microservice/internal/dto"
+)
+
+type Format string
+
+const (
+	FormatCSV    Format = "csv"
+	FormatNDJSON Format = "ndjson"
+)
+
+// ParseFormat validates a format name coming from config or a request
+func ParseFormat(name string) (Format, error) {
+	switch Format(strings.ToLower(name)) {
+	case FormatCSV:
+		return FormatCSV, nil
+	case FormatNDJSON:
+		return FormatNDJSON, nil
+	default:
+		return "", fmt.Errorf("unsupported rating file format %q (must be csv or ndjson)", name)
+	}
+}
+
+// ErrInvalidHeader is returned when a CSV file does not start with a usable
+// header. The file cannot be read any further.
+var ErrInvalidHeader = errors.New("invalid CSV header")
+
+// maxRecordSize bounds the length of an NDJSON record
+const maxRecordSize = 1024 * 1024
+
+// maxRawSize bounds the text kept of a record too long to decode
+const maxRawSize = 1024
+
+// RecordError reports a record that could not be decoded into a rating.
+// Reading can continue after it.
+type RecordError struct {
+	Line int
+	Err  error
+}
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+// Reader decodes ratings one record at a time so files of any size can be
+// processed in constant memory. Records failing dto validation are reported
+// as RecordErrors.
+type Reader interface {
+	// Next returns the next rating, io.EOF at the end of the input or a
+	// *RecordError for a malformed record
+	Next() (*dto.StockRatingResponse, error)
+	// Line is the line number where the last record returned by Next starts
+	Line() int
+	// Raw is the undecoded text of the last record returned by Next
+	Raw() string
+}
+
+func NewReader(r io.Reader, format Format) (Reader, error) {
+	switch format {
+	case FormatCSV:
+		feeder := &lineFeeder{reader: bufio.NewReader(r)}
+		csvReader := csv.NewReader(feeder)
+		csvReader.FieldsPerRecord = -1
+		csvReader.TrimLeadingSpace = true
+		return &csvRatingReader{reader: csvReader, feeder: feeder}, nil
+	case FormatNDJSON:
+		return &ndjsonRatingReader{reader: bufio.NewReader(r)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported rating file format %q", format)
+	}
+}
+
+// csvColumns are the header names a CSV file may use, matching the JSON
+// field names of dto.StockRatingResponse
+var csvColumns = []string{
+	"ticker", "target_from", "target_to", "company", "action",
+	"brokerage", "rating_from", "rating_to", "time",
+}
+
+// lineFeeder hands its input to the CSV parser one line per Read. The parser
+// never reads past the record it parses, so the lines fed since the last
+// reset are the raw text of that record, even when it fails to parse.
+type lineFeeder struct {
+	reader  *bufio.Reader
+	pending []byte
+	fed     []byte
+}
+
+func (f *lineFeeder) Read(p []byte) (int, error) {
+	if len(f.pending) == 0 {
+		// A line longer than the buffer is fed in parts
+		line, err := f.reader.ReadSlice('\n')
+		if len(line) == 0 {
+			return 0, err
+		}
+		f.pending = append([]byte(nil), line...)
+	}
+
+	n := copy(p, f.pending)
+	f.fed = append(f.fed, f.pending[:n]...)
+	f.pending = f.pending[n:]
+	return n, nil
+}
+
+// raw returns the text fed since the last call, without the final line break
+func (f *lineFeeder) raw() string {
+	raw := strings.TrimRight(string(f.fed), "\r\n")
+	f.fed = f.fed[:0]
+	return raw
+}
+
+type csvRatingReader struct {
+	reader  *csv.Reader
+	feeder  *lineFeeder
+	columns map[string]int
+	line    int
+	raw     string
+}
+
+func (r *csvRatingReader) Next() (*dto.StockRatingResponse, error) {
+	if r.columns == nil {
+		if err := r.readHeader(); err != nil {
+			return nil, err
+		}
+	}
+
+	record, err := r.reader.Read()
+	r.raw = r.feeder.raw()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			r.line = parseErr.StartLine
+			return nil, &RecordError{Line: r.line, Err: parseErr.Err}
+		}
+		return nil, err
+	}
+	r.line, _ = r.reader.FieldPos(0)
+
+	field := func(name string) string {
+		i, ok := r.columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	rating := &dto.StockRatingResponse{
+		Ticker:     field("ticker"),
+		TargetFrom: field("target_from"),
+		TargetTo:   field("target_to"),
+		Company:    field("company"),
+		Action:     field("action"),
+		Brokerage:  field("brokerage"),
+		RatingFrom: field("rating_from"),
+		RatingTo:   field("rating_to"),
+	}
+
+	if raw := field("time"); raw != "" {
+		parsed, err := time.Parse(time.RFC3339Nano, raw)
+		if err != nil {
+			return nil, &RecordError{Line: r.line, Err: fmt.Errorf("invalid time %q, expected RFC 3339", raw)}
+		}
+		rating.Time = parsed
+	}
+
+	if err := rating.Validate(); err != nil {
+		return nil, &RecordError{Line: r.line, Err: err}
+	}
+	return rating, nil
+}
+
+// readHeader reads the column names. A header that cannot be parsed or lacks
+// a required column is reported with ErrInvalidHeader.
+func (r *csvRatingReader) readHeader() error {
+	header, err := r.reader.Read()
+	r.feeder.raw()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return fmt.Errorf("%w: %v", ErrInvalidHeader, err)
+		}
+		if errors.Is(err, io.EOF) {
+			return err
+		}
+		return fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"ticker", "time"} {
+		if _, ok := columns[required]; !ok {
+			return fmt.Errorf("%w: missing the %q column (known columns: %s)", ErrInvalidHeader, required, strings.Join(csvColumns, ", "))
+		}
+	}
+
+	r.columns = columns
+	r.line = 1
+	return nil
+}
+
+func (r *csvRatingReader) Line() int {
+	return r.line
+}
+
+func (r *csvRatingReader) Raw() string {
+	return r.raw
+}
+
+type ndjsonRatingReader struct {
+	reader *bufio.Reader
+	line   int
+	raw    string
+}
+
+func (r *ndjsonRatingReader) Next() (*dto.StockRatingResponse, error) {
+	for {
+		text, tooLong, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		r.line++
+
+		r.raw = strings.TrimSpace(text)
+		if tooLong {
+			return nil, &RecordError{Line: r.line, Err: fmt.Errorf("record is longer than %d bytes", maxRecordSize)}
+		}
+		if r.raw == "" {
+			continue
+		}
+
+		var rating dto.StockRatingResponse
+		if err := json.Unmarshal([]byte(r.raw), &rating); err != nil {
+			return nil, &RecordError{Line: r.line, Err: fmt.Errorf("invalid JSON: %v", err)}
+		}
+		if err := rating.Validate(); err != nil {
+			return nil, &RecordError{Line: r.line, Err: err}
+		}
+		return &rating, nil
+	}
+}
+
+// readLine returns the next line, or io.EOF after the last one. A line over
+// maxRecordSize is consumed up to its end and reported as tooLong, keeping
+// only its first maxRawSize bytes, so reading resumes with the next line.
+func (r *ndjsonRatingReader) readLine() (string, bool, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := r.reader.ReadSlice('\n')
+		if !tooLong {
+			line = append(line, chunk...)
+			if len(line) > maxRecordSize {
+				tooLong = true
+				line = line[:maxRawSize]
+			}
+		}
+
+		switch {
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case errors.Is(err, io.EOF) && (len(line) > 0 || tooLong):
+			// The last line has no line break
+			return string(line), tooLong, nil
+		case err != nil:
+			return "", false, err
+		}
+		return string(line), tooLong, nil
+	}
+}
+
+func (r *ndjsonRatingReader) Line() int {
+	return r.line
+}
+
+func (r *ndjsonRatingReader) Raw() string {
+	return r.raw
+}
@@ -0,0 +1,105 @@
+package ratingfile
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// record is what Next returned for one record
+type record struct {
+	ticker string
+	line   int
+	raw    string
+	failed bool
+}
+
+func readAll(t *testing.T, input string, format Format) ([]record, error) {
+	t.Helper()
+	reader, err := NewReader(strings.NewReader(input), format)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var records []record
+	for {
+		rating, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		var recordErr *RecordError
+		switch {
+		case errors.As(err, &recordErr):
+			records = append(records, record{line: recordErr.Line, raw: reader.Raw(), failed: true})
+		case err != nil:
+			return records, err
+		default:
+			records = append(records, record{ticker: rating.Ticker, line: reader.Line(), raw: reader.Raw()})
+		}
+	}
+}
+
+func TestCSVHeaderErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"missing column", "ticker,company\nAAPL,Apple\n"},
+		{"malformed", "ticker,\"time\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readAll(t, tt.input, FormatCSV)
+			if !errors.Is(err, ErrInvalidHeader) {
+				t.Errorf("got %v, want ErrInvalidHeader", err)
+			}
+		})
+	}
+}
+
+func TestCSVRecordsKeepTheirRawText(t *testing.T) {
+	input := "ticker,company,time\n" +
+		"AAPL,\"Apple, Inc.\",2024-01-02T15:04:05Z\n" +
+		"MSFT,Micro\"soft,2024-01-02T15:04:05Z\n" +
+		"\"GOOG\",\"Alphabet\nClass A\",2024-01-02T15:04:05Z\n"
+
+	records, err := readAll(t, input, FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []record{
+		{ticker: "AAPL", line: 2, raw: `AAPL,"Apple, Inc.",2024-01-02T15:04:05Z`},
+		{line: 3, raw: `MSFT,Micro"soft,2024-01-02T15:04:05Z`, failed: true},
+		{ticker: "GOOG", line: 4, raw: "\"GOOG\",\"Alphabet\nClass A\",2024-01-02T15:04:05Z"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got %+v, want %+v", records, want)
+	}
+	for i := range want {
+		if records[i] != want[i] {
+			t.Errorf("record %d: got %+v, want %+v", i, records[i], want[i])
+		}
+	}
+}
+
+func TestNDJSONRejectsTooLongRecordAndContinues(t *testing.T) {
+	long := `{"ticker":"AAPL","company":"` + strings.Repeat("x", maxRecordSize) + `"}`
+	input := `{"ticker":"MSFT","time":"2024-01-02T15:04:05Z"}` + "\n" +
+		long + "\n" +
+		`{"ticker":"GOOG","time":"2024-01-02T15:04:05Z"}`
+
+	records, err := readAll(t, input, FormatNDJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want 3", len(records))
+	}
+	if records[0].ticker != "MSFT" || records[2].ticker != "GOOG" || records[2].line != 3 {
+		t.Errorf("records around the long line were misread: %+v, %+v", records[0], records[2])
+	}
+	if !records[1].failed || records[1].line != 2 || records[1].raw != long[:maxRawSize] {
+		t.Errorf("long line was not rejected with its prefix: line %d, failed %v", records[1].line, records[1].failed)
+	}
+}
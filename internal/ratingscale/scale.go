@@ -0,0 +1,105 @@
+// Package ratingscale maps the free-form ratings published by brokerages to
+// the canonical domain.RatingLevel scale.
+package ratingscale
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/truora/microservice/internal/domain"
+)
+
+// defaultMapping covers the ratings used by the major brokerages. Values are
+// compared by Key, so case, dashes and underscores do not matter.
+var defaultMapping = map[domain.RatingLevel][]string{
+	domain.RatingLevelStrongBuy: {
+		"strong buy", "conviction buy", "top pick", "strong outperform",
+	},
+	domain.RatingLevelBuy: {
+		"buy", "outperform", "overweight", "positive", "accumulate", "add",
+		"market outperform", "sector outperform", "outperformer", "moderate buy",
+		"speculative buy", "long term buy", "buy neutral",
+	},
+	domain.RatingLevelHold: {
+		"hold", "neutral", "equal weight", "market perform", "sector perform",
+		"peer perform", "in line", "inline", "sector weight", "perform",
+		"mixed", "fair value", "market weight", "cautious",
+	},
+	domain.RatingLevelSell: {
+		"sell", "underperform", "underweight", "negative", "reduce",
+		"market underperform", "sector underperform", "moderate sell",
+		"underperformer", "weak hold",
+	},
+	domain.RatingLevelStrongSell: {
+		"strong sell", "conviction sell",
+	},
+}
+
+var separators = regexp.MustCompile(`[\s_-]+`)
+
+// Key normalizes a raw rating for lookups: lower case, trimmed, with runs of
+// spaces, dashes and underscores collapsed into one space
+func Key(raw string) string {
+	return separators.ReplaceAllString(strings.ToLower(strings.TrimSpace(raw)), " ")
+}
+
+// KeySQL is the SQL equivalent of Key for the column or expression %s
+const KeySQL = `btrim(regexp_replace(lower(%s), '[[:space:]_-]+', ' ', 'g'))`
+
+// Scale maps raw ratings to levels
+type Scale struct {
+	levels map[string]domain.RatingLevel
+}
+
+// New builds the default mapping extended with extra raw values per level.
+// An extra value overrides the default level of the same value.
+func New(extra map[string][]string) (*Scale, error) {
+	scale := &Scale{levels: make(map[string]domain.RatingLevel)}
+	for level, values := range defaultMapping {
+		for _, value := range values {
+			scale.levels[Key(value)] = level
+		}
+	}
+
+	for name, values := range extra {
+		level := domain.RatingLevel(name)
+		if level.Score() == 0 {
+			return nil, fmt.Errorf("unknown rating level %q (must be one of strong_sell, sell, hold, buy, strong_buy)", name)
+		}
+		for _, value := range values {
+			scale.levels[Key(value)] = level
+		}
+	}
+	return scale, nil
+}
+
+// Normalize returns the level of a raw rating and whether it is mapped
+func (s *Scale) Normalize(raw string) (domain.RatingLevel, bool) {
+	level, ok := s.levels[Key(raw)]
+	return level, ok
+}
+
+// Apply stores the levels and scores of both ratings of r next to the raw values
+func (s *Scale) Apply(r *domain.StockRating) {
+	r.RatingFromNormalized, r.RatingFromScore = s.normalized(r.RatingFrom)
+	r.RatingToNormalized, r.RatingToScore = s.normalized(r.RatingTo)
+}
+
+func (s *Scale) normalized(raw string) (domain.RatingLevel, *int) {
+	level, ok := s.Normalize(raw)
+	if !ok {
+		return "", nil
+	}
+	score := level.Score()
+	return level, &score
+}
+
+// Mapping returns every mapped key with its level
+func (s *Scale) Mapping() map[string]domain.RatingLevel {
+	mapping := make(map[string]domain.RatingLevel, len(s.levels))
+	for key, level := range s.levels {
+		mapping[key] = level
+	}
+	return mapping
+}
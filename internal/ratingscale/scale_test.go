@@ -0,0 +1,71 @@
+package ratingscale
+
+import (
+	"testing"
+
+	"github.com/truora/microservice/internal/domain"
+)
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"Buy", "buy"},
+		{"  STRONG BUY ", "strong buy"},
+		{"Strong-Buy", "strong buy"},
+		{"strong_buy", "strong buy"},
+		{"Market  Outperform", "market outperform"},
+		{"equal-_ weight", "equal weight"},
+		{"In-Line", "in line"},
+		{"\tsector\nperform", "sector perform"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			if got := Key(tt.raw); got != tt.want {
+				t.Errorf("Key(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	scale, err := New(map[string][]string{
+		"strong_buy": {"Top-Pick Plus"},
+		"hold":       {"Outperform"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		raw   string
+		want  domain.RatingLevel
+		found bool
+	}{
+		{"Strong-Buy", domain.RatingLevelStrongBuy, true},
+		{"OVERWEIGHT", domain.RatingLevelBuy, true},
+		{"equal_weight", domain.RatingLevelHold, true},
+		{"Sector Under-perform", "", false},
+		{"sector_underperform", domain.RatingLevelSell, true},
+		{"top pick plus", domain.RatingLevelStrongBuy, true},
+		// An extra value overrides its default level
+		{"outperform", domain.RatingLevelHold, true},
+		{"Speculative", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, found := scale.Normalize(tt.raw)
+			if got != tt.want || found != tt.found {
+				t.Errorf("Normalize(%q) = %q, %v, want %q, %v", tt.raw, got, found, tt.want, tt.found)
+			}
+		})
+	}
+}
+
+func TestNewRejectsUnknownLevels(t *testing.T) {
+	if _, err := New(map[string][]string{"very_strong_buy": {"moon"}}); err == nil {
+		t.Error("New accepted an unknown rating level")
+	}
+}
@@ -0,0 +1,295 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/truora/microservice/internal/domain"
+	"github.com/truora/microservice/internal/dto"
+)
+
+type BrokerageRepository interface {
+	List(ctx context.Context) ([]*dto.BrokerageSummary, error)
+	GetByID(ctx context.Context, id uint) (*domain.Brokerage, error)
+	// GetAliases returns the aliases of the given brokerages, or of all of
+	// them when no ID is given
+	GetAliases(ctx context.Context, brokerageIDs ...uint) ([]*domain.BrokerageAlias, error)
+	GetCoverage(ctx context.Context, id uint) ([]*dto.BrokerageCoverage, error)
+	GetActivity(ctx context.Context, id uint, recentSince time.Time) (*dto.BrokerageActivity, error)
+	GetRecentRatings(ctx context.Context, id uint, limit int) ([]*domain.StockRating, error)
+	// Seed makes name a brokerage and points the keys of name and aliases at it
+	Seed(ctx context.Context, name string, aliases []string) error
+	// Relink points every rating at the brokerage its name resolves to and
+	// removes brokerages left without aliases. It returns the ratings changed.
+	Relink(ctx context.Context) (int64, error)
+}
+
+type brokerageRepository struct {
+	db *gorm.DB
+}
+
+func NewBrokerageRepository(db *gorm.DB) BrokerageRepository {
+	return &brokerageRepository{db: db}
+}
+
+func (r *brokerageRepository) List(ctx context.Context) ([]*dto.BrokerageSummary, error) {
+	var brokerages []*dto.BrokerageSummary
+	result := r.db.WithContext(ctx).Raw(`
+		SELECT b.id, b.name, COUNT(s.id) AS rating_count,
+			COUNT(DISTINCT s.ticker) AS ticker_count, MAX(s.time) AS last_rating_at
+		FROM brokerages b
+		LEFT JOIN stock_ratings s ON s.brokerage_id = b.id
+		GROUP BY b.id, b.name
+		ORDER BY b.name`).
+		Scan(&brokerages)
+	return brokerages, result.Error
+}
+
+func (r *brokerageRepository) GetByID(ctx context.Context, id uint) (*domain.Brokerage, error) {
+	var brokerage domain.Brokerage
+	result := r.db.WithContext(ctx).First(&brokerage, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return &brokerage, nil
+}
+
+func (r *brokerageRepository) GetAliases(ctx context.Context, brokerageIDs ...uint) ([]*domain.BrokerageAlias, error) {
+	query := r.db.WithContext(ctx).Order("alias ASC")
+	if len(brokerageIDs) > 0 {
+		query = query.Where("brokerage_id IN ?", brokerageIDs)
+	}
+
+	var aliases []*domain.BrokerageAlias
+	result := query.Find(&aliases)
+	return aliases, result.Error
+}
+
+// GetCoverage returns the latest rating of the brokerage on each ticker it rated
+func (r *brokerageRepository) GetCoverage(ctx context.Context, id uint) ([]*dto.BrokerageCoverage, error) {
+	var coverage []*dto.BrokerageCoverage
+	result := r.db.WithContext(ctx).Raw(`
+		SELECT DISTINCT ON (ticker) ticker, company,
+			COUNT(*) OVER (PARTITION BY ticker) AS rating_count,
+			rating_to AS latest_rating, rating_to_normalized AS latest_rating_normalized,
+			target_to AS latest_target, time AS last_rating_at
+		FROM stock_ratings
+		WHERE brokerage_id = ?
+		ORDER BY ticker, time DESC, id DESC`, id).
+		Scan(&coverage)
+	return coverage, result.Error
+}
+
+func (r *brokerageRepository) GetActivity(ctx context.Context, id uint, recentSince time.Time) (*dto.BrokerageActivity, error) {
+	activity := &dto.BrokerageActivity{ByActionType: make(map[string]int64)}
+	db := r.db.WithContext(ctx)
+	if err := db.Raw(`
+		SELECT COUNT(*) AS rating_count, COUNT(*) FILTER (WHERE time >= ?) AS last30_days,
+			MIN(time) AS first_rating_at, MAX(time) AS last_rating_at
+		FROM stock_ratings
+		WHERE brokerage_id = ?`, recentSince, id).
+		Scan(activity).Error; err != nil {
+		return nil, err
+	}
+
+	var counts []struct {
+		ActionType string
+		Count      int64
+	}
+	if err := db.Raw(`
+		SELECT action_type, COUNT(*) AS count
+		FROM stock_ratings
+		WHERE brokerage_id = ?
+		GROUP BY action_type`, id).
+		Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	for _, count := range counts {
+		actionType := count.ActionType
+		if actionType == "" {
+			actionType = "other"
+		}
+		activity.ByActionType[actionType] = count.Count
+	}
+	return activity, nil
+}
+
+func (r *brokerageRepository) GetRecentRatings(ctx context.Context, id uint, limit int) ([]*domain.StockRating, error) {
+	var ratings []*domain.StockRating
+	result := r.db.WithContext(ctx).
+		Where("brokerage_id = ?", id).
+		Order("time DESC, id DESC").
+		Limit(limit).
+		Find(&ratings)
+	return ratings, result.Error
+}
+
+func (r *brokerageRepository) Seed(ctx context.Context, name string, aliases []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`
+			INSERT INTO brokerages (name, created_at, updated_at) VALUES (?, NOW(), NOW())
+			ON CONFLICT (name) DO NOTHING`, name).Error; err != nil {
+			return err
+		}
+
+		var brokerage domain.Brokerage
+		if err := tx.Where("name = ?", name).First(&brokerage).Error; err != nil {
+			return err
+		}
+
+		for _, alias := range append([]string{name}, aliases...) {
+			key := domain.BrokerageKey(alias)
+			if key == "" {
+				continue
+			}
+			if err := tx.Exec(`
+				INSERT INTO brokerage_aliases (alias_key, alias, brokerage_id, created_at) VALUES (?, ?, ?, NOW())
+				ON CONFLICT (alias_key) DO UPDATE SET brokerage_id = EXCLUDED.brokerage_id, alias = EXCLUDED.alias
+				WHERE brokerage_aliases.brokerage_id <> EXCLUDED.brokerage_id`,
+				key, alias, brokerage.ID).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *brokerageRepository) Relink(ctx context.Context) (int64, error) {
+	var updated int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var names []string
+		if err := tx.Raw(`SELECT DISTINCT brokerage FROM stock_ratings WHERE brokerage <> ''`).
+			Scan(&names).Error; err != nil {
+			return err
+		}
+
+		ids, err := brokerageIDs(tx, names)
+		if err != nil {
+			return err
+		}
+
+		rows := make([]string, 0, len(names))
+		args := make([]interface{}, 0, len(names)*2)
+		for _, name := range names {
+			if id, ok := ids[domain.BrokerageKey(name)]; ok {
+				rows = append(rows, "(?::text, ?::bigint)")
+				args = append(args, name, id)
+			}
+		}
+		if len(rows) > 0 {
+			result := tx.Exec(`
+				UPDATE stock_ratings s SET brokerage_id = m.id, updated_at = NOW()
+				FROM (VALUES `+strings.Join(rows, ", ")+`) AS m(name, id)
+				WHERE s.brokerage = m.name AND s.brokerage_id IS DISTINCT FROM m.id`, args...)
+			if result.Error != nil {
+				return result.Error
+			}
+			updated = result.RowsAffected
+		}
+
+		// Brokerages whose aliases were all claimed by another brokerage
+		return tx.Exec(`
+			DELETE FROM brokerages b
+			WHERE NOT EXISTS (SELECT 1 FROM brokerage_aliases a WHERE a.brokerage_id = b.id)`).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
+
+// resolveBrokerages links ratings to the brokerages of their names, creating
+// a brokerage for every name whose key has no alias yet
+func resolveBrokerages(tx *gorm.DB, ratings []*domain.StockRating) error {
+	names := make([]string, 0, len(ratings))
+	for _, rating := range ratings {
+		names = append(names, rating.Brokerage)
+	}
+
+	ids, err := brokerageIDs(tx, names)
+	if err != nil {
+		return err
+	}
+	for _, rating := range ratings {
+		if id, ok := ids[domain.BrokerageKey(rating.Brokerage)]; ok {
+			rating.BrokerageID = &id
+		}
+	}
+	return nil
+}
+
+// brokerageIDs returns the brokerage of each name by key. A name with an
+// unknown key becomes a brokerage of its own; concurrent writers resolving
+// the same key settle on whichever alias is stored first.
+func brokerageIDs(tx *gorm.DB, names []string) (map[string]uint, error) {
+	firstNames := make(map[string]string)
+	for _, name := range names {
+		if key := domain.BrokerageKey(name); key != "" {
+			if _, ok := firstNames[key]; !ok {
+				firstNames[key] = name
+			}
+		}
+	}
+
+	ids := make(map[string]uint, len(firstNames))
+	if len(firstNames) == 0 {
+		return ids, nil
+	}
+	keys := make([]string, 0, len(firstNames))
+	for key := range firstNames {
+		keys = append(keys, key)
+	}
+	if err := loadAliasIDs(tx, keys, ids); err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, key := range keys {
+		if _, ok := ids[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) == 0 {
+		return ids, nil
+	}
+
+	// A fixed order keeps concurrent writers from deadlocking
+	sort.Strings(missing)
+	for _, key := range missing {
+		name := firstNames[key]
+		if err := tx.Exec(`
+			INSERT INTO brokerages (name, created_at, updated_at) VALUES (?, NOW(), NOW())
+			ON CONFLICT (name) DO NOTHING`, name).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Exec(`
+			INSERT INTO brokerage_aliases (alias_key, alias, brokerage_id, created_at)
+			SELECT ?, ?, id, NOW() FROM brokerages WHERE name = ?
+			ON CONFLICT (alias_key) DO NOTHING`, key, name, name).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := loadAliasIDs(tx, missing, ids); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func loadAliasIDs(tx *gorm.DB, keys []string, ids map[string]uint) error {
+	var aliases []*domain.BrokerageAlias
+	if err := tx.Where("alias_key IN ?", keys).Find(&aliases).Error; err != nil {
+		return err
+	}
+	for _, alias := range aliases {
+		ids[alias.AliasKey] = alias.BrokerageID
+	}
+	return nil
+}
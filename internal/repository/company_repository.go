@@ -0,0 +1,398 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/truora/microservice/internal/domain"
+	"github.com/truora/microservice/internal/dto"
+)
+
+type CompanyRepository interface {
+	List(ctx context.Context, offset, limit int) ([]*dto.CompanySummary, error)
+	Count(ctx context.Context) (int64, error)
+	GetByTicker(ctx context.Context, ticker string) (*domain.Company, error)
+	GetNameHistory(ctx context.Context, ticker string) ([]*domain.CompanyName, error)
+	GetStats(ctx context.Context, ticker string, recentSince time.Time) (*dto.CompanyRatingStats, error)
+	GetConsensus(ctx context.Context, ticker string) (*dto.CompanyConsensus, error)
+	// Search finds companies whose ticker or name, current or former, matches
+	// query by prefix or trigram similarity. exactTicker is the query read as
+	// a ticker. Matches rank by quality, boosted by the ratings since
+	// recentSince.
+	Search(ctx context.Context, query, exactTicker string, recentSince time.Time, limit int) ([]*dto.SearchResult, error)
+	// Autocomplete suggests companies whose ticker or a word of whose name
+	// starts with prefix, exact and ticker matches first
+	Autocomplete(ctx context.Context, prefix, exactTicker string, limit int) ([]*dto.AutocompleteSuggestion, error)
+	// Seed makes ticker a company, setting its exchange when one is given
+	Seed(ctx context.Context, ticker, exchange string) error
+	// GetRatedTickers returns every distinct ticker of the stored ratings
+	GetRatedTickers(ctx context.Context) ([]string, error)
+	// RenameTicker moves the ratings of from to ticker to, dropping those
+	// already stored under to. It returns the ratings moved.
+	RenameTicker(ctx context.Context, from, to string) (int64, error)
+	// Backfill registers the companies and names of the stored ratings
+	Backfill(ctx context.Context) error
+	// Delete removes companies along with their name history
+	Delete(ctx context.Context, tickers []string) error
+}
+
+type companyRepository struct {
+	db *gorm.DB
+}
+
+func NewCompanyRepository(db *gorm.DB) CompanyRepository {
+	return &companyRepository{db: db}
+}
+
+func (r *companyRepository) List(ctx context.Context, offset, limit int) ([]*dto.CompanySummary, error) {
+	var companies []*dto.CompanySummary
+	result := r.db.WithContext(ctx).Raw(`
+		SELECT c.ticker, c.name, c.exchange, COUNT(s.id) AS rating_count, MAX(s.time) AS last_rating_at
+		FROM (SELECT * FROM companies ORDER BY ticker LIMIT ? OFFSET ?) c
+		LEFT JOIN stock_ratings s ON s.ticker = c.ticker
+		GROUP BY c.ticker, c.name, c.exchange
+		ORDER BY c.ticker`, limit, offset).
+		Scan(&companies)
+	return companies, result.Error
+}
+
+func (r *companyRepository) Count(ctx context.Context) (int64, error) {
+	var count int64
+	result := r.db.WithContext(ctx).Model(&domain.Company{}).Count(&count)
+	return count, result.Error
+}
+
+func (r *companyRepository) GetByTicker(ctx context.Context, ticker string) (*domain.Company, error) {
+	var company domain.Company
+	result := r.db.WithContext(ctx).First(&company, "ticker = ?", ticker)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return &company, nil
+}
+
+func (r *companyRepository) GetNameHistory(ctx context.Context, ticker string) ([]*domain.CompanyName, error) {
+	var names []*domain.CompanyName
+	result := r.db.WithContext(ctx).
+		Where("ticker = ?", ticker).
+		Order("last_seen_at DESC").
+		Find(&names)
+	return names, result.Error
+}
+
+func (r *companyRepository) GetStats(ctx context.Context, ticker string, recentSince time.Time) (*dto.CompanyRatingStats, error) {
+	stats := &dto.CompanyRatingStats{ByActionType: make(map[string]int64)}
+	db := r.db.WithContext(ctx)
+	if err := db.Raw(`
+		SELECT COUNT(*) AS rating_count,
+			COUNT(DISTINCT COALESCE(brokerage_id::text, brokerage)) AS brokerage_count,
+			COUNT(*) FILTER (WHERE time >= ?) AS last30_days,
+			MIN(time) AS first_rating_at, MAX(time) AS last_rating_at
+		FROM stock_ratings
+		WHERE ticker = ?`, recentSince, ticker).
+		Scan(stats).Error; err != nil {
+		return nil, err
+	}
+
+	var counts []struct {
+		ActionType string
+		Count      int64
+	}
+	if err := db.Raw(`
+		SELECT action_type, COUNT(*) AS count
+		FROM stock_ratings
+		WHERE ticker = ?
+		GROUP BY action_type`, ticker).
+		Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	for _, count := range counts {
+		actionType := count.ActionType
+		if actionType == "" {
+			actionType = "other"
+		}
+		stats.ByActionType[actionType] = count.Count
+	}
+	return stats, nil
+}
+
+// GetConsensus takes the latest rating of every brokerage, identified by its
+// brokerage ID or, for unlinked ratings, its name
+func (r *companyRepository) GetConsensus(ctx context.Context, ticker string) (*dto.CompanyConsensus, error) {
+	var latest []struct {
+		Level domain.RatingLevel
+		Score *int
+	}
+	if err := r.db.WithContext(ctx).Raw(`
+		SELECT DISTINCT ON (COALESCE(brokerage_id::text, brokerage))
+			rating_to_normalized AS level, rating_to_score AS score
+		FROM stock_ratings
+		WHERE ticker = ?
+		ORDER BY COALESCE(brokerage_id::text, brokerage), time DESC, id DESC`, ticker).
+		Scan(&latest).Error; err != nil {
+		return nil, err
+	}
+
+	consensus := &dto.CompanyConsensus{
+		BrokerageCount: int64(len(latest)),
+		Ratings:        make(map[domain.RatingLevel]int64),
+	}
+	total, scored := 0, 0
+	for _, rating := range latest {
+		if rating.Score == nil {
+			continue
+		}
+		consensus.Ratings[rating.Level]++
+		total += *rating.Score
+		scored++
+	}
+	if scored > 0 {
+		average := float64(total) / float64(scored)
+		consensus.AverageScore = &average
+	}
+	return consensus, nil
+}
+
+// Search gathers candidates from each kind of match, all served by the
+// trigram indexes, keeps the best match of each company and only then counts
+// recent ratings. Former names score a little below current ones.
+func (r *companyRepository) Search(ctx context.Context, query, exactTicker string, recentSince time.Time, limit int) ([]*dto.SearchResult, error) {
+	tickerPrefix := likePrefix(exactTicker)
+	namePrefix := likePrefix(query)
+
+	var results []*dto.SearchResult
+	result := r.db.WithContext(ctx).Raw(`
+		WITH candidates AS (
+			SELECT ticker, 1.0::float8 AS quality, '' AS matched_name FROM companies WHERE ticker = ?
+			UNION ALL
+			SELECT ticker, 0.9::float8, '' FROM companies WHERE ticker LIKE ?
+			UNION ALL
+			SELECT ticker, 0.8::float8, '' FROM companies WHERE name ILIKE ?
+			UNION ALL
+			SELECT ticker, 0.7::float8, name FROM company_names WHERE name ILIKE ?
+			UNION ALL
+			SELECT ticker, similarity(ticker, ?)::float8, '' FROM companies WHERE ticker % ?
+			UNION ALL
+			SELECT ticker, word_similarity(?, name)::float8, '' FROM companies WHERE ? <% name
+			UNION ALL
+			SELECT ticker, 0.9 * word_similarity(?, name)::float8, name FROM company_names WHERE ? <% name
+		), best AS (
+			SELECT DISTINCT ON (ticker) ticker, quality, matched_name
+			FROM candidates
+			ORDER BY ticker, quality DESC, matched_name
+		)
+		SELECT c.ticker, c.name, c.exchange, NULLIF(NULLIF(b.matched_name, ''), c.name) AS matched_name,
+			b.quality AS match_score, COUNT(s.id) AS recent_ratings, MAX(s.time) AS last_rating_at
+		FROM best b
+		JOIN companies c ON c.ticker = b.ticker
+		LEFT JOIN stock_ratings s ON s.ticker = b.ticker AND s.time >= ?
+		GROUP BY c.ticker, c.name, c.exchange, b.matched_name, b.quality
+		ORDER BY b.quality + 0.05 * LOG(1 + COUNT(s.id)) DESC, c.ticker
+		LIMIT ?`,
+		exactTicker, tickerPrefix, namePrefix, namePrefix,
+		exactTicker, exactTicker, query, query, query, query,
+		recentSince, limit).
+		Scan(&results)
+	return results, result.Error
+}
+
+func (r *companyRepository) Autocomplete(ctx context.Context, prefix, exactTicker string, limit int) ([]*dto.AutocompleteSuggestion, error) {
+	namePrefix := likePrefix(prefix)
+
+	var suggestions []*dto.AutocompleteSuggestion
+	result := r.db.WithContext(ctx).Raw(`
+		SELECT ticker, name FROM companies
+		WHERE ticker = ? OR ticker LIKE ? OR name ILIKE ? OR name ILIKE ?
+		ORDER BY CASE WHEN ticker = ? THEN 0 WHEN ticker LIKE ? THEN 1 ELSE 2 END, length(ticker), ticker
+		LIMIT ?`,
+		exactTicker, likePrefix(exactTicker), namePrefix, "% "+namePrefix,
+		exactTicker, likePrefix(exactTicker), limit).
+		Scan(&suggestions)
+	return suggestions, result.Error
+}
+
+// likeEscaper escapes the LIKE wildcards and their escape character
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// likePrefix returns a LIKE pattern matching values starting with s
+func likePrefix(s string) string {
+	return likeEscaper.Replace(s) + "%"
+}
+
+func (r *companyRepository) Seed(ctx context.Context, ticker, exchange string) error {
+	return r.db.WithContext(ctx).Exec(`
+		INSERT INTO companies (ticker, name, exchange, created_at, updated_at) VALUES (?, '', ?, NOW(), NOW())
+		ON CONFLICT (ticker) DO UPDATE SET exchange = EXCLUDED.exchange, updated_at = NOW()
+		WHERE EXCLUDED.exchange <> '' AND companies.exchange <> EXCLUDED.exchange`,
+		ticker, exchange).Error
+}
+
+func (r *companyRepository) GetRatedTickers(ctx context.Context) ([]string, error) {
+	var tickers []string
+	result := r.db.WithContext(ctx).Raw(`SELECT DISTINCT ticker FROM stock_ratings`).Scan(&tickers)
+	return tickers, result.Error
+}
+
+func (r *companyRepository) RenameTicker(ctx context.Context, from, to string) (int64, error) {
+	var moved int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`
+			DELETE FROM stock_ratings a
+			USING stock_ratings b
+			WHERE a.ticker = ? AND b.ticker = ?
+				AND a.brokerage = b.brokerage
+				AND a.time IS NOT DISTINCT FROM b.time
+				AND a.action = b.action
+				AND a.rating_from = b.rating_from
+				AND a.rating_to = b.rating_to
+				AND a.target_from = b.target_from
+				AND a.target_to = b.target_to`, from, to).Error; err != nil {
+			return err
+		}
+
+		result := tx.Model(&domain.StockRating{}).
+			Where("ticker = ?", from).
+			Updates(map[string]interface{}{
+				"ticker":     to,
+				"updated_at": time.Now(),
+			})
+		moved = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return moved, nil
+}
+
+// Backfill keeps the earliest and latest use of each name, so it can run
+// again without losing history
+func (r *companyRepository) Backfill(ctx context.Context) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`
+			INSERT INTO companies (ticker, name, exchange, created_at, updated_at)
+			SELECT DISTINCT ticker, '', '', NOW(), NOW() FROM stock_ratings
+			ON CONFLICT (ticker) DO NOTHING`).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Exec(`
+			INSERT INTO company_names (ticker, name, first_seen_at, last_seen_at)
+			SELECT ticker, company, MIN(time), MAX(time)
+			FROM stock_ratings
+			WHERE company <> ''
+			GROUP BY ticker, company
+			ON CONFLICT (ticker, name) DO UPDATE SET
+				first_seen_at = LEAST(company_names.first_seen_at, EXCLUDED.first_seen_at),
+				last_seen_at = GREATEST(company_names.last_seen_at, EXCLUDED.last_seen_at)`).Error; err != nil {
+			return err
+		}
+
+		return refreshCompanyNames(tx, nil)
+	})
+}
+
+func (r *companyRepository) Delete(ctx context.Context, tickers []string) error {
+	if len(tickers) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Where("ticker IN ?", tickers).Delete(&domain.Company{}).Error
+}
+
+// upsertCompanies registers the companies of ratings and the names they were
+// rated under
+func upsertCompanies(tx *gorm.DB, ratings []*domain.StockRating) error {
+	names := make(map[[2]string]*domain.CompanyName)
+	seen := make(map[string]struct{})
+	var companies []*domain.Company
+	for _, rating := range ratings {
+		if _, ok := seen[rating.Ticker]; !ok {
+			seen[rating.Ticker] = struct{}{}
+			companies = append(companies, &domain.Company{Ticker: rating.Ticker})
+		}
+		if rating.Company == "" || rating.Time.IsZero() {
+			continue
+		}
+
+		key := [2]string{rating.Ticker, rating.Company}
+		name, ok := names[key]
+		if !ok {
+			names[key] = &domain.CompanyName{
+				Ticker:      rating.Ticker,
+				Name:        rating.Company,
+				FirstSeenAt: rating.Time,
+				LastSeenAt:  rating.Time,
+			}
+			continue
+		}
+		if rating.Time.Before(name.FirstSeenAt) {
+			name.FirstSeenAt = rating.Time
+		}
+		if rating.Time.After(name.LastSeenAt) {
+			name.LastSeenAt = rating.Time
+		}
+	}
+	if len(companies) == 0 {
+		return nil
+	}
+
+	// A fixed order keeps concurrent writers from deadlocking
+	sort.Slice(companies, func(i, j int) bool { return companies[i].Ticker < companies[j].Ticker })
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&companies).Error; err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	history := make([]*domain.CompanyName, 0, len(names))
+	tickers := make([]string, 0, len(companies))
+	for _, name := range names {
+		history = append(history, name)
+	}
+	sort.Slice(history, func(i, j int) bool {
+		if history[i].Ticker != history[j].Ticker {
+			return history[i].Ticker < history[j].Ticker
+		}
+		return history[i].Name < history[j].Name
+	})
+	for _, company := range companies {
+		tickers = append(tickers, company.Ticker)
+	}
+
+	if err := tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "ticker"}, {Name: "name"}},
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "first_seen_at"}, Value: gorm.Expr("LEAST(company_names.first_seen_at, EXCLUDED.first_seen_at)")},
+			{Column: clause.Column{Name: "last_seen_at"}, Value: gorm.Expr("GREATEST(company_names.last_seen_at, EXCLUDED.last_seen_at)")},
+		},
+	}).Create(&history).Error; err != nil {
+		return err
+	}
+	return refreshCompanyNames(tx, tickers)
+}
+
+// refreshCompanyNames sets the name of companies to the name they were last
+// rated under, for the given tickers or every company when tickers is nil
+func refreshCompanyNames(tx *gorm.DB, tickers []string) error {
+	filter, args := "", []interface{}{}
+	if tickers != nil {
+		filter, args = "WHERE ticker IN ?", []interface{}{tickers}
+	}
+	return tx.Exec(`
+		UPDATE companies c SET name = n.name, updated_at = NOW()
+		FROM (
+			SELECT DISTINCT ON (ticker) ticker, name FROM company_names `+filter+`
+			ORDER BY ticker, last_seen_at DESC
+		) n
+		WHERE c.ticker = n.ticker AND c.name <> n.name`, args...).Error
+}
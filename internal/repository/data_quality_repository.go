@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/truora/microservice/internal/domain"
+)
+
+type DataQualityRepository interface {
+	// Check counts the ratings breaking rule as of asOf and samples the IDs
+	// of the most recent ones
+	Check(ctx context.Context, rule domain.DataQualityRule, asOf time.Time, sampleSize int) (*domain.DataQualityFinding, error)
+	SaveFinding(ctx context.Context, finding *domain.DataQualityFinding) error
+	GetFindings(ctx context.Context, jobID uuid.UUID) ([]*domain.DataQualityFinding, error)
+}
+
+// dataQualityChecks narrow a rating query to the ratings breaking each rule
+var dataQualityChecks = map[domain.DataQualityRule]func(query *gorm.DB, asOf time.Time) *gorm.DB{
+	domain.DataQualityEmptyTarget: func(query *gorm.DB, _ time.Time) *gorm.DB {
+		return query.Where("btrim(target_to) = ''")
+	},
+	domain.DataQualityFutureTimestamp: func(query *gorm.DB, asOf time.Time) *gorm.DB {
+		return query.Where("time > ?", asOf)
+	},
+	domain.DataQualityTargetDirectionMismatch: func(query *gorm.DB, _ time.Time) *gorm.DB {
+		return query.Where(
+			"(action_type = ? AND target_from_value > target_to_value) OR (action_type = ? AND target_from_value < target_to_value)",
+			domain.ActionTypeTargetRaise, domain.ActionTypeTargetLower)
+	},
+	domain.DataQualityUnknownRating: func(query *gorm.DB, _ time.Time) *gorm.DB {
+		return query.Where("(rating_from <> '' AND rating_from_normalized = '') OR (rating_to <> '' AND rating_to_normalized = '')")
+	},
+	domain.DataQualityUnclassifiedAction: func(query *gorm.DB, _ time.Time) *gorm.DB {
+		return query.Where("action <> '' AND action_type = ''")
+	},
+	domain.DataQualityMixedTargetCurrency: func(query *gorm.DB, _ time.Time) *gorm.DB {
+		return query.Where("target_currency_mixed")
+	},
+}
+
+type dataQualityRepository struct {
+	db *gorm.DB
+}
+
+func NewDataQualityRepository(db *gorm.DB) DataQualityRepository {
+	return &dataQualityRepository{db: db}
+}
+
+func (r *dataQualityRepository) Check(ctx context.Context, rule domain.DataQualityRule, asOf time.Time, sampleSize int) (*domain.DataQualityFinding, error) {
+	check, ok := dataQualityChecks[rule]
+	if !ok {
+		return nil, fmt.Errorf("unknown data quality rule %q", rule)
+	}
+
+	// The window count is the same on every row, so one query yields both
+	var rows []struct {
+		ID    uint
+		Total int64
+	}
+	query := r.db.WithContext(ctx).Model(&domain.StockRating{}).Select("id, COUNT(*) OVER () AS total")
+	if err := check(query, asOf).
+		Order("id DESC").
+		Limit(sampleSize).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	finding := &domain.DataQualityFinding{Rule: rule, SampleIDs: make([]uint, len(rows))}
+	for i, row := range rows {
+		finding.SampleIDs[i] = row.ID
+		finding.Count = row.Total
+	}
+	return finding, nil
+}
+
+// SaveFinding replaces the finding a resumed scan may have saved before
+func (r *dataQualityRepository) SaveFinding(ctx context.Context, finding *domain.DataQualityFinding) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "job_id"}, {Name: "rule"}},
+		DoUpdates: clause.AssignmentColumns([]string{"count", "sample_ids", "created_at"}),
+	}).Create(finding).Error
+}
+
+func (r *dataQualityRepository) GetFindings(ctx context.Context, jobID uuid.UUID) ([]*domain.DataQualityFinding, error) {
+	var findings []*domain.DataQualityFinding
+	result := r.db.WithContext(ctx).Where("job_id = ?", jobID).Find(&findings)
+	return findings, result.Error
+}
@@ -6,79 +6,122 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/truora/microservice/internal/dto"
+	"github.com/truora/microservice/internal/httpclient"
 )
 
+// ExternalAPIRepository is the rating source backed by the vendor list API
 type ExternalAPIRepository interface {
-	GetHello(ctx context.Context) ([]*dto.StockRatingResponse, error)
+	RatingSource
 }
 
 type externalAPIRepository struct {
+	name    string
 	baseURL string
-	timeout time.Duration
+	client  *httpclient.Client
 	token   string
 }
 
-func NewExternalAPIRepository(baseURL string, timeout time.Duration, token string) ExternalAPIRepository {
+func NewExternalAPIRepository(name, baseURL string, client *httpclient.Client, token string) ExternalAPIRepository {
 	return &externalAPIRepository{
+		name:    name,
 		baseURL: baseURL,
-		timeout: timeout,
+		client:  client,
 		token:   token,
 	}
 }
 
-func (r *externalAPIRepository) GetHello(ctx context.Context) ([]*dto.StockRatingResponse, error) {
-	var allItems []*dto.StockRatingResponse
-	nextPage := ""
+func (r *externalAPIRepository) Name() string {
+	return r.name
+}
 
-	for {
-		url := fmt.Sprintf("%s/production/swechallenge/list", r.baseURL)
-		if nextPage != "" {
-			url = fmt.Sprintf("%s?next_page=%s", url, nextPage)
-		}
+func (r *externalAPIRepository) Kind() string {
+	return "api"
+}
 
-		client := &http.Client{
-			Timeout: r.timeout,
-		}
+// ForEachPage walks the upstream list and hands every page to handle as soon
+// as it is downloaded. Paging stops at the first page that reaches ratings
+// older than since, which assumes the upstream lists ratings newest first.
+func (r *externalAPIRepository) ForEachPage(ctx context.Context, cursor string, since *time.Time, handle PageHandler) error {
+	nextPage := cursor
 
-		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	for {
+		response, err := r.fetchPage(ctx, nextPage)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create request: %w", err)
+			return err
 		}
 
-		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", r.token))
-
-		resp, err := client.Do(req)
-		if err != nil {
-			return nil, fmt.Errorf("failed to make request: %w", err)
+		reachedMark := false
+		page := &Page{
+			Items:    make([]*dto.StockRatingResponse, 0, len(response.Items)),
+			NextPage: response.NextPage,
 		}
-
-		if resp.StatusCode != http.StatusOK {
-			resp.Body.Close()
-			return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		for _, item := range response.Items {
+			if err := item.Validate(); err != nil {
+				raw, _ := json.Marshal(item)
+				page.Malformed = append(page.Malformed, &MalformedItem{Reason: err.Error(), Raw: string(raw)})
+				continue
+			}
+			if since != nil && item.Time.Before(*since) {
+				reachedMark = true
+				page.Skipped++
+				continue
+			}
+			page.Items = append(page.Items, item)
 		}
 
-		body, err := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		if err != nil {
-			return nil, fmt.Errorf("failed to read response body: %w", err)
+		if reachedMark {
+			page.NextPage = ""
 		}
 
-		var response dto.Response
-		if err := json.Unmarshal(body, &response); err != nil {
-			return nil, fmt.Errorf("failed to parse response: %w", err)
+		if err := handle(page); err != nil {
+			return err
 		}
 
-		allItems = append(allItems, response.Items...)
-
 		// Check if there are more pages
-		if response.NextPage == "" {
-			break
+		if page.NextPage == "" {
+			return nil
 		}
-		nextPage = response.NextPage
+		nextPage = page.NextPage
+	}
+}
+
+func (r *externalAPIRepository) fetchPage(ctx context.Context, nextPage string) (*dto.Response, error) {
+	endpoint := fmt.Sprintf("%s/production/swechallenge/list", r.baseURL)
+	if nextPage != "" {
+		endpoint = fmt.Sprintf("%s?next_page=%s", endpoint, url.QueryEscape(nextPage))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", r.token))
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	var response dto.Response
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
 
-	return allItems, nil
+	return &response, nil
 }
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/truora/microservice/internal/dto"
+	"github.com/truora/microservice/internal/ratingfile"
+)
+
+// filePageSize is the number of records handed to the sync per page
+const filePageSize = 500
+
+// fileRatingSource reads ratings from a local CSV or NDJSON file. Its cursor
+// is the number of records already consumed.
+type fileRatingSource struct {
+	name   string
+	path   string
+	format ratingfile.Format
+}
+
+func NewFileRatingSource(name, path string, format ratingfile.Format) RatingSource {
+	return &fileRatingSource{
+		name:   name,
+		path:   path,
+		format: format,
+	}
+}
+
+func (s *fileRatingSource) Name() string {
+	return s.name
+}
+
+func (s *fileRatingSource) Kind() string {
+	return string(s.format)
+}
+
+// ForEachPage reads the file from the top, skipping the records before cursor.
+// Files are not ordered by time, so since filters records without ending the
+// walk early. Malformed records are handed out with their page rather than
+// failing the walk.
+func (s *fileRatingSource) ForEachPage(ctx context.Context, cursor string, since *time.Time, handle PageHandler) error {
+	skip := 0
+	if cursor != "" {
+		var err error
+		if skip, err = strconv.Atoi(cursor); err != nil || skip < 0 {
+			return fmt.Errorf("invalid cursor %q for file source %s", cursor, s.name)
+		}
+	}
+
+	file, err := os.Open(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", s.path, err)
+	}
+	defer file.Close()
+
+	reader, err := ratingfile.NewReader(file, s.format)
+	if err != nil {
+		return err
+	}
+
+	consumed := 0
+	page := newFilePage()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		item, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var recordErr *ratingfile.RecordError
+		if err != nil && !errors.As(err, &recordErr) {
+			return fmt.Errorf("failed to read %s: %w", s.path, err)
+		}
+		// Malformed records were consumed too when the cursor was saved
+		if consumed < skip {
+			consumed++
+			continue
+		}
+
+		if recordErr != nil {
+			page.Malformed = append(page.Malformed, &MalformedItem{
+				Line:   recordErr.Line,
+				Reason: recordErr.Err.Error(),
+				Raw:    reader.Raw(),
+			})
+		} else if since != nil && item.Time.Before(*since) {
+			page.Skipped++
+		} else {
+			page.Items = append(page.Items, item)
+		}
+		consumed++
+
+		if len(page.Items)+len(page.Malformed) == filePageSize {
+			page.NextPage = strconv.Itoa(consumed)
+			if err := handle(page); err != nil {
+				return err
+			}
+			page = newFilePage()
+		}
+	}
+
+	return handle(page)
+}
+
+func newFilePage() *Page {
+	return &Page{Items: make([]*dto.StockRatingResponse, 0, filePageSize)}
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/truora/microservice/internal/ratingfile"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ratings.csv")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// collect walks the source from cursor and returns its pages
+func collect(t *testing.T, source RatingSource, cursor string) ([]*Page, error) {
+	t.Helper()
+	var pages []*Page
+	err := source.ForEachPage(context.Background(), cursor, nil, func(page *Page) error {
+		pages = append(pages, page)
+		return nil
+	})
+	return pages, err
+}
+
+func TestFileRatingSourceResumesPastMalformedRecords(t *testing.T) {
+	path := writeFile(t, "ticker,company,time\n"+
+		"AAPL,Apple,2024-01-02T15:04:05Z\n"+
+		"MSFT,Microsoft,yesterday\n"+
+		"GOOG,Alphabet,2024-01-02T15:04:05Z\n")
+	source := NewFileRatingSource("file", path, ratingfile.FormatCSV)
+
+	pages, err := collect(t, source, "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 1 || len(pages[0].Malformed) != 0 || len(pages[0].Items) != 1 || pages[0].Items[0].Ticker != "GOOG" {
+		t.Fatalf("got pages %+v, want only GOOG", pages)
+	}
+}
+
+func TestFileRatingSourceFailsOnBadHeaderWhenResuming(t *testing.T) {
+	path := writeFile(t, "ticker,company\nAAPL,Apple\nMSFT,Microsoft\n")
+	source := NewFileRatingSource("file", path, ratingfile.FormatCSV)
+
+	for _, cursor := range []string{"", "5"} {
+		pages, err := collect(t, source, cursor)
+		if !errors.Is(err, ratingfile.ErrInvalidHeader) {
+			t.Errorf("cursor %q: got %v, want ErrInvalidHeader", cursor, err)
+		}
+		if len(pages) != 0 {
+			t.Errorf("cursor %q: got %d pages, want none", cursor, len(pages))
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/truora/microservice/internal/domain"
+)
+
+type JobErrorRepository interface {
+	CreateBatch(ctx context.Context, jobErrors []*domain.JobError) error
+	GetByJobID(ctx context.Context, jobID uuid.UUID, offset, limit int) ([]*domain.JobError, error)
+	CountByJobID(ctx context.Context, jobID uuid.UUID) (int64, error)
+}
+
+type jobErrorRepository struct {
+	db *gorm.DB
+}
+
+func NewJobErrorRepository(db *gorm.DB) JobErrorRepository {
+	return &jobErrorRepository{db: db}
+}
+
+func (r *jobErrorRepository) CreateBatch(ctx context.Context, jobErrors []*domain.JobError) error {
+	if len(jobErrors) == 0 {
+		return nil
+	}
+	result := r.db.WithContext(ctx).CreateInBatches(jobErrors, 100)
+	return result.Error
+}
+
+func (r *jobErrorRepository) GetByJobID(ctx context.Context, jobID uuid.UUID, offset, limit int) ([]*domain.JobError, error) {
+	var jobErrors []*domain.JobError
+	result := r.db.WithContext(ctx).
+		Where("job_id = ?", jobID).
+		Order("id ASC").
+		Offset(offset).
+		Limit(limit).
+		Find(&jobErrors)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return jobErrors, nil
+}
+
+func (r *jobErrorRepository) CountByJobID(ctx context.Context, jobID uuid.UUID) (int64, error) {
+	var count int64
+	result := r.db.WithContext(ctx).Model(&domain.JobError{}).Where("job_id = ?", jobID).Count(&count)
+	return count, result.Error
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/gorm"
+
+	"github.com/truora/microservice/internal/domain"
+)
+
+// jobEventsChannel is the NOTIFY channel the jobs table trigger publishes to
+const jobEventsChannel = "job_events"
+
+// JobEventListener receives the job changes published by the jobs table
+// trigger, whichever replica made them
+type JobEventListener interface {
+	// Listen passes every job event to handle until ctx is done or the
+	// connection fails
+	Listen(ctx context.Context, handle func(*domain.JobEvent)) error
+}
+
+type jobEventListener struct {
+	db *gorm.DB
+}
+
+func NewJobEventListener(db *gorm.DB) JobEventListener {
+	return &jobEventListener{db: db}
+}
+
+func (l *jobEventListener) Listen(ctx context.Context, handle func(*domain.JobEvent)) error {
+	sqlDB, err := l.db.DB()
+	if err != nil {
+		return err
+	}
+
+	// LISTEN is bound to a session, so it needs a dedicated connection
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open listener connection: %w", err)
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn interface{}) error {
+		stdlibConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("unexpected database driver %T", driverConn)
+		}
+		pgxConn := stdlibConn.Conn()
+
+		if _, err := pgxConn.Exec(ctx, "LISTEN "+jobEventsChannel); err != nil {
+			return fmt.Errorf("failed to listen for job events: %w", err)
+		}
+		// Leave the connection clean for the pool
+		defer pgxConn.Exec(context.Background(), "UNLISTEN "+jobEventsChannel)
+
+		for {
+			notification, err := pgxConn.WaitForNotification(ctx)
+			if err != nil {
+				return err
+			}
+
+			var event domain.JobEvent
+			if err := json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+				log.Printf("Ignoring malformed job event %q: %v", notification.Payload, err)
+				continue
+			}
+			handle(&event)
+		}
+	})
+}
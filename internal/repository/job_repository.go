@@ -2,23 +2,66 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/truora/microservice/internal/domain"
+	"github.com/truora/microservice/internal/dto"
+)
+
+// ErrJobNotActive is returned when a job is no longer in the status an update
+// expects, typically because it was cancelled while running
+var ErrJobNotActive = errors.New("job is no longer active")
+
+// ErrActiveJobExists is returned when storing an exclusive job as pending
+// while another job of its type is still pending or processing
+var ErrActiveJobExists = errors.New("an active job of this type already exists")
+
+// ErrJobAlreadyRetried is returned when linking a retry to a job that already
+// has one
+var ErrJobAlreadyRetried = errors.New("job has already been retried")
+
+// Unique indexes backing ErrActiveJobExists and ErrJobAlreadyRetried
+const (
+	activeExclusiveIndex = "idx_jobs_active_exclusive"
+	parentJobIndex       = "idx_jobs_parent_job_id"
 )
 
 type JobRepository interface {
 	Create(ctx context.Context, job *domain.Job) error
+	CreateRetry(ctx context.Context, retry *domain.Job) error
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.Job, error)
+	GetActiveExclusive(ctx context.Context, jobType string) (*domain.Job, error)
+	GetByParentID(ctx context.Context, parentID uuid.UUID) (*domain.Job, error)
 	Update(ctx context.Context, job *domain.Job) error
 	UpdateStatus(ctx context.Context, id uuid.UUID, status domain.JobStatus, progress int, totalItems int) error
+	Claim(ctx context.Context, workerID string, lease time.Duration) (*domain.Job, error)
+	Heartbeat(ctx context.Context, id uuid.UUID, workerID string, lease time.Duration) error
+	Requeue(ctx context.Context, id uuid.UUID, errorMessage string, runAfter time.Time) error
+	RequeueExpired(ctx context.Context) ([]*domain.Job, error)
+	SaveCheckpoint(ctx context.Context, id uuid.UUID, checkpoint *domain.JobCheckpoint) error
+	SaveCancelledCheckpoint(ctx context.Context, id uuid.UUID, checkpoint *domain.JobCheckpoint) error
 	MarkCompleted(ctx context.Context, id uuid.UUID) error
 	MarkFailed(ctx context.Context, id uuid.UUID, errorMessage string) error
+	MarkCancelled(ctx context.Context, id uuid.UUID) (bool, error)
+	List(ctx context.Context, filter *dto.JobFilter, offset, limit int) ([]*domain.Job, error)
+	Count(ctx context.Context, filter *dto.JobFilter) (int64, error)
+	GetStats(ctx context.Context, filter *dto.JobFilter) ([]*dto.JobStats, error)
+	CountExpired(ctx context.Context, criteria *dto.JobRetentionCriteria) (int64, error)
+	DeleteExpired(ctx context.Context, criteria *dto.JobRetentionCriteria, archive bool) ([]*domain.Job, error)
+	// GetInputPathsInUse returns those of paths some job still reads from
+	GetInputPathsInUse(ctx context.Context, paths []string) ([]string, error)
 }
 
+// activeJobStatuses are the statuses of jobs that have not finished yet
+var activeJobStatuses = []domain.JobStatus{domain.JobStatusPending, domain.JobStatusProcessing}
+
 type jobRepository struct {
 	db *gorm.DB
 }
@@ -29,13 +72,71 @@ func NewJobRepository(db *gorm.DB) JobRepository {
 
 func (r *jobRepository) Create(ctx context.Context, job *domain.Job) error {
 	result := r.db.WithContext(ctx).Create(job)
-	return result.Error
+	return translateJobError(result.Error)
 }
 
 func (r *jobRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Job, error) {
 	var job domain.Job
 	result := r.db.WithContext(ctx).First(&job, "id = ?", id)
 	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return &job, nil
+}
+
+// CreateRetry stores retry and links it as the child of its parent job in one
+// transaction. It returns ErrJobAlreadyRetried when the parent already has a
+// child, so concurrent retries of the same job create a single child.
+func (r *jobRepository) CreateRetry(ctx context.Context, retry *domain.Job) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(retry).Error; err != nil {
+			return err
+		}
+
+		result := tx.Model(&domain.Job{}).
+			Where("id = ? AND child_job_id IS NULL", retry.ParentJobID).
+			Updates(map[string]interface{}{
+				"child_job_id": retry.ID,
+				"updated_at":   time.Now(),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrJobAlreadyRetried
+		}
+		return nil
+	})
+	return translateJobError(err)
+}
+
+// GetActiveExclusive returns the pending or processing exclusive job of a
+// type, or nil when there is none
+func (r *jobRepository) GetActiveExclusive(ctx context.Context, jobType string) (*domain.Job, error) {
+	var job domain.Job
+	result := r.db.WithContext(ctx).
+		Where("type = ? AND exclusive AND status IN ?", jobType, activeJobStatuses).
+		First(&job)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return &job, nil
+}
+
+// GetByParentID returns the retry of a job, or nil when it was not retried
+func (r *jobRepository) GetByParentID(ctx context.Context, parentID uuid.UUID) (*domain.Job, error) {
+	var job domain.Job
+	result := r.db.WithContext(ctx).First(&job, "parent_job_id = ?", parentID)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
 		return nil, result.Error
 	}
 	return &job, nil
@@ -43,7 +144,23 @@ func (r *jobRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Job,
 
 func (r *jobRepository) Update(ctx context.Context, job *domain.Job) error {
 	result := r.db.WithContext(ctx).Save(job)
-	return result.Error
+	return translateJobError(result.Error)
+}
+
+// translateJobError maps violations of the unique job indexes to
+// ErrActiveJobExists and ErrJobAlreadyRetried
+func translateJobError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "23505" {
+		return err
+	}
+	switch pgErr.ConstraintName {
+	case activeExclusiveIndex:
+		return ErrActiveJobExists
+	case parentJobIndex:
+		return ErrJobAlreadyRetried
+	}
+	return err
 }
 
 func (r *jobRepository) UpdateStatus(ctx context.Context, id uuid.UUID, status domain.JobStatus, progress int, totalItems int) error {
@@ -58,26 +175,313 @@ func (r *jobRepository) UpdateStatus(ctx context.Context, id uuid.UUID, status d
 	return result.Error
 }
 
+// Claim hands the oldest runnable pending job to a worker, leasing it for the
+// given duration. SKIP LOCKED lets workers on every replica claim
+// concurrently without waiting on each other. It returns nil when the queue is
+// empty.
+func (r *jobRepository) Claim(ctx context.Context, workerID string, lease time.Duration) (*domain.Job, error) {
+	var jobs []*domain.Job
+	result := r.db.WithContext(ctx).Raw(`
+		UPDATE jobs SET
+			status = ?,
+			attempts = attempts + 1,
+			locked_by = ?,
+			heartbeat_at = NOW(),
+			lease_expires_at = NOW() + make_interval(secs => ?),
+			updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE status = ? AND (run_after IS NULL OR run_after <= NOW())
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		domain.JobStatusProcessing, workerID, lease.Seconds(), domain.JobStatusPending,
+	).Scan(&jobs)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+	return jobs[0], nil
+}
+
+// Heartbeat extends the lease a worker holds on a job. It returns
+// ErrJobNotActive once the job was cancelled or its lease was lost to another
+// worker, which tells the worker to stop.
+func (r *jobRepository) Heartbeat(ctx context.Context, id uuid.UUID, workerID string, lease time.Duration) error {
+	result := r.db.WithContext(ctx).Model(&domain.Job{}).
+		Where("id = ? AND status = ? AND locked_by = ?", id, domain.JobStatusProcessing, workerID).
+		Updates(map[string]interface{}{
+			"heartbeat_at":     gorm.Expr("NOW()"),
+			"lease_expires_at": gorm.Expr("NOW() + make_interval(secs => ?)", lease.Seconds()),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrJobNotActive
+	}
+	return nil
+}
+
+// Requeue returns a failed run to the queue to be retried after runAfter. The
+// saved checkpoint is kept, so the next attempt continues from it.
+func (r *jobRepository) Requeue(ctx context.Context, id uuid.UUID, errorMessage string, runAfter time.Time) error {
+	result := r.db.WithContext(ctx).Model(&domain.Job{}).
+		Where("id = ? AND status = ?", id, domain.JobStatusProcessing).
+		Updates(map[string]interface{}{
+			"status":           domain.JobStatusPending,
+			"error_message":    errorMessage,
+			"run_after":        runAfter,
+			"locked_by":        nil,
+			"heartbeat_at":     nil,
+			"lease_expires_at": nil,
+			"updated_at":       time.Now(),
+		})
+	return result.Error
+}
+
+// RequeueExpired recovers jobs whose worker stopped heartbeating, for example
+// because its process crashed. Jobs with attempts left go back to pending;
+// the rest fail. Processing jobs without a lease predate the queue and are
+// recovered as well. It returns the recovered jobs in their new status.
+func (r *jobRepository) RequeueExpired(ctx context.Context) ([]*domain.Job, error) {
+	var jobs []*domain.Job
+	result := r.db.WithContext(ctx).Raw(`
+		UPDATE jobs SET
+			status = CASE WHEN attempts < max_attempts THEN ? ELSE ? END,
+			error_message = 'Worker lease expired after attempt ' || attempts,
+			locked_by = NULL,
+			heartbeat_at = NULL,
+			lease_expires_at = NULL,
+			updated_at = NOW()
+		WHERE status = ? AND (lease_expires_at IS NULL OR lease_expires_at < NOW())
+		RETURNING *`,
+		domain.JobStatusPending, domain.JobStatusFailed, domain.JobStatusProcessing,
+	).Scan(&jobs)
+	return jobs, result.Error
+}
+
+// SaveCheckpoint records the progress of a sync job once a page is stored.
+// Pages arrive one at a time, so total_items grows along with progress. It
+// returns ErrJobNotActive once the job has been cancelled, which is how a job
+// running on another replica learns it should stop.
+func (r *jobRepository) SaveCheckpoint(ctx context.Context, id uuid.UUID, checkpoint *domain.JobCheckpoint) error {
+	return r.saveCheckpoint(ctx, id, domain.JobStatusProcessing, checkpoint)
+}
+
+// SaveCancelledCheckpoint records the progress a cancelled job made before it
+// stopped, without touching its status
+func (r *jobRepository) SaveCancelledCheckpoint(ctx context.Context, id uuid.UUID, checkpoint *domain.JobCheckpoint) error {
+	return r.saveCheckpoint(ctx, id, domain.JobStatusCancelled, checkpoint)
+}
+
+func (r *jobRepository) saveCheckpoint(ctx context.Context, id uuid.UUID, status domain.JobStatus, checkpoint *domain.JobCheckpoint) error {
+	result := r.db.WithContext(ctx).Model(&domain.Job{}).
+		Where("id = ? AND status = ?", id, status).
+		Updates(map[string]interface{}{
+			"cursor":           checkpoint.Cursor,
+			"latest_item_time": checkpoint.LatestItemTime,
+			"progress":         checkpoint.Progress,
+			"total_items":      checkpoint.Progress,
+			"pages":            checkpoint.Pages,
+			"inserted_items":   checkpoint.Result.Inserted,
+			"updated_items":    checkpoint.Result.Updated,
+			"unchanged_items":  checkpoint.Result.Unchanged,
+			"duplicate_items":  checkpoint.Result.Duplicate,
+			"rejected_items":   checkpoint.Rejected,
+			"skipped_items":    checkpoint.Skipped,
+			"updated_at":       time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrJobNotActive
+	}
+	return nil
+}
+
+// MarkCompleted and MarkFailed only apply to active jobs, so a job that was
+// cancelled mid-run keeps its cancelled status. They return ErrJobNotActive
+// when the job had already finished.
 func (r *jobRepository) MarkCompleted(ctx context.Context, id uuid.UUID) error {
 	now := time.Now()
 	result := r.db.WithContext(ctx).Model(&domain.Job{}).
-		Where("id = ?", id).
+		Where("id = ? AND status IN ?", id, activeJobStatuses).
 		Updates(map[string]interface{}{
-			"status":       domain.JobStatusCompleted,
-			"completed_at": &now,
-			"updated_at":   now,
+			"status":           domain.JobStatusCompleted,
+			"completed_at":     &now,
+			"locked_by":        nil,
+			"lease_expires_at": nil,
+			"updated_at":       now,
 		})
-	return result.Error
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrJobNotActive
+	}
+	return nil
 }
 
 func (r *jobRepository) MarkFailed(ctx context.Context, id uuid.UUID, errorMessage string) error {
 	now := time.Now()
 	result := r.db.WithContext(ctx).Model(&domain.Job{}).
-		Where("id = ?", id).
+		Where("id = ? AND status IN ?", id, activeJobStatuses).
 		Updates(map[string]interface{}{
-			"status":        domain.JobStatusFailed,
-			"error_message": errorMessage,
-			"updated_at":    now,
+			"status":           domain.JobStatusFailed,
+			"error_message":    errorMessage,
+			"locked_by":        nil,
+			"lease_expires_at": nil,
+			"updated_at":       now,
 		})
-	return result.Error
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrJobNotActive
+	}
+	return nil
+}
+
+// MarkCancelled cancels a pending or processing job. It reports false when
+// the job does not exist or has already finished.
+func (r *jobRepository) MarkCancelled(ctx context.Context, id uuid.UUID) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&domain.Job{}).
+		Where("id = ? AND status IN ?", id, activeJobStatuses).
+		Updates(map[string]interface{}{
+			"status":           domain.JobStatusCancelled,
+			"locked_by":        nil,
+			"lease_expires_at": nil,
+			"updated_at":       time.Now(),
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// List returns a page of the jobs matching filter. The status, type and
+// created_at filters and the default order are served by their indexes.
+func (r *jobRepository) List(ctx context.Context, filter *dto.JobFilter, offset, limit int) ([]*domain.Job, error) {
+	column, ok := dto.JobSortFields[filter.SortBy]
+	if !ok {
+		column = "created_at"
+	}
+	direction := "ASC"
+	if filter.SortDesc {
+		direction = "DESC"
+	}
+
+	var jobs []*domain.Job
+	result := r.filtered(ctx, filter).
+		Order(fmt.Sprintf("%s %s NULLS LAST, id %s", column, direction, direction)).
+		Offset(offset).
+		Limit(limit).
+		Find(&jobs)
+	return jobs, result.Error
+}
+
+func (r *jobRepository) Count(ctx context.Context, filter *dto.JobFilter) (int64, error) {
+	var count int64
+	result := r.filtered(ctx, filter).Count(&count)
+	return count, result.Error
+}
+
+// GetStats counts the jobs matching filter per type and status. A job's
+// duration runs from creation until it finished; failed and cancelled jobs
+// have no completed_at, so their last update stands in for it.
+func (r *jobRepository) GetStats(ctx context.Context, filter *dto.JobFilter) ([]*dto.JobStats, error) {
+	var stats []*dto.JobStats
+	result := r.filtered(ctx, filter).
+		Select(`type, status, COUNT(*) AS count,
+			CASE WHEN status IN ? THEN AVG(EXTRACT(EPOCH FROM COALESCE(completed_at, updated_at) - created_at)) END AS avg_duration_seconds`,
+			[]domain.JobStatus{domain.JobStatusCompleted, domain.JobStatusFailed, domain.JobStatusCancelled}).
+		Group("type, status").
+		Order("type, status").
+		Scan(&stats)
+	return stats, result.Error
+}
+
+func (r *jobRepository) filtered(ctx context.Context, filter *dto.JobFilter) *gorm.DB {
+	query := r.db.WithContext(ctx).Model(&domain.Job{})
+	if len(filter.Statuses) > 0 {
+		query = query.Where("status IN ?", filter.Statuses)
+	}
+	if len(filter.Types) > 0 {
+		query = query.Where("type IN ?", filter.Types)
+	}
+	if filter.CreatedFrom != nil {
+		query = query.Where("created_at >= ?", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		query = query.Where("created_at < ?", *filter.CreatedTo)
+	}
+	return query
+}
+
+// CountExpired counts the jobs DeleteExpired would remove, ignoring the limit
+func (r *jobRepository) CountExpired(ctx context.Context, criteria *dto.JobRetentionCriteria) (int64, error) {
+	var count int64
+	result := r.expired(ctx, criteria).Count(&count)
+	return count, result.Error
+}
+
+// DeleteExpired removes a batch of jobs matching criteria and returns them,
+// copying them to jobs_archive first when archive is set. Rows locked by a
+// concurrent pass are skipped, so janitors on every replica can prune at once.
+// Item errors and webhook deliveries of the jobs are deleted with them.
+func (r *jobRepository) DeleteExpired(ctx context.Context, criteria *dto.JobRetentionCriteria, archive bool) ([]*domain.Job, error) {
+	batch := r.expired(ctx, criteria).
+		Select("id").
+		Order("created_at").
+		Limit(criteria.Limit).
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+
+	var jobs []*domain.Job
+	result := r.db.WithContext(ctx).Raw(`
+		WITH expired AS (
+			DELETE FROM jobs WHERE id IN (?) RETURNING *
+		), archived AS (
+			INSERT INTO jobs_archive (id, type, status, created_at, completed_at, data)
+			SELECT id, type, status, created_at, completed_at, to_jsonb(expired) FROM expired
+			WHERE ?
+		)
+		SELECT * FROM expired`,
+		batch, archive,
+	).Scan(&jobs)
+	return jobs, result.Error
+}
+
+func (r *jobRepository) GetInputPathsInUse(ctx context.Context, paths []string) ([]string, error) {
+	var inUse []string
+	result := r.db.WithContext(ctx).Model(&domain.Job{}).
+		Where("input_path IN ?", paths).
+		Distinct().
+		Pluck("input_path", &inUse)
+	return inUse, result.Error
+}
+
+func (r *jobRepository) expired(ctx context.Context, criteria *dto.JobRetentionCriteria) *gorm.DB {
+	query := r.db.WithContext(ctx).Model(&domain.Job{}).
+		Where("status = ? AND COALESCE(completed_at, updated_at) < ?", criteria.Status, criteria.Before)
+	if len(criteria.Types) > 0 {
+		query = query.Where("type IN ?", criteria.Types)
+	}
+	if len(criteria.ExcludeTypes) > 0 {
+		query = query.Where("type NOT IN ?", criteria.ExcludeTypes)
+	}
+	if len(criteria.KeepLatestTypes) > 0 {
+		// Ordered like the job list sorted by completed_at
+		latest := r.db.Table("jobs").
+			Select("DISTINCT ON (type) id").
+			Where("type IN ? AND status = ?", criteria.KeepLatestTypes, domain.JobStatusCompleted).
+			Order("type, completed_at DESC NULLS LAST, id DESC")
+		query = query.Where("id NOT IN (?)", latest)
+	}
+	return query
 }
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/truora/microservice/internal/dto"
+)
+
+// Page is one page of a rating source
+type Page struct {
+	Items []*dto.StockRatingResponse
+	// Malformed holds the records of the page that failed validation
+	Malformed []*MalformedItem
+	// Skipped counts the ratings left out for being older than since
+	Skipped int
+	// NextPage is the cursor of the page that follows, empty on the last page
+	NextPage string
+}
+
+// MalformedItem is a record a source could not turn into a valid rating.
+// Line is only known for file sources.
+type MalformedItem struct {
+	Line   int
+	Reason string
+	Raw    string
+}
+
+// PageHandler receives the pages of a source in order
+type PageHandler func(page *Page) error
+
+// RatingSource is a provider of analyst ratings that can be synced into the
+// store. Sources hand out ratings in pages identified by opaque cursors so a
+// sync can be checkpointed and resumed.
+type RatingSource interface {
+	Name() string
+	Kind() string
+	// ForEachPage walks the source starting at cursor (empty for the
+	// beginning), stopping at the first error returned by handle. Ratings
+	// older than since, when set, are skipped.
+	ForEachPage(ctx context.Context, cursor string, since *time.Time, handle PageHandler) error
+}
+
+// RatingSourceRegistry holds the sources configured for this deployment
+type RatingSourceRegistry struct {
+	sources map[string]RatingSource
+	names   []string
+}
+
+func NewRatingSourceRegistry(sources ...RatingSource) (*RatingSourceRegistry, error) {
+	registry := &RatingSourceRegistry{
+		sources: make(map[string]RatingSource, len(sources)),
+	}
+	for _, source := range sources {
+		if _, exists := registry.sources[source.Name()]; exists {
+			return nil, fmt.Errorf("duplicate rating source %q", source.Name())
+		}
+		registry.sources[source.Name()] = source
+		registry.names = append(registry.names, source.Name())
+	}
+	return registry, nil
+}
+
+func (r *RatingSourceRegistry) Get(name string) (RatingSource, bool) {
+	source, ok := r.sources[name]
+	return source, ok
+}
+
+// All returns the sources in configuration order
+func (r *RatingSourceRegistry) All() []RatingSource {
+	sources := make([]RatingSource, len(r.names))
+	for i, name := range r.names {
+		sources[i] = r.sources[name]
+	}
+	return sources
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/truora/microservice/internal/domain"
+)
+
+type ScheduledRunRepository interface {
+	// Claim stores run unless its schedule slot was already claimed, reporting
+	// whether this call created it
+	Claim(ctx context.Context, run *domain.ScheduledRun) (bool, error)
+	SetJob(ctx context.Context, id uint, jobID uuid.UUID) error
+	SetError(ctx context.Context, id uint, errorMessage string) error
+	GetRecent(ctx context.Context, limit int) ([]*domain.ScheduledRun, error)
+}
+
+type scheduledRunRepository struct {
+	db *gorm.DB
+}
+
+func NewScheduledRunRepository(db *gorm.DB) ScheduledRunRepository {
+	return &scheduledRunRepository{db: db}
+}
+
+func (r *scheduledRunRepository) Claim(ctx context.Context, run *domain.ScheduledRun) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(run)
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *scheduledRunRepository) SetJob(ctx context.Context, id uint, jobID uuid.UUID) error {
+	result := r.db.WithContext(ctx).Model(&domain.ScheduledRun{}).
+		Where("id = ?", id).
+		Update("job_id", jobID)
+	return result.Error
+}
+
+func (r *scheduledRunRepository) SetError(ctx context.Context, id uint, errorMessage string) error {
+	result := r.db.WithContext(ctx).Model(&domain.ScheduledRun{}).
+		Where("id = ?", id).
+		Update("error_message", errorMessage)
+	return result.Error
+}
+
+func (r *scheduledRunRepository) GetRecent(ctx context.Context, limit int) ([]*domain.ScheduledRun, error) {
+	var runs []*domain.ScheduledRun
+	result := r.db.WithContext(ctx).
+		Select("scheduled_runs.*, jobs.status AS job_status").
+		Joins("LEFT JOIN jobs ON jobs.id = scheduled_runs.job_id").
+		Order("scheduled_runs.scheduled_for DESC").
+		Limit(limit).
+		Find(&runs)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return runs, nil
+}
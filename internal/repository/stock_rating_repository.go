@@ -3,38 +3,183 @@ package repository
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/truora/microservice/internal/domain"
+	"github.com/truora/microservice/internal/dto"
+	"github.com/truora/microservice/internal/price"
+	"github.com/truora/microservice/internal/ratingscale"
+	"github.com/truora/microservice/internal/ticker"
 )
 
 type StockRatingRepository interface {
 	Create(ctx context.Context, rating *domain.StockRating) error
 	CreateBatch(ctx context.Context, ratings []*domain.StockRating) error
+	UpsertBatch(ctx context.Context, ratings []*domain.StockRating) (*domain.UpsertResult, error)
 	GetByID(ctx context.Context, id uint) (*domain.StockRating, error)
-	GetByTicker(ctx context.Context, ticker string) ([]*domain.StockRating, error)
+	GetByTicker(ctx context.Context, ticker string, filter *dto.StockRatingFilter) ([]*domain.StockRating, error)
 	GetLatestByTicker(ctx context.Context, ticker string) (*domain.StockRating, error)
-	GetPaginated(ctx context.Context, offset, limit int) ([]*domain.StockRating, error)
-	GetTotalCount(ctx context.Context) (int64, error)
+	GetPaginated(ctx context.Context, filter *dto.StockRatingFilter, offset, limit int) ([]*domain.StockRating, error)
+	GetTotalCount(ctx context.Context, filter *dto.StockRatingFilter) (int64, error)
+	// GetByCursor returns up to limit ratings ordered by (time, id), newest
+	// first unless filter asks otherwise, following cursor or from the start
+	// when it is nil. A backward cursor returns the ratings before it, still
+	// in listing order.
+	GetByCursor(ctx context.Context, filter *dto.StockRatingFilter, cursor *dto.RatingCursor, limit int) ([]*domain.StockRating, error)
+	// Renormalize maps the stored ratings again with the current scale and
+	// returns how many rows changed
+	Renormalize(ctx context.Context) (int64, error)
+	GetUnmappedRatings(ctx context.Context) ([]*dto.UnmappedRating, error)
+	// ReparseTargets parses the stored targets again with price.ParseTargets
+	// and returns how many rows changed
+	ReparseTargets(ctx context.Context) (int64, error)
+	// ReclassifyActions classifies the stored actions again with
+	// domain.ClassifyAction and returns how many rows changed
+	ReclassifyActions(ctx context.Context) (int64, error)
 }
 
 type stockRatingRepository struct {
-	db *gorm.DB
+	db      *gorm.DB
+	scale   *ratingscale.Scale
+	tickers *ticker.Normalizer
 }
 
-func NewStockRatingRepository(db *gorm.DB) StockRatingRepository {
-	return &stockRatingRepository{db: db}
+// NewStockRatingRepository normalizes the ticker of every rating it stores
+// or looks up, maps stored ratings to the canonical scale and links them to
+// their brokerage and company
+func NewStockRatingRepository(db *gorm.DB, scale *ratingscale.Scale, tickers *ticker.Normalizer) StockRatingRepository {
+	return &stockRatingRepository{db: db, scale: scale, tickers: tickers}
 }
 
 func (r *stockRatingRepository) Create(ctx context.Context, rating *domain.StockRating) error {
-	result := r.db.WithContext(ctx).Create(rating)
-	return result.Error
+	r.normalize(rating)
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := link(tx, []*domain.StockRating{rating}); err != nil {
+			return err
+		}
+		return tx.Create(rating).Error
+	})
 }
 
 func (r *stockRatingRepository) CreateBatch(ctx context.Context, ratings []*domain.StockRating) error {
-	result := r.db.WithContext(ctx).CreateInBatches(ratings, 100)
-	return result.Error
+	for _, rating := range ratings {
+		r.normalize(rating)
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := link(tx, ratings); err != nil {
+			return err
+		}
+		return tx.CreateInBatches(ratings, 100).Error
+	})
+}
+
+func (r *stockRatingRepository) normalize(rating *domain.StockRating) {
+	rating.Ticker = r.tickers.Normalize(rating.Ticker)
+	r.scale.Apply(rating)
+}
+
+// link resolves the brokerages of ratings and registers their companies
+func link(tx *gorm.DB, ratings []*domain.StockRating) error {
+	if err := resolveBrokerages(tx, ratings); err != nil {
+		return err
+	}
+	return upsertCompanies(tx, ratings)
+}
+
+// UpsertBatch stores ratings matched on their natural key: unseen ratings are
+// inserted, known ones get their mutable columns refreshed when they differ
+// and everything else is reported as unchanged
+func (r *stockRatingRepository) UpsertBatch(ctx context.Context, ratings []*domain.StockRating) (*domain.UpsertResult, error) {
+	result := &domain.UpsertResult{}
+	if len(ratings) == 0 {
+		return result, nil
+	}
+
+	// Collapse repeated keys so each rating is written once per batch
+	seen := make(map[string]struct{}, len(ratings))
+	unique := make([]*domain.StockRating, 0, len(ratings))
+	for _, rating := range ratings {
+		r.normalize(rating)
+		key := rating.NaturalKey()
+		if _, ok := seen[key]; ok {
+			result.Duplicate++
+			continue
+		}
+		seen[key] = struct{}{}
+		unique = append(unique, rating)
+	}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := link(tx, unique); err != nil {
+			return err
+		}
+
+		keys := make([][]interface{}, len(unique))
+		for i, rating := range unique {
+			keys[i] = []interface{}{
+				rating.Ticker, rating.Brokerage, rating.Time, rating.Action,
+				rating.RatingFrom, rating.RatingTo, rating.TargetFrom, rating.TargetTo,
+			}
+		}
+
+		var existing []*domain.StockRating
+		if err := tx.
+			Where("(ticker, brokerage, time, action, rating_from, rating_to, target_from, target_to) IN ?", keys).
+			Find(&existing).Error; err != nil {
+			return err
+		}
+
+		stored := make(map[string]*domain.StockRating, len(existing))
+		for _, rating := range existing {
+			stored[rating.NaturalKey()] = rating
+		}
+
+		var toInsert []*domain.StockRating
+		for _, rating := range unique {
+			current, ok := stored[rating.NaturalKey()]
+			if !ok {
+				toInsert = append(toInsert, rating)
+				continue
+			}
+
+			if current.Company == rating.Company {
+				result.Unchanged++
+				continue
+			}
+
+			if err := tx.Model(&domain.StockRating{}).
+				Where("id = ?", current.ID).
+				Updates(map[string]interface{}{
+					"company":    rating.Company,
+					"updated_at": time.Now(),
+				}).Error; err != nil {
+				return err
+			}
+			result.Updated++
+		}
+
+		if len(toInsert) == 0 {
+			return nil
+		}
+
+		// A concurrent writer may have stored the same key since the lookup
+		insert := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(toInsert, 100)
+		if insert.Error != nil {
+			return insert.Error
+		}
+		result.Inserted += int(insert.RowsAffected)
+		result.Unchanged += len(toInsert) - int(insert.RowsAffected)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
 func (r *stockRatingRepository) GetByID(ctx context.Context, id uint) (*domain.StockRating, error) {
@@ -49,9 +194,11 @@ func (r *stockRatingRepository) GetByID(ctx context.Context, id uint) (*domain.S
 	return &rating, nil
 }
 
-func (r *stockRatingRepository) GetByTicker(ctx context.Context, ticker string) ([]*domain.StockRating, error) {
+func (r *stockRatingRepository) GetByTicker(ctx context.Context, ticker string, filter *dto.StockRatingFilter) ([]*domain.StockRating, error) {
 	var ratings []*domain.StockRating
-	result := r.db.WithContext(ctx).Where("ticker = ?", ticker).Find(&ratings)
+	result := r.sorted(r.filtered(ctx, filter), filter).
+		Where("ticker = ?", r.tickers.Normalize(ticker)).
+		Find(&ratings)
 	if result.Error != nil {
 		return nil, result.Error
 	}
@@ -61,7 +208,7 @@ func (r *stockRatingRepository) GetByTicker(ctx context.Context, ticker string)
 func (r *stockRatingRepository) GetLatestByTicker(ctx context.Context, ticker string) (*domain.StockRating, error) {
 	var rating domain.StockRating
 	result := r.db.WithContext(ctx).
-		Where("ticker = ?", ticker).
+		Where("ticker = ?", r.tickers.Normalize(ticker)).
 		Order("time DESC").
 		First(&rating)
 	if result.Error != nil {
@@ -73,10 +220,9 @@ func (r *stockRatingRepository) GetLatestByTicker(ctx context.Context, ticker st
 	return &rating, nil
 }
 
-func (r *stockRatingRepository) GetPaginated(ctx context.Context, offset, limit int) ([]*domain.StockRating, error) {
+func (r *stockRatingRepository) GetPaginated(ctx context.Context, filter *dto.StockRatingFilter, offset, limit int) ([]*domain.StockRating, error) {
 	var ratings []*domain.StockRating
-	result := r.db.WithContext(ctx).
-		Order("time DESC").
+	result := r.sorted(r.filtered(ctx, filter), filter).
 		Offset(offset).
 		Limit(limit).
 		Find(&ratings)
@@ -86,8 +232,303 @@ func (r *stockRatingRepository) GetPaginated(ctx context.Context, offset, limit
 	return ratings, nil
 }
 
-func (r *stockRatingRepository) GetTotalCount(ctx context.Context) (int64, error) {
+func (r *stockRatingRepository) GetTotalCount(ctx context.Context, filter *dto.StockRatingFilter) (int64, error) {
 	var count int64
-	result := r.db.WithContext(ctx).Model(&domain.StockRating{}).Count(&count)
+	result := r.filtered(ctx, filter).Count(&count)
 	return count, result.Error
 }
+
+// GetByCursor seeks straight to the cursor instead of skipping rows, so pages
+// stay fast and stable while new ratings are inserted.
+func (r *stockRatingRepository) GetByCursor(ctx context.Context, filter *dto.StockRatingFilter, cursor *dto.RatingCursor, limit int) ([]*domain.StockRating, error) {
+	desc := filter == nil || filter.SortDesc
+	backward := cursor != nil && cursor.Backward
+	// A backward page is read in reverse from the cursor, then flipped
+	scanDesc := desc != backward
+
+	query := r.filtered(ctx, filter)
+	if cursor != nil {
+		op := ">"
+		if scanDesc {
+			op = "<"
+		}
+		query = query.Where(fmt.Sprintf("(time, id) %s (?, ?)", op), cursor.Time, cursor.ID)
+	}
+	direction := "ASC"
+	if scanDesc {
+		direction = "DESC"
+	}
+
+	var ratings []*domain.StockRating
+	result := query.
+		Order(fmt.Sprintf("time %s, id %s", direction, direction)).
+		Limit(limit).
+		Find(&ratings)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if backward {
+		for i, j := 0, len(ratings)-1; i < j; i, j = i+1, j-1 {
+			ratings[i], ratings[j] = ratings[j], ratings[i]
+		}
+	}
+	return ratings, nil
+}
+
+func (r *stockRatingRepository) filtered(ctx context.Context, filter *dto.StockRatingFilter) *gorm.DB {
+	query := r.db.WithContext(ctx).Model(&domain.StockRating{})
+	if filter == nil {
+		return query
+	}
+	if len(filter.ActionTypes) > 0 {
+		query = query.Where("action_type IN ?", filter.ActionTypes)
+	}
+	if len(filter.Tickers) > 0 {
+		tickers := make([]string, len(filter.Tickers))
+		for i, raw := range filter.Tickers {
+			tickers[i] = r.tickers.Normalize(raw)
+		}
+		query = query.Where("ticker IN ?", tickers)
+	}
+	if len(filter.Brokerages) > 0 {
+		keys := make([]string, len(filter.Brokerages))
+		for i, name := range filter.Brokerages {
+			keys[i] = domain.BrokerageKey(name)
+		}
+		query = query.Where("brokerage_id IN (SELECT brokerage_id FROM brokerage_aliases WHERE alias_key IN ?)", keys)
+	}
+	if len(filter.BrokerageIDs) > 0 {
+		query = query.Where("brokerage_id IN ?", filter.BrokerageIDs)
+	}
+	if len(filter.Actions) > 0 {
+		query = query.Where("lower(action) IN ?", lowered(filter.Actions))
+	}
+	if len(filter.RatingsFrom) > 0 {
+		query = query.Where("lower(rating_from) IN ?", lowered(filter.RatingsFrom))
+	}
+	if len(filter.RatingsTo) > 0 {
+		query = query.Where("lower(rating_to) IN ?", lowered(filter.RatingsTo))
+	}
+	if filter.TimeFrom != nil {
+		query = query.Where("time >= ?", *filter.TimeFrom)
+	}
+	if filter.TimeTo != nil {
+		query = query.Where("time < ?", *filter.TimeTo)
+	}
+	if filter.TargetMin != nil {
+		query = query.Where("target_to_value >= ?", *filter.TargetMin)
+	}
+	if filter.TargetMax != nil {
+		query = query.Where("target_to_value <= ?", *filter.TargetMax)
+	}
+	return query
+}
+
+// sorted orders query as filter asks, newest first by default. The id breaks
+// ties so pages do not overlap.
+func (r *stockRatingRepository) sorted(query *gorm.DB, filter *dto.StockRatingFilter) *gorm.DB {
+	column, direction := "time", "DESC"
+	if filter != nil {
+		if sortColumn, ok := dto.StockRatingSortFields[filter.SortBy]; ok {
+			column = sortColumn
+		}
+		if !filter.SortDesc {
+			direction = "ASC"
+		}
+	}
+	return query.Order(fmt.Sprintf("%s %s NULLS LAST, id %s", column, direction, direction))
+}
+
+// lowered returns values in lower case
+func lowered(values []string) []string {
+	lower := make([]string, len(values))
+	for i, value := range values {
+		lower[i] = strings.ToLower(value)
+	}
+	return lower
+}
+
+// Renormalize rewrites the normalized columns of both ratings from the scale,
+// matching keys the way ratingscale.Key does and leaving current rows alone
+func (r *stockRatingRepository) Renormalize(ctx context.Context) (int64, error) {
+	mapping := r.scale.Mapping()
+	if len(mapping) == 0 {
+		return 0, nil
+	}
+
+	rows := make([]string, 0, len(mapping))
+	args := make([]interface{}, 0, len(mapping)*3)
+	for key, level := range mapping {
+		rows = append(rows, "(?::text, ?::text, ?::smallint)")
+		args = append(args, key, string(level), level.Score())
+	}
+	values := strings.Join(rows, ", ")
+
+	var updated int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, column := range []string{"rating_from", "rating_to"} {
+			query := fmt.Sprintf(`
+				UPDATE stock_ratings s
+				SET %[1]s_normalized = n.level, %[1]s_score = n.score, updated_at = NOW()
+				FROM (
+					SELECT r.id, COALESCE(m.level, '') AS level, m.score
+					FROM stock_ratings r
+					LEFT JOIN (VALUES %[2]s) AS m(key, level, score) ON m.key = %[3]s
+				) n
+				WHERE n.id = s.id
+					AND (s.%[1]s_normalized <> n.level OR s.%[1]s_score IS DISTINCT FROM n.score)`,
+				column, values, fmt.Sprintf(ratingscale.KeySQL, "r."+column))
+
+			result := tx.Exec(query, args...)
+			if result.Error != nil {
+				return result.Error
+			}
+			updated += result.RowsAffected
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
+
+// ReparseTargets rewrites the parsed target columns, leaving current rows
+// alone. Targets repeat across ratings, so each distinct pair is parsed once
+// into a temporary table that the update joins.
+func (r *stockRatingRepository) ReparseTargets(ctx context.Context) (int64, error) {
+	var updated int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var pairs []struct {
+			TargetFrom string
+			TargetTo   string
+		}
+		if err := tx.Raw(`
+			SELECT DISTINCT COALESCE(target_from, '') AS target_from, COALESCE(target_to, '') AS target_to
+			FROM stock_ratings`).
+			Scan(&pairs).Error; err != nil {
+			return err
+		}
+
+		// Values are rounded like the columns, so unchanged rows compare equal
+		if err := tx.Exec(`
+			CREATE TEMP TABLE target_parses (
+				target_from TEXT, target_to TEXT,
+				from_value NUMERIC(14,4), to_value NUMERIC(14,4),
+				currency TEXT, mixed BOOLEAN
+			) ON COMMIT DROP`).Error; err != nil {
+			return err
+		}
+
+		rows := make([][]interface{}, len(pairs))
+		for i, pair := range pairs {
+			targets := price.ParseTargets(pair.TargetFrom, pair.TargetTo)
+			rows[i] = []interface{}{pair.TargetFrom, pair.TargetTo, targets.From, targets.To, targets.Currency, targets.Mixed}
+		}
+		if err := insertRows(tx, "target_parses", rows); err != nil {
+			return err
+		}
+
+		result := tx.Exec(`
+			UPDATE stock_ratings s SET
+				target_from_value = p.from_value,
+				target_to_value = p.to_value,
+				target_currency = p.currency,
+				target_currency_mixed = p.mixed,
+				updated_at = NOW()
+			FROM target_parses p
+			WHERE COALESCE(s.target_from, '') = p.target_from AND COALESCE(s.target_to, '') = p.target_to
+				AND (s.target_from_value IS DISTINCT FROM p.from_value
+					OR s.target_to_value IS DISTINCT FROM p.to_value
+					OR s.target_currency <> p.currency
+					OR s.target_currency_mixed <> p.mixed)`)
+		updated = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
+
+// ReclassifyActions rewrites the action types that differ from what
+// domain.ClassifyAction returns, classifying each distinct action once
+func (r *stockRatingRepository) ReclassifyActions(ctx context.Context) (int64, error) {
+	var updated int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var actions []string
+		if err := tx.Raw(`SELECT DISTINCT COALESCE(action, '') FROM stock_ratings`).
+			Scan(&actions).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Exec(`
+			CREATE TEMP TABLE action_types (action TEXT, action_type TEXT) ON COMMIT DROP`).Error; err != nil {
+			return err
+		}
+
+		rows := make([][]interface{}, len(actions))
+		for i, action := range actions {
+			rows[i] = []interface{}{action, domain.ClassifyAction(action)}
+		}
+		if err := insertRows(tx, "action_types", rows); err != nil {
+			return err
+		}
+
+		result := tx.Exec(`
+			UPDATE stock_ratings s SET action_type = a.action_type, updated_at = NOW()
+			FROM action_types a
+			WHERE COALESCE(s.action, '') = a.action AND s.action_type <> a.action_type`)
+		updated = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
+
+// insertRows inserts rows into a table in batches that stay under the bind
+// parameter limit
+func insertRows(tx *gorm.DB, table string, rows [][]interface{}) error {
+	batchSize := 1000
+	for start := 0; start < len(rows); start += batchSize {
+		end := start + batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		values := make([]string, 0, end-start)
+		var args []interface{}
+		for _, row := range rows[start:end] {
+			values = append(values, "("+strings.TrimSuffix(strings.Repeat("?, ", len(row)), ", ")+")")
+			args = append(args, row...)
+		}
+		if err := tx.Exec("INSERT INTO "+table+" VALUES "+strings.Join(values, ", "), args...).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetUnmappedRatings counts the raw ratings, from either side of a change,
+// that the scale has no level for
+func (r *stockRatingRepository) GetUnmappedRatings(ctx context.Context) ([]*dto.UnmappedRating, error) {
+	var unmapped []*dto.UnmappedRating
+	result := r.db.WithContext(ctx).Raw(`
+		SELECT value, COUNT(*) AS occurrences, MAX(time) AS last_seen
+		FROM (
+			SELECT rating_from AS value, time FROM stock_ratings
+			WHERE rating_from <> '' AND rating_from_normalized = ''
+			UNION ALL
+			SELECT rating_to AS value, time FROM stock_ratings
+			WHERE rating_to <> '' AND rating_to_normalized = ''
+		) u
+		GROUP BY value
+		ORDER BY occurrences DESC, value`).
+		Scan(&unmapped)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return unmapped, nil
+}
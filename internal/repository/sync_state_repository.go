@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/truora/microservice/internal/domain"
+)
+
+type SyncStateRepository interface {
+	Get(ctx context.Context, source string) (*domain.SyncState, error)
+	Save(ctx context.Context, state *domain.SyncState) error
+}
+
+type syncStateRepository struct {
+	db *gorm.DB
+}
+
+func NewSyncStateRepository(db *gorm.DB) SyncStateRepository {
+	return &syncStateRepository{db: db}
+}
+
+func (r *syncStateRepository) Get(ctx context.Context, source string) (*domain.SyncState, error) {
+	var state domain.SyncState
+	result := r.db.WithContext(ctx).First(&state, "source = ?", source)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return &state, nil
+}
+
+func (r *syncStateRepository) Save(ctx context.Context, state *domain.SyncState) error {
+	result := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{UpdateAll: true}).
+		Create(state)
+	return result.Error
+}
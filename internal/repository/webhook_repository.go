@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/truora/microservice/internal/domain"
+)
+
+type WebhookRepository interface {
+	CreateSubscription(ctx context.Context, subscription *domain.WebhookSubscription) error
+	ListSubscriptions(ctx context.Context) ([]*domain.WebhookSubscription, error)
+	GetSubscriptionsForJobType(ctx context.Context, jobType string) ([]*domain.WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, id uint) (bool, error)
+	QueueDeliveries(ctx context.Context, jobID uuid.UUID, deliveries []*domain.WebhookDelivery) (bool, error)
+	GetUnnotifiedJobIDs(ctx context.Context, finishedAfter, finishedBefore time.Time, limit int) ([]uuid.UUID, error)
+	ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*domain.WebhookDelivery, error)
+	MarkDelivered(ctx context.Context, id uint, statusCode int) error
+	MarkAttemptFailed(ctx context.Context, id uint, statusCode *int, errorMessage string, nextAttemptAt *time.Time) error
+	GetDeliveriesByJobID(ctx context.Context, jobID uuid.UUID) ([]*domain.WebhookDelivery, error)
+}
+
+type webhookRepository struct {
+	db *gorm.DB
+}
+
+func NewWebhookRepository(db *gorm.DB) WebhookRepository {
+	return &webhookRepository{db: db}
+}
+
+func (r *webhookRepository) CreateSubscription(ctx context.Context, subscription *domain.WebhookSubscription) error {
+	result := r.db.WithContext(ctx).Create(subscription)
+	return result.Error
+}
+
+func (r *webhookRepository) ListSubscriptions(ctx context.Context) ([]*domain.WebhookSubscription, error) {
+	var subscriptions []*domain.WebhookSubscription
+	result := r.db.WithContext(ctx).Order("id ASC").Find(&subscriptions)
+	return subscriptions, result.Error
+}
+
+// GetSubscriptionsForJobType returns the subscriptions for jobType and the
+// ones matching every job
+func (r *webhookRepository) GetSubscriptionsForJobType(ctx context.Context, jobType string) ([]*domain.WebhookSubscription, error) {
+	var subscriptions []*domain.WebhookSubscription
+	result := r.db.WithContext(ctx).
+		Where("job_type = ? OR job_type = ''", jobType).
+		Order("id ASC").
+		Find(&subscriptions)
+	return subscriptions, result.Error
+}
+
+func (r *webhookRepository) DeleteSubscription(ctx context.Context, id uint) (bool, error) {
+	result := r.db.WithContext(ctx).Delete(&domain.WebhookSubscription{}, id)
+	return result.RowsAffected == 1, result.Error
+}
+
+// QueueDeliveries stores the deliveries of a finished job in the same
+// transaction that marks the job as notified. It reports false, storing
+// nothing, when the job's deliveries had already been queued.
+func (r *webhookRepository) QueueDeliveries(ctx context.Context, jobID uuid.UUID, deliveries []*domain.WebhookDelivery) (bool, error) {
+	queued := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&domain.Job{}).
+			Where("id = ? AND notified_at IS NULL", jobID).
+			UpdateColumn("notified_at", time.Now())
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		queued = true
+
+		if len(deliveries) == 0 {
+			return nil
+		}
+		return tx.Create(deliveries).Error
+	})
+	return queued && err == nil, err
+}
+
+// GetUnnotifiedJobIDs returns completed and failed jobs, last updated in the
+// given window, whose webhook deliveries were never queued
+func (r *webhookRepository) GetUnnotifiedJobIDs(ctx context.Context, finishedAfter, finishedBefore time.Time, limit int) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	result := r.db.WithContext(ctx).Model(&domain.Job{}).
+		Where("notified_at IS NULL AND status IN ?", []domain.JobStatus{domain.JobStatusCompleted, domain.JobStatusFailed}).
+		Where("updated_at > ? AND updated_at < ?", finishedAfter, finishedBefore).
+		Order("updated_at").
+		Limit(limit).
+		Pluck("id", &ids)
+	return ids, result.Error
+}
+
+// ClaimDueDeliveries hands due deliveries to one dispatcher. Claimed
+// deliveries are pushed back by lease, so if the dispatcher dies before
+// recording the outcome they are retried once it passes.
+func (r *webhookRepository) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*domain.WebhookDelivery, error) {
+	var deliveries []*domain.WebhookDelivery
+	result := r.db.WithContext(ctx).Raw(`
+		UPDATE webhook_deliveries SET
+			attempts = attempts + 1,
+			next_attempt_at = NOW() + make_interval(secs => ?),
+			updated_at = NOW()
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = ? AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		lease.Seconds(), domain.WebhookDeliveryPending, limit,
+	).Scan(&deliveries)
+	return deliveries, result.Error
+}
+
+func (r *webhookRepository) MarkDelivered(ctx context.Context, id uint, statusCode int) error {
+	now := time.Now()
+	result := r.db.WithContext(ctx).Model(&domain.WebhookDelivery{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":           domain.WebhookDeliveryDelivered,
+			"last_status_code": statusCode,
+			"last_error":       nil,
+			"delivered_at":     &now,
+			"updated_at":       now,
+		})
+	return result.Error
+}
+
+// MarkAttemptFailed records a failed attempt. The delivery is retried at
+// nextAttemptAt, or gives up when it is nil.
+func (r *webhookRepository) MarkAttemptFailed(ctx context.Context, id uint, statusCode *int, errorMessage string, nextAttemptAt *time.Time) error {
+	updates := map[string]interface{}{
+		"last_status_code": statusCode,
+		"last_error":       errorMessage,
+		"updated_at":       time.Now(),
+	}
+	if nextAttemptAt != nil {
+		updates["next_attempt_at"] = *nextAttemptAt
+	} else {
+		updates["status"] = domain.WebhookDeliveryFailed
+	}
+
+	result := r.db.WithContext(ctx).Model(&domain.WebhookDelivery{}).
+		Where("id = ?", id).
+		Updates(updates)
+	return result.Error
+}
+
+func (r *webhookRepository) GetDeliveriesByJobID(ctx context.Context, jobID uuid.UUID) ([]*domain.WebhookDelivery, error) {
+	var deliveries []*domain.WebhookDelivery
+	result := r.db.WithContext(ctx).
+		Where("job_id = ?", jobID).
+		Order("id ASC").
+		Find(&deliveries)
+	return deliveries, result.Error
+}
@@ -0,0 +1,95 @@
+// Package ticker normalizes the ticker symbols of ratings so each company is
+// stored under one canonical ticker.
+package ticker
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// MaxLength is the width of the ticker columns
+const MaxLength = 10
+
+// symbol allows letters and digits, with single dots, dashes or slashes
+// between them as in "BRK.B" or "RDS-A"
+var symbol = regexp.MustCompile(`^[A-Z0-9]+([./-][A-Z0-9]+)*$`)
+
+// Clean trims and upper-cases a ticker
+func Clean(raw string) string {
+	return strings.ToUpper(strings.TrimSpace(raw))
+}
+
+// Validate reports why a ticker, once cleaned, is not a valid symbol
+func Validate(raw string) error {
+	cleaned := Clean(raw)
+	if cleaned == "" {
+		return fmt.Errorf("ticker is required")
+	}
+	if len(cleaned) > MaxLength {
+		return fmt.Errorf("ticker exceeds %d characters", MaxLength)
+	}
+	if !symbol.MatchString(cleaned) {
+		return fmt.Errorf("invalid ticker %q", raw)
+	}
+	return nil
+}
+
+// Normalizer maps tickers to their canonical form
+type Normalizer struct {
+	aliases map[string]string
+}
+
+// NewNormalizer builds a normalizer mapping each alias, such as a former
+// ticker, to the canonical ticker it stands for
+func NewNormalizer(aliases map[string]string) (*Normalizer, error) {
+	normalizer := &Normalizer{aliases: make(map[string]string, len(aliases))}
+	for alias, canonical := range aliases {
+		alias, canonical = Clean(alias), Clean(canonical)
+		if err := Validate(canonical); err != nil {
+			return nil, fmt.Errorf("alias %s: %w", alias, err)
+		}
+		if alias == canonical {
+			return nil, fmt.Errorf("ticker %s is an alias of itself", alias)
+		}
+		normalizer.aliases[alias] = canonical
+	}
+
+	for alias, canonical := range normalizer.aliases {
+		if _, ok := normalizer.aliases[canonical]; ok {
+			return nil, fmt.Errorf("alias %s points at %s, which is an alias too", alias, canonical)
+		}
+	}
+	return normalizer, nil
+}
+
+// Normalize cleans a ticker and resolves its alias
+func (n *Normalizer) Normalize(raw string) string {
+	cleaned := Clean(raw)
+	if canonical, ok := n.aliases[cleaned]; ok {
+		return canonical
+	}
+	return cleaned
+}
+
+// Aliases returns the aliases of canonical
+func (n *Normalizer) Aliases(canonical string) []string {
+	var aliases []string
+	for alias, target := range n.aliases {
+		if target == canonical {
+			aliases = append(aliases, alias)
+		}
+	}
+	sort.Strings(aliases)
+	return aliases
+}
+
+// AliasTickers returns every alias
+func (n *Normalizer) AliasTickers() []string {
+	aliases := make([]string, 0, len(n.aliases))
+	for alias := range n.aliases {
+		aliases = append(aliases, alias)
+	}
+	return aliases
+}
@@ -0,0 +1,77 @@
+package ticker
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		raw   string
+		valid bool
+	}{
+		{"AAPL", true},
+		{" aapl ", true},
+		{"BRK.B", true},
+		{"brk-b", true},
+		{"BF/A", true},
+		{"", false},
+		{"   ", false},
+		{"BRK..B", false},
+		{".BRK", false},
+		{"BRK-", false},
+		{"BRK B", false},
+		{"TOOLONGTICKER", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			if err := Validate(tt.raw); (err == nil) != tt.valid {
+				t.Errorf("Validate(%q) = %v, want valid %v", tt.raw, err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	normalizer, err := NewNormalizer(map[string]string{"brk-b": "BRK.B", "FB": "meta"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"BRK.B", "BRK.B"},
+		{"brk.b", "BRK.B"},
+		{"brk-b", "BRK.B"},
+		{" BRK-B\t", "BRK.B"},
+		{"BRK/B", "BRK/B"},
+		{"fb", "META"},
+		{"Meta", "META"},
+		{"aapl", "AAPL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			if got := normalizer.Normalize(tt.raw); got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+
+	if got := normalizer.Aliases("BRK.B"); len(got) != 1 || got[0] != "BRK-B" {
+		t.Errorf("Aliases(BRK.B) = %v, want [BRK-B]", got)
+	}
+}
+
+func TestNewNormalizerRejectsBadAliases(t *testing.T) {
+	tests := map[string]map[string]string{
+		"invalid canonical": {"GOOG": "GOOG L"},
+		"alias of itself":   {"brk.b": "BRK.B"},
+		"chained aliases":   {"FB": "META", "META": "MTA"},
+	}
+	for name, aliases := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewNormalizer(aliases); err == nil {
+				t.Errorf("NewNormalizer(%v) succeeded, want an error", aliases)
+			}
+		})
+	}
+}
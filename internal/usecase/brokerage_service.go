@@ -0,0 +1,162 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/truora/microservice/internal/domain"
+	"github.com/truora/microservice/internal/dto"
+	"github.com/truora/microservice/internal/repository"
+)
+
+// BrokerageAliases declares the canonical name of a brokerage and the other
+// spellings of it found in ratings
+type BrokerageAliases struct {
+	Name    string
+	Aliases []string
+}
+
+const (
+	// brokerageRecentRatings is how many ratings a brokerage detail lists
+	brokerageRecentRatings = 20
+	// brokerageActivityWindow is the span of the recent activity count
+	brokerageActivityWindow = 30 * 24 * time.Hour
+)
+
+type BrokerageService interface {
+	// Run seeds the configured brokerages once and links the stored ratings
+	// to their brokerages, backfilling ratings stored before brokerages and
+	// following alias changes
+	Run(ctx context.Context)
+	ListBrokerages(ctx context.Context) (*dto.BrokerageListResponse, error)
+	GetBrokerage(ctx context.Context, id uint) (*dto.BrokerageDetailResponse, error)
+}
+
+type brokerageService struct {
+	brokerageRepo repository.BrokerageRepository
+	brokerages    []BrokerageAliases
+}
+
+func NewBrokerageService(brokerageRepo repository.BrokerageRepository, brokerages []BrokerageAliases) (BrokerageService, error) {
+	owners := make(map[string]string)
+	for _, brokerage := range brokerages {
+		if brokerage.Name == "" {
+			return nil, fmt.Errorf("brokerages need a name")
+		}
+		for _, alias := range append([]string{brokerage.Name}, brokerage.Aliases...) {
+			key := domain.BrokerageKey(alias)
+			if owner, ok := owners[key]; ok && owner != brokerage.Name {
+				return nil, fmt.Errorf("alias %q of brokerage %q is already an alias of %q", alias, brokerage.Name, owner)
+			}
+			owners[key] = brokerage.Name
+		}
+	}
+
+	return &brokerageService{
+		brokerageRepo: brokerageRepo,
+		brokerages:    brokerages,
+	}, nil
+}
+
+func (s *brokerageService) Run(ctx context.Context) {
+	for _, brokerage := range s.brokerages {
+		if err := s.brokerageRepo.Seed(ctx, brokerage.Name, brokerage.Aliases); err != nil {
+			log.Printf("Failed to seed brokerage %s: %v", brokerage.Name, err)
+			return
+		}
+	}
+
+	updated, err := s.brokerageRepo.Relink(ctx)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			log.Printf("Brokerage linking failed: %v", err)
+		}
+		return
+	}
+	if updated > 0 {
+		log.Printf("Brokerage linking updated %d ratings", updated)
+	}
+}
+
+func (s *brokerageService) ListBrokerages(ctx context.Context) (*dto.BrokerageListResponse, error) {
+	brokerages, err := s.brokerageRepo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list brokerages: %w", err)
+	}
+
+	aliases, err := s.brokerageRepo.GetAliases(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get brokerage aliases: %w", err)
+	}
+	byBrokerage := make(map[uint][]string)
+	for _, alias := range aliases {
+		byBrokerage[alias.BrokerageID] = append(byBrokerage[alias.BrokerageID], alias.Alias)
+	}
+
+	for _, brokerage := range brokerages {
+		brokerage.Aliases = byBrokerage[brokerage.ID]
+		if brokerage.Aliases == nil {
+			brokerage.Aliases = []string{}
+		}
+	}
+	if brokerages == nil {
+		brokerages = []*dto.BrokerageSummary{}
+	}
+
+	return &dto.BrokerageListResponse{
+		TotalCount: len(brokerages),
+		Brokerages: brokerages,
+	}, nil
+}
+
+func (s *brokerageService) GetBrokerage(ctx context.Context, id uint) (*dto.BrokerageDetailResponse, error) {
+	brokerage, err := s.brokerageRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if brokerage == nil {
+		return nil, nil
+	}
+
+	aliases, err := s.brokerageRepo.GetAliases(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get brokerage aliases: %w", err)
+	}
+
+	activity, err := s.brokerageRepo.GetActivity(ctx, id, time.Now().Add(-brokerageActivityWindow))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get brokerage activity: %w", err)
+	}
+
+	coverage, err := s.brokerageRepo.GetCoverage(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get brokerage coverage: %w", err)
+	}
+	if coverage == nil {
+		coverage = []*dto.BrokerageCoverage{}
+	}
+
+	ratings, err := s.brokerageRepo.GetRecentRatings(ctx, id, brokerageRecentRatings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get brokerage ratings: %w", err)
+	}
+
+	response := &dto.BrokerageDetailResponse{
+		ID:            brokerage.ID,
+		Name:          brokerage.Name,
+		Aliases:       make([]string, len(aliases)),
+		Activity:      activity,
+		Coverage:      coverage,
+		RecentRatings: make([]*dto.StockRatingResponse, len(ratings)),
+	}
+	for i, alias := range aliases {
+		response.Aliases[i] = alias.Alias
+	}
+	for i, rating := range ratings {
+		response.RecentRatings[i] = dto.FromDomain(rating)
+	}
+	return response, nil
+}
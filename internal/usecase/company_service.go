@@ -0,0 +1,179 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/truora/microservice/internal/dto"
+	"github.com/truora/microservice/internal/repository"
+	"github.com/truora/microservice/internal/ticker"
+)
+
+// CompanyReference declares a company ahead of its ratings. Its ticker
+// aliases are resolved by the ticker.Normalizer.
+type CompanyReference struct {
+	Ticker   string
+	Exchange string
+}
+
+const (
+	// companyActivityWindow is the span of the recent rating count
+	companyActivityWindow = 30 * 24 * time.Hour
+	// searchActivityWindow is the span of the ratings that boost search results
+	searchActivityWindow = 90 * 24 * time.Hour
+)
+
+type CompanyService interface {
+	// Run seeds the configured companies once, moves stored ratings to their
+	// canonical tickers and registers the companies of stored ratings
+	Run(ctx context.Context)
+	ListCompanies(ctx context.Context, page, pageSize int) (*dto.CompanyListResponse, error)
+	GetCompany(ctx context.Context, ticker string) (*dto.CompanyDetailResponse, error)
+	// Search finds companies by fuzzy ticker or name, best match first
+	Search(ctx context.Context, query string, limit int) (*dto.SearchResponse, error)
+	// Autocomplete suggests companies by ticker or name prefix
+	Autocomplete(ctx context.Context, query string, limit int) (*dto.AutocompleteResponse, error)
+}
+
+type companyService struct {
+	companyRepo repository.CompanyRepository
+	tickers     *ticker.Normalizer
+	companies   []CompanyReference
+}
+
+func NewCompanyService(companyRepo repository.CompanyRepository, tickers *ticker.Normalizer, companies []CompanyReference) CompanyService {
+	return &companyService{
+		companyRepo: companyRepo,
+		tickers:     tickers,
+		companies:   companies,
+	}
+}
+
+func (s *companyService) Run(ctx context.Context) {
+	if err := s.reconcile(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		log.Printf("Company registry update failed: %v", err)
+	}
+}
+
+func (s *companyService) reconcile(ctx context.Context) error {
+	for _, company := range s.companies {
+		if err := s.companyRepo.Seed(ctx, s.tickers.Normalize(company.Ticker), company.Exchange); err != nil {
+			return fmt.Errorf("failed to seed company %s: %w", company.Ticker, err)
+		}
+	}
+
+	tickers, err := s.companyRepo.GetRatedTickers(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get rated tickers: %w", err)
+	}
+	for _, raw := range tickers {
+		canonical := s.tickers.Normalize(raw)
+		if canonical == raw {
+			continue
+		}
+		moved, err := s.companyRepo.RenameTicker(ctx, raw, canonical)
+		if err != nil {
+			return fmt.Errorf("failed to move ratings of %q to %s: %w", raw, canonical, err)
+		}
+		log.Printf("Moved %d ratings of %q to %s", moved, raw, canonical)
+	}
+
+	if err := s.companyRepo.Backfill(ctx); err != nil {
+		return fmt.Errorf("failed to register companies: %w", err)
+	}
+	// Aliases registered before they were configured no longer have ratings
+	return s.companyRepo.Delete(ctx, s.tickers.AliasTickers())
+}
+
+func (s *companyService) ListCompanies(ctx context.Context, page, pageSize int) (*dto.CompanyListResponse, error) {
+	companies, err := s.companyRepo.List(ctx, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list companies: %w", err)
+	}
+
+	totalCount, err := s.companyRepo.Count(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count companies: %w", err)
+	}
+	if companies == nil {
+		companies = []*dto.CompanySummary{}
+	}
+
+	totalPages := int((totalCount + int64(pageSize) - 1) / int64(pageSize))
+	return &dto.CompanyListResponse{
+		Data:       companies,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalCount: totalCount,
+		TotalPages: totalPages,
+		HasNext:    page < totalPages,
+		HasPrev:    page > 1,
+	}, nil
+}
+
+// GetCompany looks a company up by any of its tickers, returning nil when it
+// is unknown
+func (s *companyService) GetCompany(ctx context.Context, rawTicker string) (*dto.CompanyDetailResponse, error) {
+	canonical := s.tickers.Normalize(rawTicker)
+	company, err := s.companyRepo.GetByTicker(ctx, canonical)
+	if err != nil {
+		return nil, err
+	}
+	if company == nil {
+		return nil, nil
+	}
+
+	names, err := s.companyRepo.GetNameHistory(ctx, canonical)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get company names: %w", err)
+	}
+
+	stats, err := s.companyRepo.GetStats(ctx, canonical, time.Now().Add(-companyActivityWindow))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get company rating stats: %w", err)
+	}
+
+	consensus, err := s.companyRepo.GetConsensus(ctx, canonical)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get company consensus: %w", err)
+	}
+
+	aliases := s.tickers.Aliases(canonical)
+	if aliases == nil {
+		aliases = []string{}
+	}
+	return &dto.CompanyDetailResponse{
+		Company:     company,
+		Aliases:     aliases,
+		NameHistory: names,
+		Stats:       stats,
+		Consensus:   consensus,
+	}, nil
+}
+
+// Search reads the query as a ticker too, so a former ticker finds the
+// company it now belongs to
+func (s *companyService) Search(ctx context.Context, query string, limit int) (*dto.SearchResponse, error) {
+	results, err := s.companyRepo.Search(ctx, query, s.tickers.Normalize(query), time.Now().Add(-searchActivityWindow), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search companies: %w", err)
+	}
+	if results == nil {
+		results = []*dto.SearchResult{}
+	}
+	return &dto.SearchResponse{Query: query, Data: results}, nil
+}
+
+func (s *companyService) Autocomplete(ctx context.Context, query string, limit int) (*dto.AutocompleteResponse, error) {
+	suggestions, err := s.companyRepo.Autocomplete(ctx, query, s.tickers.Normalize(query), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to suggest companies: %w", err)
+	}
+	if suggestions == nil {
+		suggestions = []*dto.AutocompleteSuggestion{}
+	}
+	return &dto.AutocompleteResponse{Query: query, Data: suggestions}, nil
+}
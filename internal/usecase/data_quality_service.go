@@ -0,0 +1,200 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/truora/microservice/internal/domain"
+	"github.com/truora/microservice/internal/dto"
+	"github.com/truora/microservice/internal/repository"
+)
+
+const (
+	// DataQualityJobType is the job type of data-quality scans
+	DataQualityJobType = "data_quality_scan"
+	// dataQualitySource is the source recorded on scan jobs
+	dataQualitySource = "stock_ratings"
+	// futureTimestampTolerance absorbs clock skew between upstream and us
+	futureTimestampTolerance = 5 * time.Minute
+
+	defaultDataQualitySampleSize = 10
+)
+
+// DataQualityConfig controls the data-quality scan
+type DataQualityConfig struct {
+	// Rules switches individual rules on or off; rules left out are on
+	Rules map[domain.DataQualityRule]bool
+	// Interval is how often a scan is queued; zero only scans on request
+	Interval time.Duration
+	// SampleSize caps the offending rating IDs kept per rule
+	SampleSize int
+}
+
+func (c DataQualityConfig) withDefaults() DataQualityConfig {
+	if c.SampleSize <= 0 {
+		c.SampleSize = defaultDataQualitySampleSize
+	}
+	return c
+}
+
+type DataQualityService interface {
+	// Run queues a scan every interval until ctx is done
+	Run(ctx context.Context)
+	// StartScan queues a scan, or returns the active one along with
+	// ErrScanInProgress
+	StartScan(ctx context.Context) (*domain.Job, error)
+	// GetReport returns the findings of the latest completed scan, or nil
+	// when no scan has completed
+	GetReport(ctx context.Context) (*dto.DataQualityReport, error)
+}
+
+type dataQualityService struct {
+	dataQualityRepo repository.DataQualityRepository
+	jobRepo         repository.JobRepository
+	queue           *JobQueue
+	rules           []domain.DataQualityRule
+	config          DataQualityConfig
+}
+
+// NewDataQualityService creates the data-quality service and registers scan
+// jobs with the queue
+func NewDataQualityService(dataQualityRepo repository.DataQualityRepository, jobRepo repository.JobRepository, queue *JobQueue, config DataQualityConfig) (DataQualityService, error) {
+	for rule := range config.Rules {
+		if !rule.IsValid() {
+			return nil, fmt.Errorf("unknown data quality rule %q", rule)
+		}
+	}
+
+	var rules []domain.DataQualityRule
+	for _, rule := range domain.DataQualityRules {
+		if enabled, ok := config.Rules[rule]; !ok || enabled {
+			rules = append(rules, rule)
+		}
+	}
+
+	s := &dataQualityService{
+		dataQualityRepo: dataQualityRepo,
+		jobRepo:         jobRepo,
+		queue:           queue,
+		rules:           rules,
+		config:          config.withDefaults(),
+	}
+	queue.Register(DataQualityJobType, s.runScan)
+	return s, nil
+}
+
+func (s *dataQualityService) Run(ctx context.Context) {
+	if s.config.Interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Replicas queue scans independently; all but one find it in progress
+		if _, err := s.StartScan(ctx); err != nil && !errors.Is(err, ErrScanInProgress) && !errors.Is(err, context.Canceled) {
+			log.Printf("Failed to queue data quality scan: %v", err)
+		}
+	}
+}
+
+func (s *dataQualityService) StartScan(ctx context.Context) (*domain.Job, error) {
+	job := &domain.Job{
+		ID:        uuid.New(),
+		Status:    domain.JobStatusPending,
+		Type:      DataQualityJobType,
+		Source:    dataQualitySource,
+		Mode:      domain.SyncModeFull,
+		Exclusive: true,
+	}
+
+	active, err := s.queue.EnqueueExclusive(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+	if active != nil {
+		return active, ErrScanInProgress
+	}
+	return job, nil
+}
+
+func (s *dataQualityService) GetReport(ctx context.Context) (*dto.DataQualityReport, error) {
+	jobs, err := s.jobRepo.List(ctx, &dto.JobFilter{
+		Statuses: []domain.JobStatus{domain.JobStatusCompleted},
+		Types:    []string{DataQualityJobType},
+		SortBy:   "completed_at",
+		SortDesc: true,
+	}, 0, 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest scan: %w", err)
+	}
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+	job := jobs[0]
+
+	findings, err := s.dataQualityRepo.GetFindings(ctx, job.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get findings: %w", err)
+	}
+	byRule := make(map[domain.DataQualityRule]*domain.DataQualityFinding, len(findings))
+	for _, finding := range findings {
+		byRule[finding.Rule] = finding
+	}
+
+	report := &dto.DataQualityReport{
+		JobID:     job.ID,
+		ScannedAt: job.CompletedAt,
+		Rules:     make([]*dto.DataQualityRuleResult, 0, len(findings)),
+	}
+	for _, rule := range domain.DataQualityRules {
+		finding, ok := byRule[rule]
+		if !ok {
+			continue
+		}
+		report.Rules = append(report.Rules, &dto.DataQualityRuleResult{
+			Rule:        rule,
+			Description: rule.Description(),
+			Count:       finding.Count,
+			SampleIDs:   finding.SampleIDs,
+		})
+		report.TotalFindings += finding.Count
+	}
+	return report, nil
+}
+
+// runScan checks the enabled rules one at a time, saving each finding as it
+// goes. Progress counts the rules checked; a resumed or retried scan checks
+// every rule again, since the ratings may have changed in between.
+func (s *dataQualityService) runScan(ctx context.Context, job *domain.Job) (*domain.JobCheckpoint, error) {
+	checkpoint := &domain.JobCheckpoint{}
+	asOf := time.Now().Add(futureTimestampTolerance)
+
+	for _, rule := range s.rules {
+		finding, err := s.dataQualityRepo.Check(ctx, rule, asOf, s.config.SampleSize)
+		if err != nil {
+			return checkpoint, fmt.Errorf("Failed to check %s: %v", rule, err)
+		}
+		finding.JobID = job.ID
+		if err := s.dataQualityRepo.SaveFinding(ctx, finding); err != nil {
+			return checkpoint, fmt.Errorf("Failed to save %s finding: %v", rule, err)
+		}
+
+		checkpoint.Progress++
+		if err := s.jobRepo.SaveCheckpoint(ctx, job.ID, checkpoint); err != nil {
+			return checkpoint, err
+		}
+	}
+	return checkpoint, nil
+}
@@ -0,0 +1,18 @@
+package usecase
+
+import "errors"
+
+var (
+	ErrJobNotFound     = errors.New("job not found")
+	ErrJobNotResumable = errors.New("only failed or cancelled jobs can be resumed")
+	ErrJobNotRetryable = errors.New("only failed or cancelled jobs can be retried")
+	ErrJobRetried      = errors.New("job has already been retried")
+	ErrJobFinished     = errors.New("job has already finished")
+	ErrSourceNotFound  = errors.New("rating source not found")
+	ErrSyncInProgress  = errors.New("a sync of this source is already in progress")
+	ErrScanInProgress  = errors.New("a data quality scan is already in progress")
+
+	ErrInvalidCallbackURL   = errors.New("callback URL must be an absolute http or https URL of a public host")
+	ErrSubscriptionNotFound = errors.New("webhook subscription not found")
+	ErrWebhooksDisabled     = errors.New("webhooks are disabled because no signing secret is configured")
+)
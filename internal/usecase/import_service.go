@@ -0,0 +1,240 @@
+package usecase
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/truora/microservice/internal/domain"
+	"github.com/truora/microservice/internal/ratingfile"
+	"github.com/truora/microservice/internal/repository"
+)
+
+const (
+	// ImportJobType is the job type of bulk file imports
+	ImportJobType = "stock_rating_import"
+	// importSource is the provenance recorded on imported ratings
+	importSource = "file_import"
+)
+
+type ImportService interface {
+	StartImport(ctx context.Context, format ratingfile.Format, file io.Reader) (*domain.Job, error)
+	WriteReport(ctx context.Context, jobID uuid.UUID, w io.Writer) error
+}
+
+type importService struct {
+	stockRatingRepo repository.StockRatingRepository
+	jobRepo         repository.JobRepository
+	jobErrorRepo    repository.JobErrorRepository
+	queue           *JobQueue
+	spoolDir        string
+}
+
+// NewImportService creates the file import service and registers import jobs
+// with the queue. Uploads are spooled to spoolDir, the system temp directory
+// when empty; it must be shared storage for workers on other replicas to
+// pick the jobs up.
+func NewImportService(stockRatingRepo repository.StockRatingRepository, jobRepo repository.JobRepository, jobErrorRepo repository.JobErrorRepository, queue *JobQueue, spoolDir string) ImportService {
+	s := &importService{
+		stockRatingRepo: stockRatingRepo,
+		jobRepo:         jobRepo,
+		jobErrorRepo:    jobErrorRepo,
+		queue:           queue,
+		spoolDir:        spoolDir,
+	}
+	queue.Register(ImportJobType, s.runImport)
+	return s
+}
+
+// StartImport spools the uploaded file to disk and imports it in a background
+// job, so the request finishes as soon as the upload does
+func (s *importService) StartImport(ctx context.Context, format ratingfile.Format, file io.Reader) (*domain.Job, error) {
+	// The extension records the format for the worker that runs the job
+	spool, err := os.CreateTemp(s.spoolDir, "stock-ratings-import-*."+string(format))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool file: %w", err)
+	}
+
+	if _, err := io.Copy(spool, file); err != nil {
+		spool.Close()
+		os.Remove(spool.Name())
+		return nil, fmt.Errorf("failed to read upload: %w", err)
+	}
+	if err := spool.Close(); err != nil {
+		os.Remove(spool.Name())
+		return nil, fmt.Errorf("failed to write spool file: %w", err)
+	}
+
+	job := &domain.Job{
+		ID:        uuid.New(),
+		Status:    domain.JobStatusPending,
+		Type:      ImportJobType,
+		Source:    importSource,
+		Mode:      domain.SyncModeFull,
+		InputPath: spool.Name(),
+	}
+
+	if err := s.queue.Enqueue(ctx, job); err != nil {
+		os.Remove(spool.Name())
+		return nil, fmt.Errorf("failed to create job: %w", err)
+	}
+
+	return job, nil
+}
+
+// WriteReport writes the rejected lines of an import job as CSV
+func (s *importService) WriteReport(ctx context.Context, jobID uuid.UUID, w io.Writer) error {
+	job, err := s.jobRepo.GetByID(ctx, jobID)
+	if err != nil {
+		return fmt.Errorf("failed to get job: %w", err)
+	}
+	if job == nil {
+		return ErrJobNotFound
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"line", "reason", "raw_payload"}); err != nil {
+		return err
+	}
+
+	batchSize := 1000
+	for offset := 0; ; offset += batchSize {
+		jobErrors, err := s.jobErrorRepo.GetByJobID(ctx, jobID, offset, batchSize)
+		if err != nil {
+			return fmt.Errorf("failed to get job errors: %w", err)
+		}
+
+		for _, jobError := range jobErrors {
+			if err := writer.Write([]string{strconv.Itoa(jobError.Line), jobError.Reason, jobError.RawPayload}); err != nil {
+				return err
+			}
+		}
+
+		if len(jobErrors) < batchSize {
+			break
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// runImport validates every record of the spooled file, upserting the valid
+// ones in chunks and recording each rejected line with its reason. Progress
+// counts the records consumed, so a retried run skips those and continues
+// with the saved counters. The spooled file is removed once the import
+// completes; failed and cancelled imports keep it so they can be resumed.
+func (s *importService) runImport(ctx context.Context, job *domain.Job) (*domain.JobCheckpoint, error) {
+	jobID := job.ID
+
+	format, err := ratingfile.ParseFormat(strings.TrimPrefix(filepath.Ext(job.InputPath), "."))
+	if err != nil {
+		return nil, permanent(fmt.Errorf("Failed to detect upload format: %v", err))
+	}
+
+	file, err := os.Open(job.InputPath)
+	if err != nil {
+		return nil, permanent(fmt.Errorf("Failed to open upload: %v", err))
+	}
+	defer file.Close()
+
+	reader, err := ratingfile.NewReader(file, format)
+	if err != nil {
+		return nil, permanent(err)
+	}
+
+	// Skip the records stored by earlier runs, rejected ones included
+	for skipped := 0; skipped < job.Progress; skipped++ {
+		_, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var recordErr *ratingfile.RecordError
+		if err != nil && !errors.As(err, &recordErr) {
+			return nil, readFailure(reader, err)
+		}
+	}
+
+	// Each chunk is recorded as a page of the job
+	chunkSize := 100
+	checkpoint := job.Checkpoint()
+	var ratings []*domain.StockRating
+	var rejected []*domain.JobError
+
+	flush := func() error {
+		if len(ratings)+len(rejected) == 0 {
+			return nil
+		}
+
+		result, err := s.stockRatingRepo.UpsertBatch(ctx, ratings)
+		if err != nil {
+			return fmt.Errorf("failed to store ratings up to line %d: %w", reader.Line(), err)
+		}
+		if err := s.jobErrorRepo.CreateBatch(ctx, rejected); err != nil {
+			return fmt.Errorf("failed to record rejected lines: %w", err)
+		}
+
+		checkpoint.Result.Add(result)
+		checkpoint.Pages++
+		checkpoint.Progress += len(ratings) + len(rejected)
+		checkpoint.Rejected += len(rejected)
+		ratings, rejected = nil, nil
+
+		return s.jobRepo.SaveCheckpoint(ctx, jobID, checkpoint)
+	}
+
+	for {
+		item, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var recordErr *ratingfile.RecordError
+		if errors.As(err, &recordErr) {
+			rejected = append(rejected, &domain.JobError{
+				JobID:      jobID,
+				Page:       checkpoint.Pages + 1,
+				Line:       recordErr.Line,
+				Reason:     recordErr.Err.Error(),
+				RawPayload: reader.Raw(),
+			})
+		} else if err != nil {
+			return checkpoint, readFailure(reader, err)
+		} else {
+			rating := item.ToDomain()
+			rating.Source = importSource
+			rating.SourceJobID = &jobID
+			ratings = append(ratings, rating)
+		}
+
+		if len(ratings)+len(rejected) >= chunkSize {
+			if err := flush(); err != nil {
+				return checkpoint, err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return checkpoint, err
+	}
+
+	file.Close()
+	os.Remove(job.InputPath)
+	return checkpoint, nil
+}
+
+// readFailure is the error failing an import whose upload could not be read.
+// A broken header fails it for good; other errors are retried.
+func readFailure(reader ratingfile.Reader, err error) error {
+	if errors.Is(err, ratingfile.ErrInvalidHeader) {
+		return permanent(err)
+	}
+	return fmt.Errorf("Failed to read upload after line %d: %v", reader.Line(), err)
+}
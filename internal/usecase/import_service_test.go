@@ -0,0 +1,88 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/truora/microservice/internal/domain"
+	"github.com/truora/microservice/internal/ratingfile"
+	"github.com/truora/microservice/internal/repository"
+)
+
+// recordingRatingRepo keeps the tickers of every rating stored
+type recordingRatingRepo struct {
+	repository.StockRatingRepository
+	tickers []string
+}
+
+func (r *recordingRatingRepo) UpsertBatch(ctx context.Context, ratings []*domain.StockRating) (*domain.UpsertResult, error) {
+	for _, rating := range ratings {
+		r.tickers = append(r.tickers, rating.Ticker)
+	}
+	return &domain.UpsertResult{Inserted: len(ratings)}, nil
+}
+
+type discardJobErrorRepo struct {
+	repository.JobErrorRepository
+}
+
+func (discardJobErrorRepo) CreateBatch(ctx context.Context, errs []*domain.JobError) error {
+	return nil
+}
+
+func spoolUpload(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "upload.csv")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunImportResumesPastRejectedRecords(t *testing.T) {
+	ratingRepo := &recordingRatingRepo{}
+	s := &importService{stockRatingRepo: ratingRepo, jobRepo: &checkpointJobRepo{}, jobErrorRepo: discardJobErrorRepo{}}
+	job := &domain.Job{
+		ID: uuid.New(),
+		InputPath: spoolUpload(t, "ticker,company,time\n"+
+			"AAPL,Apple,2024-01-02T15:04:05Z\n"+
+			"MSFT,Microsoft,yesterday\n"+
+			"GOOG,Alphabet,2024-01-02T15:04:05Z\n"),
+		Progress:      2,
+		RejectedItems: 1,
+	}
+
+	checkpoint, err := s.runImport(context.Background(), job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ratingRepo.tickers) != 1 || ratingRepo.tickers[0] != "GOOG" {
+		t.Errorf("stored %v, want only GOOG", ratingRepo.tickers)
+	}
+	if checkpoint.Progress != 3 || checkpoint.Rejected != 1 {
+		t.Errorf("got %+v, want 3 records consumed and 1 rejected", checkpoint)
+	}
+}
+
+func TestRunImportFailsWhenResumingAnUnreadableUpload(t *testing.T) {
+	ratingRepo := &recordingRatingRepo{}
+	s := &importService{stockRatingRepo: ratingRepo, jobRepo: &checkpointJobRepo{}, jobErrorRepo: discardJobErrorRepo{}}
+	job := &domain.Job{
+		ID:        uuid.New(),
+		InputPath: spoolUpload(t, "ticker,company\nAAPL,Apple\nMSFT,Microsoft\n"),
+		Progress:  5,
+	}
+
+	_, err := s.runImport(context.Background(), job)
+	var permanentErr *permanentError
+	if !errors.As(err, &permanentErr) || !errors.Is(err, ratingfile.ErrInvalidHeader) {
+		t.Fatalf("got %v, want a permanent ErrInvalidHeader", err)
+	}
+	if len(ratingRepo.tickers) != 0 {
+		t.Errorf("stored %v, want nothing", ratingRepo.tickers)
+	}
+}
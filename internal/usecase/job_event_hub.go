@@ -0,0 +1,86 @@
+package usecase
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/truora/microservice/internal/domain"
+	"github.com/truora/microservice/internal/repository"
+)
+
+// listenRetryDelay is how long the hub waits before reconnecting a failed
+// listener
+const listenRetryDelay = 5 * time.Second
+
+// JobEventHub fans the job events received by this process out to the
+// subscribers watching each job
+type JobEventHub struct {
+	listener repository.JobEventListener
+
+	mu          sync.Mutex
+	subscribers map[uuid.UUID]map[chan *domain.JobEvent]struct{}
+}
+
+func NewJobEventHub(listener repository.JobEventListener) *JobEventHub {
+	return &JobEventHub{
+		listener:    listener,
+		subscribers: make(map[uuid.UUID]map[chan *domain.JobEvent]struct{}),
+	}
+}
+
+// Run listens for job events until ctx is done, reconnecting after failures
+func (h *JobEventHub) Run(ctx context.Context) {
+	for {
+		err := h.listener.Listen(ctx, h.publish)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Job event listener stopped, reconnecting: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(listenRetryDelay):
+		}
+	}
+}
+
+// Subscribe returns a channel receiving the events of one job and a function
+// that ends the subscription. Events are snapshots, so a slow subscriber only
+// ever sees the latest one.
+func (h *JobEventHub) Subscribe(jobID uuid.UUID) (<-chan *domain.JobEvent, func()) {
+	ch := make(chan *domain.JobEvent, 1)
+
+	h.mu.Lock()
+	if h.subscribers[jobID] == nil {
+		h.subscribers[jobID] = make(map[chan *domain.JobEvent]struct{})
+	}
+	h.subscribers[jobID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subscribers[jobID], ch)
+		if len(h.subscribers[jobID]) == 0 {
+			delete(h.subscribers, jobID)
+		}
+	}
+}
+
+func (h *JobEventHub) publish(event *domain.JobEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers[event.JobID] {
+		// Replace an undelivered event with the newer one
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- event
+	}
+}
@@ -0,0 +1,383 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/truora/microservice/internal/domain"
+	"github.com/truora/microservice/internal/repository"
+)
+
+// JobRunner does the work of one claimed job, starting from the checkpoint
+// saved on it, and returns the progress it made. The checkpoint is nil if the
+// job never started.
+type JobRunner func(ctx context.Context, job *domain.Job) (*domain.JobCheckpoint, error)
+
+// JobFinishedHook is called once a job has completed or failed for good
+type JobFinishedHook func(ctx context.Context, jobID uuid.UUID)
+
+// QueueConfig controls the job queue. Zero values fall back to the defaults
+// below.
+type QueueConfig struct {
+	// Workers is the number of jobs this process runs at once
+	Workers int
+	// PollInterval is how often idle workers look for jobs enqueued by other
+	// replicas; jobs enqueued locally wake them right away
+	PollInterval time.Duration
+	// LeaseDuration is how long a claimed job survives without a heartbeat
+	// before it is considered orphaned and requeued
+	LeaseDuration time.Duration
+	// MaxAttempts is the number of runs a job gets before it stays failed
+	MaxAttempts int
+	// RetryBackoff is the delay before the first retry, doubled for each
+	// later one
+	RetryBackoff time.Duration
+	// JobTimeout bounds a single run of a job
+	JobTimeout time.Duration
+}
+
+const (
+	defaultQueueWorkers       = 4
+	defaultQueuePollInterval  = 2 * time.Second
+	defaultQueueLeaseDuration = time.Minute
+	defaultQueueMaxAttempts   = 3
+	defaultQueueRetryBackoff  = 30 * time.Second
+	defaultQueueJobTimeout    = 30 * time.Minute
+	maxQueueRetryBackoff      = 30 * time.Minute
+
+	// finishTimeout bounds the writes that record how a job ended
+	finishTimeout = 10 * time.Second
+)
+
+func (c QueueConfig) withDefaults() QueueConfig {
+	if c.Workers <= 0 {
+		c.Workers = defaultQueueWorkers
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = defaultQueuePollInterval
+	}
+	if c.LeaseDuration <= 0 {
+		c.LeaseDuration = defaultQueueLeaseDuration
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = defaultQueueMaxAttempts
+	}
+	if c.RetryBackoff <= 0 {
+		c.RetryBackoff = defaultQueueRetryBackoff
+	}
+	if c.JobTimeout <= 0 {
+		c.JobTimeout = defaultQueueJobTimeout
+	}
+	return c
+}
+
+// permanentError marks a job failure that retrying cannot fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+func permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// JobQueue runs jobs stored in the jobs table on a pool of workers. Workers on
+// every replica claim pending jobs from the same table, keep them leased with
+// heartbeats while they run, and retry failed runs from their checkpoint. Jobs
+// whose worker dies are requeued once their lease expires.
+type JobQueue struct {
+	jobRepo  repository.JobRepository
+	tracker  *JobTracker
+	config   QueueConfig
+	hostname string
+
+	mu            sync.RWMutex
+	runners       map[string]JobRunner
+	finishedHooks []JobFinishedHook
+
+	wake chan struct{}
+}
+
+func NewJobQueue(jobRepo repository.JobRepository, tracker *JobTracker, config QueueConfig) *JobQueue {
+	config = config.withDefaults()
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return &JobQueue{
+		jobRepo:  jobRepo,
+		tracker:  tracker,
+		config:   config,
+		hostname: hostname,
+		runners:  make(map[string]JobRunner),
+		wake:     make(chan struct{}, config.Workers),
+	}
+}
+
+// Register sets the runner for jobs of the given type
+func (q *JobQueue) Register(jobType string, runner JobRunner) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.runners[jobType] = runner
+}
+
+// OnFinished adds a hook called whenever a job completes or fails for good
+func (q *JobQueue) OnFinished(hook JobFinishedHook) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.finishedHooks = append(q.finishedHooks, hook)
+}
+
+// Enqueue stores a new pending job and wakes an idle worker
+func (q *JobQueue) Enqueue(ctx context.Context, job *domain.Job) error {
+	job.Status = domain.JobStatusPending
+	job.MaxAttempts = q.config.MaxAttempts
+	if err := q.jobRepo.Create(ctx, job); err != nil {
+		return err
+	}
+	q.Notify()
+	return nil
+}
+
+// EnqueueExclusive queues an exclusive job. When another job of its type is
+// pending or processing, nothing is queued and that job is returned instead.
+// The active job may finish between the conflict and the lookup, in which
+// case queuing is tried again.
+func (q *JobQueue) EnqueueExclusive(ctx context.Context, job *domain.Job) (active *domain.Job, err error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		err := q.Enqueue(ctx, job)
+		if err == nil {
+			return nil, nil
+		}
+		if !errors.Is(err, repository.ErrActiveJobExists) {
+			return nil, fmt.Errorf("failed to create job: %w", err)
+		}
+
+		active, err := q.jobRepo.GetActiveExclusive(ctx, job.Type)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get active job: %w", err)
+		}
+		if active != nil {
+			return active, nil
+		}
+	}
+	return nil, fmt.Errorf("failed to create job: %w", repository.ErrActiveJobExists)
+}
+
+// EnqueueRetry queues a retry built with domain.Job.NewRetry, linking it to
+// its parent job
+func (q *JobQueue) EnqueueRetry(ctx context.Context, retry *domain.Job) error {
+	retry.Status = domain.JobStatusPending
+	retry.MaxAttempts = q.config.MaxAttempts
+	if err := q.jobRepo.CreateRetry(ctx, retry); err != nil {
+		return err
+	}
+	q.Notify()
+	return nil
+}
+
+// Notify wakes an idle worker to look for pending jobs
+func (q *JobQueue) Notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run starts the workers and the reaper that recovers orphaned jobs, and
+// blocks until ctx is done
+func (q *JobQueue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < q.config.Workers; i++ {
+		workerID := fmt.Sprintf("%s-%d-%d", q.hostname, os.Getpid(), i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx, workerID)
+		}()
+	}
+
+	q.reap(ctx)
+	wg.Wait()
+}
+
+// work claims and runs jobs until ctx is done, sleeping while the queue is
+// empty
+func (q *JobQueue) work(ctx context.Context, workerID string) {
+	ticker := time.NewTicker(q.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		job, err := q.jobRepo.Claim(ctx, workerID, q.config.LeaseDuration)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Worker %s failed to claim a job: %v", workerID, err)
+		}
+		if job != nil {
+			q.runJob(workerID, job)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// runJob runs a claimed job while heartbeating its lease, then records the
+// outcome
+func (q *JobQueue) runJob(workerID string, job *domain.Job) {
+	ctx, done := q.tracker.Start(job.ID, q.config.JobTimeout)
+	defer done()
+
+	go q.heartbeat(ctx, workerID, job.ID)
+
+	q.mu.RLock()
+	runner, ok := q.runners[job.Type]
+	q.mu.RUnlock()
+
+	var checkpoint *domain.JobCheckpoint
+	var err error
+	if ok {
+		checkpoint, err = runner(ctx, job)
+	} else {
+		err = permanent(fmt.Errorf("No runner is registered for job type %s", job.Type))
+	}
+
+	q.finish(ctx, job, checkpoint, err)
+}
+
+// heartbeat extends the job's lease until ctx is done. Losing the lease means
+// the job was cancelled or handed to another worker, so the run is stopped.
+func (q *JobQueue) heartbeat(ctx context.Context, workerID string, jobID uuid.UUID) {
+	ticker := time.NewTicker(q.config.LeaseDuration / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := q.jobRepo.Heartbeat(ctx, jobID, workerID, q.config.LeaseDuration)
+		if errors.Is(err, repository.ErrJobNotActive) {
+			q.tracker.Cancel(jobID)
+			return
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to heartbeat job %s: %v", jobID, err)
+		}
+	}
+}
+
+// reap requeues jobs whose lease expired until ctx is done
+func (q *JobQueue) reap(ctx context.Context) {
+	ticker := time.NewTicker(q.config.LeaseDuration / 2)
+	defer ticker.Stop()
+
+	for {
+		recovered, err := q.jobRepo.RequeueExpired(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to requeue orphaned jobs: %v", err)
+		}
+		if len(recovered) > 0 {
+			log.Printf("Recovered %d orphaned jobs", len(recovered))
+			q.Notify()
+		}
+		for _, job := range recovered {
+			if job.Status == domain.JobStatusFailed {
+				q.jobFinished(ctx, job.ID)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// finish records how a job run ended. A cancelled job keeps its status and
+// gets the counters of everything stored before it stopped. A failed run is
+// retried with exponential backoff while the job has attempts left. The
+// job's own context may be done by now, so the outcome is written under a
+// fresh one.
+func (q *JobQueue) finish(jobCtx context.Context, job *domain.Job, checkpoint *domain.JobCheckpoint, runErr error) {
+	ctx, cancel := context.WithTimeout(context.Background(), finishTimeout)
+	defer cancel()
+
+	var permanentErr *permanentError
+	switch {
+	case errors.Is(jobCtx.Err(), context.Canceled) || errors.Is(runErr, repository.ErrJobNotActive):
+		if checkpoint == nil {
+			return
+		}
+		if err := q.jobRepo.SaveCancelledCheckpoint(ctx, job.ID, checkpoint); err != nil && !errors.Is(err, repository.ErrJobNotActive) {
+			log.Printf("Failed to record progress of cancelled job %s: %v", job.ID, err)
+		}
+	case runErr != nil && job.Attempts < job.MaxAttempts && !errors.As(runErr, &permanentErr):
+		runAfter := time.Now().Add(q.retryBackoff(job.Attempts))
+		if err := q.jobRepo.Requeue(ctx, job.ID, runErr.Error(), runAfter); err != nil {
+			log.Printf("Failed to requeue job %s: %v", job.ID, err)
+		}
+	case runErr != nil:
+		q.markFailed(ctx, job.ID, runErr.Error())
+	default:
+		err := q.jobRepo.MarkCompleted(ctx, job.ID)
+		switch {
+		case err == nil:
+			q.jobFinished(ctx, job.ID)
+		case errors.Is(err, repository.ErrJobNotActive):
+			// Cancelled just before it could complete
+		default:
+			q.markFailed(ctx, job.ID, fmt.Sprintf("Failed to mark job as completed: %v", err))
+		}
+	}
+}
+
+func (q *JobQueue) markFailed(ctx context.Context, jobID uuid.UUID, errorMessage string) {
+	err := q.jobRepo.MarkFailed(ctx, jobID, errorMessage)
+	switch {
+	case err == nil:
+		q.jobFinished(ctx, jobID)
+	case !errors.Is(err, repository.ErrJobNotActive):
+		log.Printf("Failed to mark job %s as failed: %v", jobID, err)
+	}
+}
+
+func (q *JobQueue) jobFinished(ctx context.Context, jobID uuid.UUID) {
+	q.mu.RLock()
+	hooks := q.finishedHooks
+	q.mu.RUnlock()
+
+	for _, hook := range hooks {
+		hook(ctx, jobID)
+	}
+}
+
+// retryBackoff is the delay before retrying a job that failed its given
+// attempt
+func (q *JobQueue) retryBackoff(attempt int) time.Duration {
+	backoff := q.config.RetryBackoff
+	for i := 1; i < attempt && backoff < maxQueueRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxQueueRetryBackoff {
+		backoff = maxQueueRetryBackoff
+	}
+	return backoff
+}
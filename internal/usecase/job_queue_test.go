@@ -0,0 +1,91 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/truora/microservice/internal/domain"
+	"github.com/truora/microservice/internal/repository"
+)
+
+// exclusiveJobRepo holds at most one active job, which finishes after being
+// looked up finishAfter times
+type exclusiveJobRepo struct {
+	repository.JobRepository
+	active      *domain.Job
+	finishAfter int
+	lookups     int
+	created     []*domain.Job
+}
+
+func (r *exclusiveJobRepo) Create(ctx context.Context, job *domain.Job) error {
+	if r.active != nil {
+		return repository.ErrActiveJobExists
+	}
+	r.active = job
+	r.created = append(r.created, job)
+	return nil
+}
+
+func (r *exclusiveJobRepo) GetActiveExclusive(ctx context.Context, jobType string) (*domain.Job, error) {
+	r.lookups++
+	if r.lookups > r.finishAfter {
+		r.active = nil
+	}
+	return r.active, nil
+}
+
+func TestEnqueueExclusive(t *testing.T) {
+	running := &domain.Job{ID: uuid.New(), Type: "test_sync", Exclusive: true}
+
+	t.Run("no active job", func(t *testing.T) {
+		repo := &exclusiveJobRepo{}
+		job := &domain.Job{ID: uuid.New(), Type: "test_sync", Exclusive: true}
+		active, err := NewJobQueue(repo, nil, QueueConfig{}).EnqueueExclusive(context.Background(), job)
+		if err != nil || active != nil || len(repo.created) != 1 || job.Status != domain.JobStatusPending {
+			t.Fatalf("got %v, %v with %d jobs created, want the job queued", active, err, len(repo.created))
+		}
+	})
+
+	t.Run("active job", func(t *testing.T) {
+		repo := &exclusiveJobRepo{active: running, finishAfter: 1}
+		job := &domain.Job{ID: uuid.New(), Type: "test_sync", Exclusive: true}
+		active, err := NewJobQueue(repo, nil, QueueConfig{}).EnqueueExclusive(context.Background(), job)
+		if err != nil || active != running || len(repo.created) != 0 {
+			t.Fatalf("got %v, %v with %d jobs created, want the running job", active, err, len(repo.created))
+		}
+	})
+
+	t.Run("active job finishes before the lookup", func(t *testing.T) {
+		repo := &exclusiveJobRepo{active: running}
+		job := &domain.Job{ID: uuid.New(), Type: "test_sync", Exclusive: true}
+		active, err := NewJobQueue(repo, nil, QueueConfig{}).EnqueueExclusive(context.Background(), job)
+		if err != nil || active != nil || len(repo.created) != 1 || repo.created[0] != job {
+			t.Fatalf("got %v, %v with %d jobs created, want the job queued on the second try", active, err, len(repo.created))
+		}
+	})
+}
+
+func TestEnqueueExclusiveGivesUpAfterRepeatedConflicts(t *testing.T) {
+	// Another job takes the slot each time the active one finishes
+	repo := &churningJobRepo{}
+	job := &domain.Job{ID: uuid.New(), Type: "test_sync", Exclusive: true}
+	active, err := NewJobQueue(repo, nil, QueueConfig{}).EnqueueExclusive(context.Background(), job)
+	if active != nil || !errors.Is(err, repository.ErrActiveJobExists) {
+		t.Fatalf("got %v, %v, want ErrActiveJobExists", active, err)
+	}
+}
+
+type churningJobRepo struct {
+	repository.JobRepository
+}
+
+func (churningJobRepo) Create(ctx context.Context, job *domain.Job) error {
+	return repository.ErrActiveJobExists
+}
+
+func (churningJobRepo) GetActiveExclusive(ctx context.Context, jobType string) (*domain.Job, error) {
+	return nil, nil
+}
@@ -0,0 +1,214 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/truora/microservice/internal/domain"
+	"github.com/truora/microservice/internal/dto"
+	"github.com/truora/microservice/internal/repository"
+)
+
+type JobService interface {
+	ListJobs(ctx context.Context, filter *dto.JobFilter, page, pageSize int) (*dto.JobListResponse, error)
+	GetJobSummary(ctx context.Context, filter *dto.JobFilter) (*dto.JobSummaryResponse, error)
+	ListJobErrors(ctx context.Context, jobID uuid.UUID, page, pageSize int) (*dto.JobErrorListResponse, error)
+	CancelJob(ctx context.Context, jobID uuid.UUID) (*domain.Job, error)
+	WatchJob(ctx context.Context, jobID uuid.UUID) (<-chan *domain.JobEvent, error)
+}
+
+// watchPollInterval is how often a watched job is re-read, which covers
+// events missed while the listener was reconnecting
+const watchPollInterval = 15 * time.Second
+
+type jobService struct {
+	jobRepo      repository.JobRepository
+	jobErrorRepo repository.JobErrorRepository
+	tracker      *JobTracker
+	events       *JobEventHub
+}
+
+func NewJobService(jobRepo repository.JobRepository, jobErrorRepo repository.JobErrorRepository, tracker *JobTracker, events *JobEventHub) JobService {
+	return &jobService{
+		jobRepo:      jobRepo,
+		jobErrorRepo: jobErrorRepo,
+		tracker:      tracker,
+		events:       events,
+	}
+}
+
+func (s *jobService) ListJobs(ctx context.Context, filter *dto.JobFilter, page, pageSize int) (*dto.JobListResponse, error) {
+	jobs, err := s.jobRepo.List(ctx, filter, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+
+	totalCount, err := s.jobRepo.Count(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count jobs: %w", err)
+	}
+
+	totalPages := int((totalCount + int64(pageSize) - 1) / int64(pageSize))
+
+	return &dto.JobListResponse{
+		Data:       jobs,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalCount: totalCount,
+		TotalPages: totalPages,
+		HasNext:    page < totalPages,
+		HasPrev:    page > 1,
+	}, nil
+}
+
+func (s *jobService) GetJobSummary(ctx context.Context, filter *dto.JobFilter) (*dto.JobSummaryResponse, error) {
+	stats, err := s.jobRepo.GetStats(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize jobs: %w", err)
+	}
+
+	response := &dto.JobSummaryResponse{Stats: stats}
+	for _, stat := range stats {
+		response.TotalCount += stat.Count
+	}
+	return response, nil
+}
+
+// ListJobErrors returns a page of the items a job failed to store, oldest first
+func (s *jobService) ListJobErrors(ctx context.Context, jobID uuid.UUID, page, pageSize int) (*dto.JobErrorListResponse, error) {
+	job, err := s.jobRepo.GetByID(ctx, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+	if job == nil {
+		return nil, ErrJobNotFound
+	}
+
+	jobErrors, err := s.jobErrorRepo.GetByJobID(ctx, jobID, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job errors: %w", err)
+	}
+
+	totalCount, err := s.jobErrorRepo.CountByJobID(ctx, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count job errors: %w", err)
+	}
+
+	totalPages := int((totalCount + int64(pageSize) - 1) / int64(pageSize))
+
+	return &dto.JobErrorListResponse{
+		Data:       jobErrors,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalCount: totalCount,
+		TotalPages: totalPages,
+		HasNext:    page < totalPages,
+		HasPrev:    page > 1,
+	}, nil
+}
+
+// CancelJob cancels a pending or processing job. A job running in this
+// process stops right away; one running on another replica stops at its next
+// heartbeat or checkpoint. Cancelling a finished job returns it along with
+// ErrJobFinished.
+func (s *jobService) CancelJob(ctx context.Context, jobID uuid.UUID) (*domain.Job, error) {
+	cancelled, err := s.jobRepo.MarkCancelled(ctx, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel job: %w", err)
+	}
+
+	if cancelled {
+		s.tracker.Cancel(jobID)
+	}
+
+	job, err := s.jobRepo.GetByID(ctx, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+	if job == nil {
+		return nil, ErrJobNotFound
+	}
+	if !cancelled {
+		return job, ErrJobFinished
+	}
+	return job, nil
+}
+
+// WatchJob streams the state of a job: first its current state, then every
+// change until it finishes or ctx is done. The channel is closed after the
+// job's final state.
+func (s *jobService) WatchJob(ctx context.Context, jobID uuid.UUID) (<-chan *domain.JobEvent, error) {
+	// Subscribe before reading the job so no change falls in between
+	events, unsubscribe := s.events.Subscribe(jobID)
+
+	job, err := s.jobRepo.GetByID(ctx, jobID)
+	if err != nil {
+		unsubscribe()
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+	if job == nil {
+		unsubscribe()
+		return nil, ErrJobNotFound
+	}
+
+	out := make(chan *domain.JobEvent)
+	go func() {
+		defer close(out)
+		defer unsubscribe()
+
+		ticker := time.NewTicker(watchPollInterval)
+		defer ticker.Stop()
+
+		var last *domain.JobEvent
+		send := func(event *domain.JobEvent) bool {
+			if last != nil && sameProgress(last, event) {
+				return true
+			}
+			select {
+			case out <- event:
+				last = event
+				return !event.Status.IsFinished()
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		if !send(job.Event()) {
+			return
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-events:
+				if !send(event) {
+					return
+				}
+			case <-ticker.C:
+				job, err := s.jobRepo.GetByID(ctx, jobID)
+				if err != nil || job == nil {
+					continue
+				}
+				if !send(job.Event()) {
+					return
+				}
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// sameProgress reports whether two events describe the same status and
+// counters, ignoring timestamps that heartbeats keep moving
+func sameProgress(a, b *domain.JobEvent) bool {
+	return a.Status == b.Status &&
+		a.Progress == b.Progress &&
+		a.TotalItems == b.TotalItems &&
+		a.InsertedItems == b.InsertedItems &&
+		a.UpdatedItems == b.UpdatedItems &&
+		a.UnchangedItems == b.UnchangedItems &&
+		a.RejectedItems == b.RejectedItems
+}
@@ -0,0 +1,49 @@
+package usecase
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// JobTracker holds the cancel functions of the jobs running in this process,
+// so a cancel request can stop the goroutine doing the work
+type JobTracker struct {
+	mu      sync.Mutex
+	cancels map[uuid.UUID]context.CancelFunc
+}
+
+func NewJobTracker() *JobTracker {
+	return &JobTracker{cancels: make(map[uuid.UUID]context.CancelFunc)}
+}
+
+// Start returns the context a job runs under, bounded by timeout. The
+// returned function must be called once the job returns.
+func (t *JobTracker) Start(jobID uuid.UUID, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+
+	t.mu.Lock()
+	t.cancels[jobID] = cancel
+	t.mu.Unlock()
+
+	return ctx, func() {
+		t.mu.Lock()
+		delete(t.cancels, jobID)
+		t.mu.Unlock()
+		cancel()
+	}
+}
+
+// Cancel stops the job if it is running in this process
+func (t *JobTracker) Cancel(jobID uuid.UUID) bool {
+	t.mu.Lock()
+	cancel, ok := t.cancels[jobID]
+	t.mu.Unlock()
+
+	if ok {
+		cancel()
+	}
+	return ok
+}
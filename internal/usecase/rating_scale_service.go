@@ -0,0 +1,62 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/truora/microservice/internal/dto"
+	"github.com/truora/microservice/internal/repository"
+)
+
+type RatingScaleService interface {
+	// Run brings the stored ratings in line with the configured scale once,
+	// backfilling rows stored before normalization or under another mapping
+	Run(ctx context.Context)
+	Renormalize(ctx context.Context) (*dto.RatingNormalizationResult, error)
+	GetUnmappedRatings(ctx context.Context) (*dto.UnmappedRatingsResponse, error)
+}
+
+type ratingScaleService struct {
+	stockRatingRepo repository.StockRatingRepository
+}
+
+func NewRatingScaleService(stockRatingRepo repository.StockRatingRepository) RatingScaleService {
+	return &ratingScaleService{stockRatingRepo: stockRatingRepo}
+}
+
+func (s *ratingScaleService) Run(ctx context.Context) {
+	result, err := s.Renormalize(ctx)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			log.Printf("Rating normalization failed: %v", err)
+		}
+		return
+	}
+	if result.Updated > 0 {
+		log.Printf("Rating normalization updated %d ratings", result.Updated)
+	}
+}
+
+func (s *ratingScaleService) Renormalize(ctx context.Context) (*dto.RatingNormalizationResult, error) {
+	updated, err := s.stockRatingRepo.Renormalize(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to normalize ratings: %w", err)
+	}
+	return &dto.RatingNormalizationResult{Updated: updated}, nil
+}
+
+func (s *ratingScaleService) GetUnmappedRatings(ctx context.Context) (*dto.UnmappedRatingsResponse, error) {
+	ratings, err := s.stockRatingRepo.GetUnmappedRatings(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unmapped ratings: %w", err)
+	}
+	if ratings == nil {
+		ratings = []*dto.UnmappedRating{}
+	}
+	return &dto.UnmappedRatingsResponse{
+		TotalCount: len(ratings),
+		Ratings:    ratings,
+	}, nil
+}
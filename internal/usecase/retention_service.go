@@ -0,0 +1,222 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/truora/microservice/internal/domain"
+	"github.com/truora/microservice/internal/dto"
+	"github.com/truora/microservice/internal/repository"
+)
+
+// RetentionRule keeps finished jobs of one status for MaxAge after they
+// finished. A rule without a JobType covers every type that has no rule of
+// its own for that status.
+type RetentionRule struct {
+	JobType string
+	Status  domain.JobStatus
+	MaxAge  time.Duration
+}
+
+// RetentionConfig controls the janitor that prunes expired jobs
+type RetentionConfig struct {
+	Rules []RetentionRule
+	// Interval is how often the janitor prunes
+	Interval time.Duration
+	// BatchSize caps the jobs removed per statement
+	BatchSize int
+	// Archive copies jobs to jobs_archive before they are deleted
+	Archive bool
+	// KeepLatest lists job types whose latest completed job is never
+	// pruned, as a report is read from it
+	KeepLatest []string
+}
+
+const (
+	defaultRetentionInterval  = time.Hour
+	defaultRetentionBatchSize = 1000
+)
+
+func (c RetentionConfig) withDefaults() RetentionConfig {
+	if c.Interval <= 0 {
+		c.Interval = defaultRetentionInterval
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = defaultRetentionBatchSize
+	}
+	return c
+}
+
+type RetentionService interface {
+	// Run prunes expired jobs every interval until ctx is done
+	Run(ctx context.Context)
+	// Prune removes every expired job now. A dry run only counts them.
+	Prune(ctx context.Context, dryRun bool) (*dto.PruneReport, error)
+}
+
+type retentionService struct {
+	jobRepo repository.JobRepository
+	config  RetentionConfig
+}
+
+func NewRetentionService(jobRepo repository.JobRepository, config RetentionConfig) (RetentionService, error) {
+	seen := make(map[string]struct{}, len(config.Rules))
+	for _, rule := range config.Rules {
+		if !rule.Status.IsFinished() {
+			return nil, fmt.Errorf("invalid retention status %q (must be completed, failed or cancelled)", rule.Status)
+		}
+		if rule.MaxAge <= 0 {
+			return nil, fmt.Errorf("retention rule for %s jobs needs a positive max age", rule.Status)
+		}
+
+		key := rule.JobType + "|" + string(rule.Status)
+		if _, ok := seen[key]; ok {
+			return nil, fmt.Errorf("duplicate retention rule for type %q and status %s", rule.JobType, rule.Status)
+		}
+		seen[key] = struct{}{}
+	}
+
+	return &retentionService{
+		jobRepo: jobRepo,
+		config:  config.withDefaults(),
+	}, nil
+}
+
+func (s *retentionService) Run(ctx context.Context) {
+	if len(s.config.Rules) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		report, err := s.Prune(ctx, false)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("Retention janitor failed: %v", err)
+		} else if report != nil && report.TotalRemoved > 0 {
+			log.Printf("Retention janitor removed %d expired jobs", report.TotalRemoved)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *retentionService) Prune(ctx context.Context, dryRun bool) (*dto.PruneReport, error) {
+	report := &dto.PruneReport{
+		DryRun:   dryRun,
+		Archived: s.config.Archive && !dryRun,
+		Rules:    make([]*dto.PruneRuleResult, 0, len(s.config.Rules)),
+	}
+
+	now := time.Now()
+	for _, rule := range s.config.Rules {
+		criteria := s.criteria(rule, now)
+		ruleResult := &dto.PruneRuleResult{
+			JobType:    rule.JobType,
+			Status:     rule.Status,
+			MaxAgeDays: int(rule.MaxAge / (24 * time.Hour)),
+			OlderThan:  criteria.Before,
+		}
+		report.Rules = append(report.Rules, ruleResult)
+
+		var err error
+		if dryRun {
+			ruleResult.Removed, err = s.jobRepo.CountExpired(ctx, criteria)
+		} else {
+			ruleResult.Removed, err = s.prune(ctx, criteria)
+		}
+		report.TotalRemoved += ruleResult.Removed
+		if err != nil {
+			return report, fmt.Errorf("failed to prune %s jobs: %w", rule.Status, err)
+		}
+	}
+
+	return report, nil
+}
+
+// criteria selects the jobs a rule expires. A rule without a type leaves out
+// the types that have a rule of their own for the same status.
+func (s *retentionService) criteria(rule RetentionRule, now time.Time) *dto.JobRetentionCriteria {
+	criteria := &dto.JobRetentionCriteria{
+		Status:          rule.Status,
+		Before:          now.Add(-rule.MaxAge),
+		Limit:           s.config.BatchSize,
+		KeepLatestTypes: s.config.KeepLatest,
+	}
+	if rule.JobType != "" {
+		criteria.Types = []string{rule.JobType}
+		return criteria
+	}
+
+	for _, other := range s.config.Rules {
+		if other.JobType != "" && other.Status == rule.Status {
+			criteria.ExcludeTypes = append(criteria.ExcludeTypes, other.JobType)
+		}
+	}
+	return criteria
+}
+
+// prune deletes the jobs matching criteria batch by batch, removing the
+// spooled uploads they leave behind
+func (s *retentionService) prune(ctx context.Context, criteria *dto.JobRetentionCriteria) (int64, error) {
+	var removed int64
+	for {
+		jobs, err := s.jobRepo.DeleteExpired(ctx, criteria, s.config.Archive)
+		if err != nil {
+			return removed, err
+		}
+		removed += int64(len(jobs))
+
+		if err := s.removeUploads(ctx, jobs); err != nil {
+			log.Printf("Failed to remove uploads of pruned jobs: %v", err)
+		}
+
+		if len(jobs) < criteria.Limit {
+			return removed, nil
+		}
+	}
+}
+
+// removeUploads removes the spooled uploads of pruned jobs. A retried import
+// shares its upload with the retry, so uploads another job still reads from
+// are kept whichever of the two is pruned first.
+func (s *retentionService) removeUploads(ctx context.Context, jobs []*domain.Job) error {
+	owners := make(map[string]*domain.Job)
+	var paths []string
+	for _, job := range jobs {
+		if job.InputPath == "" {
+			continue
+		}
+		if _, ok := owners[job.InputPath]; !ok {
+			paths = append(paths, job.InputPath)
+		}
+		owners[job.InputPath] = job
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+
+	inUse, err := s.jobRepo.GetInputPathsInUse(ctx, paths)
+	if err != nil {
+		return err
+	}
+	for _, path := range inUse {
+		delete(owners, path)
+	}
+
+	for path, job := range owners {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove upload of pruned job %s: %v", job.ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package usecase
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/truora/microservice/internal/domain"
+	"github.com/truora/microservice/internal/repository"
+)
+
+// remainingJobsRepo reports the input paths of the jobs left after a prune
+type remainingJobsRepo struct {
+	repository.JobRepository
+	remaining []*domain.Job
+}
+
+func (r *remainingJobsRepo) GetInputPathsInUse(ctx context.Context, paths []string) ([]string, error) {
+	var inUse []string
+	for _, path := range paths {
+		for _, job := range r.remaining {
+			if job.InputPath == path {
+				inUse = append(inUse, path)
+				break
+			}
+		}
+	}
+	return inUse, nil
+}
+
+func TestRemoveUploadsKeepsUploadsOfRemainingJobs(t *testing.T) {
+	dir := t.TempDir()
+	shared := filepath.Join(dir, "shared.csv")
+	orphaned := filepath.Join(dir, "orphaned.csv")
+	for _, path := range []string{shared, orphaned} {
+		if err := os.WriteFile(path, []byte("ticker\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The retry of a failed import is pruned while the failed parent stays
+	parentID := uuid.New()
+	parent := &domain.Job{ID: parentID, InputPath: shared}
+	retry := &domain.Job{ID: uuid.New(), InputPath: shared, ParentJobID: &parentID}
+	other := &domain.Job{ID: uuid.New(), InputPath: orphaned}
+
+	s := &retentionService{jobRepo: &remainingJobsRepo{remaining: []*domain.Job{parent}}}
+	if err := s.removeUploads(context.Background(), []*domain.Job{retry, other}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(shared); err != nil {
+		t.Errorf("upload still read by the parent was removed: %v", err)
+	}
+	if _, err := os.Stat(orphaned); !os.IsNotExist(err) {
+		t.Errorf("upload of a pruned job was kept: %v", err)
+	}
+}
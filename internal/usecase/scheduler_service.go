@@ -0,0 +1,192 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/truora/microservice/internal/domain"
+	"github.com/truora/microservice/internal/dto"
+	"github.com/truora/microservice/internal/repository"
+)
+
+// ScheduleConfig describes a periodic sync of one rating source
+type ScheduleConfig struct {
+	Name   string
+	Source string
+	Mode   domain.SyncMode
+	// Cron is a standard five-field cron expression or a descriptor such as @hourly
+	Cron string
+}
+
+type SchedulerService interface {
+	// Run triggers the configured syncs until ctx is done. Only the replica
+	// holding the advisory lock triggers anything.
+	Run(ctx context.Context)
+	GetRuns(ctx context.Context, upcoming, past int) (*dto.ScheduleRunsResponse, error)
+}
+
+type schedule struct {
+	ScheduleConfig
+	spec cron.Schedule
+	next time.Time
+}
+
+type schedulerService struct {
+	syncSvc   SyncService
+	runRepo   repository.ScheduledRunRepository
+	lock      *repository.AdvisoryLock
+	schedules []*schedule
+}
+
+// schedulerTick is how often the scheduler checks for due runs and leadership
+const schedulerTick = 10 * time.Second
+
+func NewSchedulerService(syncSvc SyncService, runRepo repository.ScheduledRunRepository, lock *repository.AdvisoryLock, configs []ScheduleConfig) (SchedulerService, error) {
+	schedules := make([]*schedule, len(configs))
+	seen := make(map[string]struct{}, len(configs))
+	for i, config := range configs {
+		if _, ok := seen[config.Name]; ok {
+			return nil, fmt.Errorf("duplicate schedule %q", config.Name)
+		}
+		seen[config.Name] = struct{}{}
+
+		if config.Mode != domain.SyncModeFull && config.Mode != domain.SyncModeIncremental {
+			return nil, fmt.Errorf("invalid mode %q for schedule %s", config.Mode, config.Name)
+		}
+
+		spec, err := cron.ParseStandard(config.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression for schedule %s: %w", config.Name, err)
+		}
+		schedules[i] = &schedule{ScheduleConfig: config, spec: spec}
+	}
+
+	return &schedulerService{
+		syncSvc:   syncSvc,
+		runRepo:   runRepo,
+		lock:      lock,
+		schedules: schedules,
+	}, nil
+}
+
+func (s *schedulerService) Run(ctx context.Context) {
+	if len(s.schedules) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(schedulerTick)
+	defer ticker.Stop()
+	defer s.lock.Release(context.Background())
+
+	leader := false
+	for {
+		isLeader, err := s.lock.TryAcquire(ctx)
+		if err != nil {
+			log.Printf("Scheduler failed to check leadership: %v", err)
+		}
+
+		switch {
+		case isLeader && !leader:
+			// Slots missed while another replica (or nobody) led are skipped
+			log.Printf("Scheduler acquired leadership")
+			now := time.Now()
+			for _, sched := range s.schedules {
+				sched.next = sched.spec.Next(now)
+			}
+		case !isLeader && leader:
+			log.Printf("Scheduler lost leadership")
+		}
+		leader = isLeader
+
+		if leader {
+			s.triggerDue(ctx, time.Now())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// triggerDue starts a sync for every schedule whose next slot has passed.
+// Claiming the slot first keeps a run from being triggered twice when
+// leadership changes hands mid-slot.
+func (s *schedulerService) triggerDue(ctx context.Context, now time.Time) {
+	for _, sched := range s.schedules {
+		if now.Before(sched.next) {
+			continue
+		}
+
+		slot := sched.next
+		sched.next = sched.spec.Next(now)
+
+		run := &domain.ScheduledRun{
+			Schedule:     sched.Name,
+			Source:       sched.Source,
+			ScheduledFor: slot,
+		}
+		claimed, err := s.runRepo.Claim(ctx, run)
+		if err != nil {
+			log.Printf("Scheduler failed to claim %s run at %s: %v", sched.Name, slot, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		job, err := s.syncSvc.StartSync(ctx, sched.Source, sched.Mode, "")
+		if errors.Is(err, ErrSyncInProgress) {
+			err = fmt.Errorf("skipped: %w (job %s)", err, job.ID)
+		}
+		if err != nil {
+			log.Printf("Scheduler failed to start %s run at %s: %v", sched.Name, slot, err)
+			if err := s.runRepo.SetError(ctx, run.ID, err.Error()); err != nil {
+				log.Printf("Scheduler failed to record error of %s run: %v", sched.Name, err)
+			}
+			continue
+		}
+
+		if err := s.runRepo.SetJob(ctx, run.ID, job.ID); err != nil {
+			log.Printf("Scheduler failed to link %s run to job %s: %v", sched.Name, job.ID, err)
+		}
+	}
+}
+
+func (s *schedulerService) GetRuns(ctx context.Context, upcoming, past int) (*dto.ScheduleRunsResponse, error) {
+	response := &dto.ScheduleRunsResponse{
+		Leader:    s.lock.Held(),
+		Schedules: make([]*dto.ScheduleResponse, len(s.schedules)),
+	}
+
+	now := time.Now()
+	for i, sched := range s.schedules {
+		next := make([]time.Time, 0, upcoming)
+		t := now
+		for j := 0; j < upcoming; j++ {
+			t = sched.spec.Next(t)
+			next = append(next, t)
+		}
+
+		response.Schedules[i] = &dto.ScheduleResponse{
+			Name:     sched.Name,
+			Source:   sched.Source,
+			Mode:     string(sched.Mode),
+			Cron:     sched.Cron,
+			Upcoming: next,
+		}
+	}
+
+	runs, err := s.runRepo.GetRecent(ctx, past)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scheduled runs: %w", err)
+	}
+	response.Past = runs
+
+	return response, nil
+}
@@ -3,9 +3,11 @@ package usecase
 import (
 	"context"
 	"fmt"
+	"log"
 	"sort"
 	"time"
 
+	"github.com/truora/microservice/internal/domain"
 	"github.com/truora/microservice/internal/dto"
 	"github.com/truora/microservice/internal/repository"
 )
@@ -30,7 +32,7 @@ func NewStockAlgorithmService(stockRatingRepo repository.StockRatingRepository)
 // based on target price ranges from analyst ratings
 func (s *stockAlgorithmService) BestTimeToBuyAndSell(ctx context.Context, ticker string, startDate, endDate *time.Time) (*dto.TradingRecommendation, error) {
 	// Get all ratings for the ticker
-	ratings, err := s.stockRatingRepo.GetByTicker(ctx, ticker)
+	ratings, err := s.stockRatingRepo.GetByTicker(ctx, ticker, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get ratings for ticker %s: %w", ticker, err)
 	}
@@ -40,48 +42,16 @@ func (s *stockAlgorithmService) BestTimeToBuyAndSell(ctx context.Context, ticker
 	}
 
 	// Filter by date range if provided
-	var filteredRatings []*dto.StockRatingResponse
-	for _, rating := range ratings {
-		ratingDTO := dto.FromDomain(rating)
-
-		// Apply date filter if provided
-		if startDate != nil && ratingDTO.Time.Before(*startDate) {
-			continue
-		}
-		if endDate != nil && ratingDTO.Time.After(*endDate) {
-			continue
-		}
-
-		filteredRatings = append(filteredRatings, ratingDTO)
-	}
-
+	filteredRatings := filterByDate(ratings, startDate, endDate)
 	if len(filteredRatings) == 0 {
 		return nil, fmt.Errorf("no ratings found for ticker %s in the specified date range", ticker)
 	}
 
-	// Sort by time to ensure chronological order
-	sort.Slice(filteredRatings, func(i, j int) bool {
-		return filteredRatings[i].Time.Before(filteredRatings[j].Time)
-	})
-
-	// Extract target prices and convert to float64
-	var prices []float64
-	var priceData []dto.PricePoint
-
-	for _, rating := range filteredRatings {
-		// Use target_from as the price point
-		if rating.TargetFrom != "" {
-			if price, err := parsePrice(rating.TargetFrom); err == nil {
-				prices = append(prices, price)
-				priceData = append(priceData, dto.PricePoint{
-					Price:     price,
-					Time:      rating.Time,
-					Brokerage: rating.Brokerage,
-					Action:    rating.Action,
-					Rating:    rating.RatingFrom,
-				})
-			}
-		}
+	// Extract the numeric target prices in chronological order
+	priceData, currency := pricePoints(filteredRatings)
+	prices := make([]float64, len(priceData))
+	for i, point := range priceData {
+		prices[i] = point.Price
 	}
 
 	if len(prices) < 2 {
@@ -98,6 +68,7 @@ func (s *stockAlgorithmService) BestTimeToBuyAndSell(ctx context.Context, ticker
 	// Create recommendation
 	recommendation := &dto.TradingRecommendation{
 		Ticker:           ticker,
+		Currency:         currency,
 		BuyPrice:         prices[buyIndex],
 		SellPrice:        prices[sellIndex],
 		MaxProfit:        maxProfit,
@@ -128,7 +99,7 @@ func (s *stockAlgorithmService) BestTimeToBuyAndSellMultiple(ctx context.Context
 		recommendation, err := s.BestTimeToBuyAndSell(ctx, ticker, startDate, endDate)
 		if err != nil {
 			// Log error but continue with other tickers
-			fmt.Printf("Error analyzing ticker %s: %v\n", ticker, err)
+			log.Printf("Failed to analyze ticker %s: %v", ticker, err)
 			continue
 		}
 		recommendations = append(recommendations, recommendation)
@@ -149,15 +120,21 @@ func (s *stockAlgorithmService) BestTimeToBuyAndSellMultiple(ctx context.Context
 // BestTimeToBuyAndSellGlobal analyzes all stock ratings as if they belonged to the same ticker
 // This provides a global market perspective across all available stocks
 func (s *stockAlgorithmService) BestTimeToBuyAndSellGlobal(ctx context.Context, startDate, endDate *time.Time) (*dto.TradingRecommendation, error) {
-	// Get all ratings from the database (we'll need to add a method to get all ratings)
-	// For now, let's use a paginated approach to get all ratings
-	var allRatings []*dto.StockRatingResponse
+	// Walk the ratings of the date range page by page. Keyset pages stay
+	// cheap deep into the table and do not shift while a sync inserts ratings.
+	// The end date is inclusive, and stored times have microsecond precision.
+	filter := &dto.StockRatingFilter{TimeFrom: startDate, SortDesc: true}
+	if endDate != nil {
+		timeTo := endDate.Add(time.Microsecond)
+		filter.TimeTo = &timeTo
+	}
+	var allRatings []*domain.StockRating
+	var cursor *dto.RatingCursor
 	page := 1
 	pageSize := 1000
 
 	for {
-		// Get paginated ratings
-		ratings, err := s.stockRatingRepo.GetPaginated(ctx, (page-1)*pageSize, pageSize)
+		ratings, err := s.stockRatingRepo.GetByCursor(ctx, filter, cursor, pageSize)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get ratings page %d: %w", page, err)
 		}
@@ -166,26 +143,15 @@ func (s *stockAlgorithmService) BestTimeToBuyAndSellGlobal(ctx context.Context,
 			break // No more ratings
 		}
 
-		// Convert to DTOs and filter by date
-		for _, rating := range ratings {
-			ratingDTO := dto.FromDomain(rating)
-
-			// Apply date filter if provided
-			if startDate != nil && ratingDTO.Time.Before(*startDate) {
-				continue
-			}
-			if endDate != nil && ratingDTO.Time.After(*endDate) {
-				continue
-			}
-
-			allRatings = append(allRatings, ratingDTO)
-		}
+		allRatings = append(allRatings, ratings...)
 
 		// If we got fewer ratings than pageSize, we've reached the end
 		if len(ratings) < pageSize {
 			break
 		}
 
+		last := ratings[len(ratings)-1]
+		cursor = &dto.RatingCursor{Time: last.Time, ID: last.ID}
 		page++
 	}
 
@@ -193,30 +159,11 @@ func (s *stockAlgorithmService) BestTimeToBuyAndSellGlobal(ctx context.Context,
 		return nil, fmt.Errorf("no ratings found in the specified date range")
 	}
 
-	// Sort by time to ensure chronological order
-	sort.Slice(allRatings, func(i, j int) bool {
-		return allRatings[i].Time.Before(allRatings[j].Time)
-	})
-
-	// Extract target prices and convert to float64
-	var prices []float64
-	var priceData []dto.PricePoint
-
-	for _, rating := range allRatings {
-		// Use target_from as the price point
-		if rating.TargetFrom != "" {
-			if price, err := parsePrice(rating.TargetFrom); err == nil {
-				prices = append(prices, price)
-				priceData = append(priceData, dto.PricePoint{
-					Price:     price,
-					Time:      rating.Time,
-					Brokerage: rating.Brokerage,
-					Action:    rating.Action,
-					Rating:    rating.RatingFrom,
-					Ticker:    rating.Ticker, // Add ticker information
-				})
-			}
-		}
+	// Extract the numeric target prices in chronological order
+	priceData, currency := pricePoints(allRatings)
+	prices := make([]float64, len(priceData))
+	for i, point := range priceData {
+		prices[i] = point.Price
 	}
 
 	if len(prices) < 2 {
@@ -233,6 +180,7 @@ func (s *stockAlgorithmService) BestTimeToBuyAndSellGlobal(ctx context.Context,
 	// Create recommendation
 	recommendation := &dto.TradingRecommendation{
 		Ticker:           "GLOBAL", // Indicates this is a global analysis
+		Currency:         currency,
 		BuyPrice:         prices[buyIndex],
 		SellPrice:        prices[sellIndex],
 		MaxProfit:        maxProfit,
@@ -290,9 +238,55 @@ func (s *stockAlgorithmService) findBestBuySellPoints(prices []float64) (int, in
 	return buyIndex, sellIndex, maxProfit
 }
 
-// parsePrice converts string price to float64
-func parsePrice(priceStr string) (float64, error) {
-	var price float64
-	_, err := fmt.Sscanf(priceStr, "%f", &price)
-	return price, err
+// filterByDate keeps the ratings published within the optional date range
+func filterByDate(ratings []*domain.StockRating, startDate, endDate *time.Time) []*domain.StockRating {
+	var filtered []*domain.StockRating
+	for _, rating := range ratings {
+		if startDate != nil && rating.Time.Before(*startDate) {
+			continue
+		}
+		if endDate != nil && rating.Time.After(*endDate) {
+			continue
+		}
+		filtered = append(filtered, rating)
+	}
+	return filtered
+}
+
+// pricePoints turns ratings into chronological price points using their
+// numeric target_from. Prices are never compared across currencies: only the
+// currency most ratings are quoted in is kept, and returned.
+func pricePoints(ratings []*domain.StockRating) ([]dto.PricePoint, string) {
+	counts := make(map[string]int)
+	currency := ""
+	for _, rating := range ratings {
+		if rating.TargetFromValue == nil {
+			continue
+		}
+		counts[rating.TargetCurrency]++
+		if counts[rating.TargetCurrency] > counts[currency] {
+			currency = rating.TargetCurrency
+		}
+	}
+
+	var points []dto.PricePoint
+	for _, rating := range ratings {
+		if rating.TargetFromValue == nil || rating.TargetCurrency != currency {
+			continue
+		}
+		points = append(points, dto.PricePoint{
+			Price:     *rating.TargetFromValue,
+			Time:      rating.Time,
+			Brokerage: rating.Brokerage,
+			Action:    rating.Action,
+			Rating:    rating.RatingFrom,
+			Ticker:    rating.Ticker,
+		})
+	}
+
+	// Sort by time to ensure chronological order
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].Time.Before(points[j].Time)
+	})
+	return points, currency
 }
@@ -0,0 +1,75 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/truora/microservice/internal/domain"
+	"github.com/truora/microservice/internal/dto"
+	"github.com/truora/microservice/internal/repository"
+)
+
+// cursorRatingRepo serves ratings in pages and records the filters it got
+type cursorRatingRepo struct {
+	repository.StockRatingRepository
+	ratings []*domain.StockRating
+	filters []*dto.StockRatingFilter
+}
+
+func (r *cursorRatingRepo) GetByCursor(ctx context.Context, filter *dto.StockRatingFilter, cursor *dto.RatingCursor, limit int) ([]*domain.StockRating, error) {
+	r.filters = append(r.filters, filter)
+	start := 0
+	if cursor != nil {
+		for i, rating := range r.ratings {
+			if rating.ID == cursor.ID {
+				start = i + 1
+			}
+		}
+	}
+	end := start + limit
+	if end > len(r.ratings) {
+		end = len(r.ratings)
+	}
+	return r.ratings[start:end], nil
+}
+
+func TestBestTimeToBuyAndSellGlobalBoundsTheScan(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+
+	var ratings []*domain.StockRating
+	for i := 0; i < 1500; i++ {
+		price := float64(100 + i%50)
+		ratings = append(ratings, &domain.StockRating{
+			ID:              uint(i + 1),
+			Ticker:          "AAPL",
+			Time:            start.Add(time.Duration(i) * time.Minute),
+			TargetFromValue: &price,
+			TargetCurrency:  "USD",
+		})
+	}
+	repo := &cursorRatingRepo{ratings: ratings}
+	s := &stockAlgorithmService{stockRatingRepo: repo}
+
+	recommendation, err := s.BestTimeToBuyAndSellGlobal(context.Background(), &start, &end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recommendation.TotalDataPoints != len(ratings) {
+		t.Errorf("analyzed %d points, want %d", recommendation.TotalDataPoints, len(ratings))
+	}
+
+	if len(repo.filters) != 2 {
+		t.Fatalf("read %d pages, want 2", len(repo.filters))
+	}
+	for _, filter := range repo.filters {
+		if filter == nil || filter.TimeFrom == nil || !filter.TimeFrom.Equal(start) {
+			t.Fatalf("scan was not bounded by the start date: %+v", filter)
+		}
+		// The end date is inclusive while TimeTo is exclusive
+		if filter.TimeTo == nil || !filter.TimeTo.After(end) || filter.TimeTo.After(end.Add(time.Millisecond)) {
+			t.Fatalf("scan was not bounded by the end date: %+v", filter)
+		}
+	}
+}
@@ -2,8 +2,9 @@ package usecase
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"time"
+	"log"
 
 	"github.com/google/uuid"
 	"github.com/truora/microservice/internal/domain"
@@ -15,24 +16,52 @@ type StockRatingService interface {
 	CreateStockRating(ctx context.Context, rating *dto.StockRatingResponse) error
 	CreateStockRatingBatch(ctx context.Context, ratings []*dto.StockRatingResponse) error
 	GetStockRatingByID(ctx context.Context, id uint) (*dto.StockRatingResponse, error)
-	GetStockRatingsByTicker(ctx context.Context, ticker string) ([]*dto.StockRatingResponse, error)
+	GetStockRatingsByTicker(ctx context.Context, ticker string, filter *dto.StockRatingFilter) ([]*dto.StockRatingResponse, error)
 	GetLatestStockRatingByTicker(ctx context.Context, ticker string) (*dto.StockRatingResponse, error)
-	GetPaginatedStockRatings(ctx context.Context, page, pageSize int) (*dto.PaginatedResponse, error)
-	GetHello(ctx context.Context) (*domain.Job, error)
+	GetPaginatedStockRatings(ctx context.Context, filter *dto.StockRatingFilter, page, pageSize int) (*dto.PaginatedResponse, error)
+	// GetStockRatingsByCursor returns the page following cursor, or the first
+	// page when cursor is nil
+	GetStockRatingsByCursor(ctx context.Context, filter *dto.StockRatingFilter, cursor *dto.RatingCursor, pageSize int) (*dto.CursorPaginatedResponse, error)
 	GetJobByID(ctx context.Context, jobID uuid.UUID) (*domain.Job, error)
+	// Run brings the parsed targets and action types of the stored ratings
+	// in line with the price parser and the action rules once, backfilling
+	// rows stored before they changed
+	Run(ctx context.Context)
 }
 
 type stockRatingService struct {
 	stockRatingRepo repository.StockRatingRepository
 	jobRepo         repository.JobRepository
-	externalAPIRepo repository.ExternalAPIRepository
 }
 
-func NewStockRatingService(stockRatingRepo repository.StockRatingRepository, jobRepo repository.JobRepository, externalAPIRepo repository.ExternalAPIRepository) StockRatingService {
+func NewStockRatingService(stockRatingRepo repository.StockRatingRepository, jobRepo repository.JobRepository) StockRatingService {
 	return &stockRatingService{
 		stockRatingRepo: stockRatingRepo,
 		jobRepo:         jobRepo,
-		externalAPIRepo: externalAPIRepo,
+	}
+}
+
+func (s *stockRatingService) Run(ctx context.Context) {
+	updated, err := s.stockRatingRepo.ReparseTargets(ctx)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			log.Printf("Price target parsing failed: %v", err)
+		}
+		return
+	}
+	if updated > 0 {
+		log.Printf("Price target parsing updated %d ratings", updated)
+	}
+
+	updated, err = s.stockRatingRepo.ReclassifyActions(ctx)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			log.Printf("Action classification failed: %v", err)
+		}
+		return
+	}
+	if updated > 0 {
+		log.Printf("Action classification updated %d ratings", updated)
 	}
 }
 
@@ -60,8 +89,8 @@ func (s *stockRatingService) GetStockRatingByID(ctx context.Context, id uint) (*
 	return dto.FromDomain(rating), nil
 }
 
-func (s *stockRatingService) GetStockRatingsByTicker(ctx context.Context, ticker string) ([]*dto.StockRatingResponse, error) {
-	ratings, err := s.stockRatingRepo.GetByTicker(ctx, ticker)
+func (s *stockRatingService) GetStockRatingsByTicker(ctx context.Context, ticker string, filter *dto.StockRatingFilter) ([]*dto.StockRatingResponse, error) {
+	ratings, err := s.stockRatingRepo.GetByTicker(ctx, ticker, filter)
 	if err != nil {
 		return nil, err
 	}
@@ -84,18 +113,18 @@ func (s *stockRatingService) GetLatestStockRatingByTicker(ctx context.Context, t
 	return dto.FromDomain(rating), nil
 }
 
-func (s *stockRatingService) GetPaginatedStockRatings(ctx context.Context, page, pageSize int) (*dto.PaginatedResponse, error) {
+func (s *stockRatingService) GetPaginatedStockRatings(ctx context.Context, filter *dto.StockRatingFilter, page, pageSize int) (*dto.PaginatedResponse, error) {
 	// Calculate offset
 	offset := (page - 1) * pageSize
 
 	// Get paginated ratings
-	ratings, err := s.stockRatingRepo.GetPaginated(ctx, offset, pageSize)
+	ratings, err := s.stockRatingRepo.GetPaginated(ctx, filter, offset, pageSize)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get paginated ratings: %w", err)
 	}
 
 	// Get total count
-	totalCount, err := s.stockRatingRepo.GetTotalCount(ctx)
+	totalCount, err := s.stockRatingRepo.GetTotalCount(ctx, filter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get total count: %w", err)
 	}
@@ -122,82 +151,48 @@ func (s *stockRatingService) GetPaginatedStockRatings(ctx context.Context, page,
 	}, nil
 }
 
-func (s *stockRatingService) GetHello(ctx context.Context) (*domain.Job, error) {
-	// Create a new job
-	job := &domain.Job{
-		ID:     uuid.New(),
-		Status: domain.JobStatusPending,
-		Type:   "external_api_sync",
+func (s *stockRatingService) GetStockRatingsByCursor(ctx context.Context, filter *dto.StockRatingFilter, cursor *dto.RatingCursor, pageSize int) (*dto.CursorPaginatedResponse, error) {
+	// One extra rating tells whether there is more beyond this page
+	ratings, err := s.stockRatingRepo.GetByCursor(ctx, filter, cursor, pageSize+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ratings: %w", err)
 	}
 
-	if err := s.jobRepo.Create(ctx, job); err != nil {
-		return nil, fmt.Errorf("failed to create job: %w", err)
+	backward := cursor != nil && cursor.Backward
+	more := len(ratings) > pageSize
+	if more && backward {
+		ratings = ratings[1:]
+	} else if more {
+		ratings = ratings[:pageSize]
 	}
 
-	// Start async processing
-	go s.processExternalAPISync(job.ID)
-
-	return job, nil
-}
-
-func (s *stockRatingService) GetJobByID(ctx context.Context, jobID uuid.UUID) (*domain.Job, error) {
-	return s.jobRepo.GetByID(ctx, jobID)
-}
-
-func (s *stockRatingService) processExternalAPISync(jobID uuid.UUID) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
-	defer cancel()
-
-	// Update job status to processing
-	if err := s.jobRepo.UpdateStatus(ctx, jobID, domain.JobStatusProcessing, 0, 0); err != nil {
-		s.jobRepo.MarkFailed(ctx, jobID, fmt.Sprintf("Failed to update job status: %v", err))
-		return
+	response := &dto.CursorPaginatedResponse{
+		Data:     make([]*dto.StockRatingResponse, len(ratings)),
+		PageSize: pageSize,
 	}
-
-	// Get items from external API
-	items, err := s.externalAPIRepo.GetHello(ctx)
-	if err != nil {
-		s.jobRepo.MarkFailed(ctx, jobID, fmt.Sprintf("Failed to get items from external API: %v", err))
-		return
+	for i, rating := range ratings {
+		response.Data[i] = dto.FromDomain(rating)
 	}
-
-	// Update total items
-	if err := s.jobRepo.UpdateStatus(ctx, jobID, domain.JobStatusProcessing, 0, len(items)); err != nil {
-		s.jobRepo.MarkFailed(ctx, jobID, fmt.Sprintf("Failed to update job progress: %v", err))
-		return
+	if len(ratings) == 0 {
+		return response, nil
 	}
 
-	// Process items in chunks
-	chunkSize := 100
-	totalProcessed := 0
-
-	for i := 0; i < len(items); i += chunkSize {
-		end := i + chunkSize
-		if end > len(items) {
-			end = len(items)
-		}
-
-		chunk := items[i:end]
-		domainItems := make([]*domain.StockRating, len(chunk))
-		for j, item := range chunk {
-			domainItems[j] = item.ToDomain()
-		}
-
-		if err := s.stockRatingRepo.CreateBatch(ctx, domainItems); err != nil {
-			s.jobRepo.MarkFailed(ctx, jobID, fmt.Sprintf("Failed to store chunk %d-%d: %v", i, end, err))
-			return
-		}
-
-		totalProcessed += len(chunk)
-		if err := s.jobRepo.UpdateStatus(ctx, jobID, domain.JobStatusProcessing, totalProcessed, len(items)); err != nil {
-			s.jobRepo.MarkFailed(ctx, jobID, fmt.Sprintf("Failed to update job progress: %v", err))
-			return
-		}
+	// Coming from a page implies there is one on that side
+	response.HasNext = more || backward
+	response.HasPrev = (more && backward) || (cursor != nil && !backward)
+	if response.HasNext {
+		last := ratings[len(ratings)-1]
+		next := (&dto.RatingCursor{Time: last.Time, ID: last.ID}).Encode()
+		response.NextCursor = &next
 	}
-
-	// Mark job as completed
-	if err := s.jobRepo.MarkCompleted(ctx, jobID); err != nil {
-		s.jobRepo.MarkFailed(ctx, jobID, fmt.Sprintf("Failed to mark job as completed: %v", err))
-		return
+	if response.HasPrev {
+		first := ratings[0]
+		prev := (&dto.RatingCursor{Time: first.Time, ID: first.ID, Backward: true}).Encode()
+		response.PrevCursor = &prev
 	}
+	return response, nil
+}
+
+func (s *stockRatingService) GetJobByID(ctx context.Context, jobID uuid.UUID) (*domain.Job, error) {
+	return s.jobRepo.GetByID(ctx, jobID)
 }
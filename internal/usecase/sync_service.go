@@ -0,0 +1,345 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/truora/microservice/internal/domain"
+	"github.com/truora/microservice/internal/dto"
+	"github.com/truora/microservice/internal/repository"
+)
+
+type SyncService interface {
+	ListSources(ctx context.Context) ([]*dto.RatingSourceResponse, error)
+	StartSync(ctx context.Context, source string, mode domain.SyncMode, callbackURL string) (*domain.Job, error)
+	ResumeJob(ctx context.Context, jobID uuid.UUID) (*domain.Job, error)
+	RetryJob(ctx context.Context, jobID uuid.UUID) (*domain.Job, error)
+}
+
+type syncService struct {
+	stockRatingRepo repository.StockRatingRepository
+	jobRepo         repository.JobRepository
+	jobErrorRepo    repository.JobErrorRepository
+	syncStateRepo   repository.SyncStateRepository
+	sources         *repository.RatingSourceRegistry
+	queue           *JobQueue
+	webhookSvc      WebhookService
+}
+
+// NewSyncService creates the service that ingests the configured rating
+// sources and registers the sync job of each source with the queue
+func NewSyncService(stockRatingRepo repository.StockRatingRepository, jobRepo repository.JobRepository, jobErrorRepo repository.JobErrorRepository, syncStateRepo repository.SyncStateRepository, sources *repository.RatingSourceRegistry, queue *JobQueue, webhookSvc WebhookService) SyncService {
+	s := &syncService{
+		stockRatingRepo: stockRatingRepo,
+		jobRepo:         jobRepo,
+		jobErrorRepo:    jobErrorRepo,
+		syncStateRepo:   syncStateRepo,
+		sources:         sources,
+		queue:           queue,
+		webhookSvc:      webhookSvc,
+	}
+	for _, source := range sources.All() {
+		queue.Register(domain.SyncJobType(source.Name()), s.runSync)
+	}
+	return s
+}
+
+func (s *syncService) ListSources(ctx context.Context) ([]*dto.RatingSourceResponse, error) {
+	sources := s.sources.All()
+	responses := make([]*dto.RatingSourceResponse, len(sources))
+	for i, source := range sources {
+		state, err := s.syncStateRepo.Get(ctx, source.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to load sync state for %s: %w", source.Name(), err)
+		}
+
+		responses[i] = &dto.RatingSourceResponse{
+			Name:    source.Name(),
+			Kind:    source.Kind(),
+			JobType: domain.SyncJobType(source.Name()),
+		}
+		if state != nil {
+			responses[i].HighWaterMark = state.HighWaterMark
+		}
+	}
+	return responses, nil
+}
+
+// StartSync queues a sync of source. A non-empty callbackURL is notified
+// through a signed webhook once the job completes or fails. Only one sync of
+// a source runs at a time: while one is pending or processing, StartSync
+// returns that job along with ErrSyncInProgress.
+func (s *syncService) StartSync(ctx context.Context, source string, mode domain.SyncMode, callbackURL string) (*domain.Job, error) {
+	if _, ok := s.sources.Get(source); !ok {
+		return nil, ErrSourceNotFound
+	}
+	if callbackURL != "" {
+		if err := s.webhookSvc.ValidateCallbackURL(ctx, callbackURL); err != nil {
+			return nil, err
+		}
+	}
+
+	// Incremental syncs only ingest ratings newer than the stored mark
+	var since *time.Time
+	if mode == domain.SyncModeIncremental {
+		state, err := s.syncStateRepo.Get(ctx, source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load sync state: %w", err)
+		}
+		if state != nil {
+			since = state.HighWaterMark
+		}
+	}
+
+	// Create a new job
+	job := &domain.Job{
+		ID:          uuid.New(),
+		Status:      domain.JobStatusPending,
+		Type:        domain.SyncJobType(source),
+		Source:      source,
+		Mode:        mode,
+		Since:       since,
+		CallbackURL: callbackURL,
+		Exclusive:   true,
+	}
+
+	// Queue the job for the worker pool
+	active, err := s.queue.EnqueueExclusive(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+	if active != nil {
+		return active, ErrSyncInProgress
+	}
+
+	return job, nil
+}
+
+// ResumeJob restarts a failed or cancelled sync job from its last saved
+// checkpoint. Like StartSync, it returns the active job of the same type with
+// ErrSyncInProgress when another sync of the source is running.
+func (s *syncService) ResumeJob(ctx context.Context, jobID uuid.UUID) (*domain.Job, error) {
+	job, err := s.jobRepo.GetByID(ctx, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+	if job == nil {
+		return nil, ErrJobNotFound
+	}
+	if job.Status != domain.JobStatusFailed && job.Status != domain.JobStatusCancelled {
+		return nil, ErrJobNotResumable
+	}
+	// Its retry carries on from the same checkpoint
+	if job.ChildJobID != nil {
+		return nil, ErrJobRetried
+	}
+
+	// A resumed job gets a fresh set of attempts, and is notified again when
+	// it finishes
+	job.Status = domain.JobStatusPending
+	job.NotifiedAt = nil
+	job.ErrorMessage = nil
+	job.Attempts = 0
+	job.RunAfter = nil
+	if err := s.jobRepo.Update(ctx, job); err != nil {
+		if errors.Is(err, repository.ErrActiveJobExists) {
+			return s.activeSync(ctx, job.Type)
+		}
+		return nil, fmt.Errorf("failed to update job: %w", err)
+	}
+
+	s.queue.Notify()
+
+	return job, nil
+}
+
+// RetryJob queues a new job that repeats a failed or cancelled one with the
+// same parameters. The retry continues from the parent's checkpoint and
+// carries its counters over, so its result covers the whole chain. A job can
+// be retried once; the response of a second attempt is the existing child
+// along with ErrJobRetried.
+func (s *syncService) RetryJob(ctx context.Context, jobID uuid.UUID) (*domain.Job, error) {
+	job, err := s.jobRepo.GetByID(ctx, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+	if job == nil {
+		return nil, ErrJobNotFound
+	}
+	if job.Status != domain.JobStatusFailed && job.Status != domain.JobStatusCancelled {
+		return nil, ErrJobNotRetryable
+	}
+	if job.ChildJobID != nil {
+		return s.retryOf(ctx, job)
+	}
+
+	retry := job.NewRetry()
+	if err := s.queue.EnqueueRetry(ctx, retry); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrActiveJobExists):
+			return s.activeSync(ctx, job.Type)
+		case errors.Is(err, repository.ErrJobAlreadyRetried):
+			return s.retryOf(ctx, job)
+		}
+		return nil, fmt.Errorf("failed to create job: %w", err)
+	}
+
+	return retry, nil
+}
+
+// retryOf returns the child of an already retried job along with ErrJobRetried
+func (s *syncService) retryOf(ctx context.Context, job *domain.Job) (*domain.Job, error) {
+	child, err := s.jobRepo.GetByParentID(ctx, job.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get retry job: %w", err)
+	}
+	if child == nil {
+		return nil, fmt.Errorf("failed to get retry job: %w", ErrJobNotFound)
+	}
+	return child, ErrJobRetried
+}
+
+// activeSync returns the in-flight sync of jobType along with
+// ErrSyncInProgress, once storing another pending job of that type failed
+func (s *syncService) activeSync(ctx context.Context, jobType string) (*domain.Job, error) {
+	active, err := s.jobRepo.GetActiveExclusive(ctx, jobType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get active job: %w", err)
+	}
+	if active == nil {
+		return nil, fmt.Errorf("failed to queue job: %w", repository.ErrActiveJobExists)
+	}
+	return active, ErrSyncInProgress
+}
+
+// runSync stores the job's source page by page, checkpointing the job after
+// each one. It starts from the job's saved cursor and counters, so the same
+// code runs fresh, retried and resumed jobs.
+func (s *syncService) runSync(ctx context.Context, job *domain.Job) (*domain.JobCheckpoint, error) {
+	source, ok := s.sources.Get(job.Source)
+	if !ok {
+		return nil, permanent(fmt.Errorf("Rating source %q is not configured", job.Source))
+	}
+
+	checkpoint := job.Checkpoint()
+
+	err := source.ForEachPage(ctx, job.Cursor, job.Since, func(page *repository.Page) error {
+		// The page is counted on a copy that only replaces the checkpoint once
+		// it is saved with the page's cursor. A run stopped mid-page then
+		// reports the counters of the cursor it resumes from, and the page is
+		// not counted twice.
+		next := *checkpoint
+		next.Pages++
+		if err := s.storePage(ctx, job, page.Items, &next); err != nil {
+			return err
+		}
+		if err := s.recordMalformed(ctx, job, page.Malformed, &next); err != nil {
+			return err
+		}
+		next.Skipped += page.Skipped
+
+		next.Cursor = page.NextPage
+		if err := s.jobRepo.SaveCheckpoint(ctx, job.ID, &next); err != nil {
+			return fmt.Errorf("failed to save checkpoint: %w", err)
+		}
+		*checkpoint = next
+		return nil
+	})
+	if err != nil {
+		return checkpoint, fmt.Errorf("Failed to sync %s after %d items: %w", job.Source, checkpoint.Progress, err)
+	}
+
+	// Advance the mark only once every page has been stored
+	if err := s.saveHighWaterMark(ctx, job.Source, checkpoint.LatestItemTime); err != nil {
+		return checkpoint, fmt.Errorf("Failed to save sync state: %w", err)
+	}
+
+	return checkpoint, nil
+}
+
+// storePage upserts one page in chunks, stamping each rating with the job
+// that ingested it, and folds the outcome into the checkpoint
+func (s *syncService) storePage(ctx context.Context, job *domain.Job, items []*dto.StockRatingResponse, checkpoint *domain.JobCheckpoint) error {
+	chunkSize := 100
+
+	for i := 0; i < len(items); i += chunkSize {
+		end := i + chunkSize
+		if end > len(items) {
+			end = len(items)
+		}
+
+		chunk := items[i:end]
+		domainItems := make([]*domain.StockRating, len(chunk))
+		for j, item := range chunk {
+			domainItems[j] = item.ToDomain()
+			domainItems[j].Source = job.Source
+			domainItems[j].SourceJobID = &job.ID
+
+			if checkpoint.LatestItemTime == nil || item.Time.After(*checkpoint.LatestItemTime) {
+				t := item.Time
+				checkpoint.LatestItemTime = &t
+			}
+		}
+
+		// Upsert on the natural key so re-running a sync never duplicates rows
+		result, err := s.stockRatingRepo.UpsertBatch(ctx, domainItems)
+		if err != nil {
+			return fmt.Errorf("failed to store chunk %d-%d: %w", i, end, err)
+		}
+		checkpoint.Result.Add(result)
+		checkpoint.Progress += len(chunk)
+	}
+
+	return nil
+}
+
+// recordMalformed logs the items of the current page that failed validation
+// as job errors and counts them as rejected
+func (s *syncService) recordMalformed(ctx context.Context, job *domain.Job, items []*repository.MalformedItem, checkpoint *domain.JobCheckpoint) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	jobErrors := make([]*domain.JobError, len(items))
+	for i, item := range items {
+		jobErrors[i] = &domain.JobError{
+			JobID:      job.ID,
+			Page:       checkpoint.Pages,
+			Line:       item.Line,
+			Reason:     item.Reason,
+			RawPayload: item.Raw,
+		}
+	}
+	if err := s.jobErrorRepo.CreateBatch(ctx, jobErrors); err != nil {
+		return fmt.Errorf("failed to record malformed items: %w", err)
+	}
+
+	checkpoint.Rejected += len(items)
+	checkpoint.Progress += len(items)
+	return nil
+}
+
+// saveHighWaterMark records the newest rating time ingested from a source,
+// never moving the mark backwards
+func (s *syncService) saveHighWaterMark(ctx context.Context, source string, latest *time.Time) error {
+	if latest == nil {
+		return nil
+	}
+
+	state, err := s.syncStateRepo.Get(ctx, source)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		state = &domain.SyncState{Source: source}
+	}
+	if state.HighWaterMark != nil && !latest.After(*state.HighWaterMark) {
+		return nil
+	}
+
+	state.HighWaterMark = latest
+	return s.syncStateRepo.Save(ctx, state)
+}
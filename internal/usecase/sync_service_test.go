@@ -0,0 +1,149 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/truora/microservice/internal/domain"
+	"github.com/truora/microservice/internal/dto"
+	"github.com/truora/microservice/internal/repository"
+)
+
+// pagedSource serves fixed pages keyed by their cursor
+type pagedSource struct {
+	pages map[string]*repository.Page
+}
+
+func (s *pagedSource) Name() string { return "test" }
+func (s *pagedSource) Kind() string { return "test" }
+
+func (s *pagedSource) ForEachPage(ctx context.Context, cursor string, since *time.Time, handle repository.PageHandler) error {
+	for {
+		page, ok := s.pages[cursor]
+		if !ok {
+			return fmt.Errorf("unknown cursor %q", cursor)
+		}
+		if err := handle(page); err != nil {
+			return err
+		}
+		if page.NextPage == "" {
+			return nil
+		}
+		cursor = page.NextPage
+	}
+}
+
+// cancellingRatingRepo stores every batch, except that the batch numbered
+// cancelAt (counting from 1) fails as if the job had been cancelled
+type cancellingRatingRepo struct {
+	repository.StockRatingRepository
+	batches  int
+	cancelAt int
+}
+
+func (r *cancellingRatingRepo) UpsertBatch(ctx context.Context, ratings []*domain.StockRating) (*domain.UpsertResult, error) {
+	r.batches++
+	if r.batches == r.cancelAt {
+		return nil, context.Canceled
+	}
+	return &domain.UpsertResult{Inserted: len(ratings)}, nil
+}
+
+// checkpointJobRepo keeps the last checkpoint saved
+type checkpointJobRepo struct {
+	repository.JobRepository
+	saved *domain.JobCheckpoint
+}
+
+func (r *checkpointJobRepo) SaveCheckpoint(ctx context.Context, id uuid.UUID, checkpoint *domain.JobCheckpoint) error {
+	saved := *checkpoint
+	r.saved = &saved
+	return nil
+}
+
+type memorySyncStateRepo struct {
+	repository.SyncStateRepository
+	state *domain.SyncState
+}
+
+func (r *memorySyncStateRepo) Get(ctx context.Context, source string) (*domain.SyncState, error) {
+	return r.state, nil
+}
+
+func (r *memorySyncStateRepo) Save(ctx context.Context, state *domain.SyncState) error {
+	r.state = state
+	return nil
+}
+
+func ratingItems(n int, start time.Time) []*dto.StockRatingResponse {
+	items := make([]*dto.StockRatingResponse, n)
+	for i := range items {
+		items[i] = &dto.StockRatingResponse{
+			Ticker: "AAPL",
+			Action: "upgraded by",
+			Time:   start.Add(time.Duration(i) * time.Minute),
+		}
+	}
+	return items
+}
+
+func TestRunSyncCancelledMidPageResumesWithoutDoubleCounting(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := &pagedSource{pages: map[string]*repository.Page{
+		"":   {Items: ratingItems(3, start), NextPage: "p2"},
+		"p2": {Items: ratingItems(150, start.Add(time.Hour)), Skipped: 2},
+	}}
+	registry, err := repository.NewRatingSourceRegistry(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The second page is stored in two chunks; the second one is cancelled
+	ratingRepo := &cancellingRatingRepo{cancelAt: 3}
+	jobRepo := &checkpointJobRepo{}
+	s := &syncService{
+		stockRatingRepo: ratingRepo,
+		jobRepo:         jobRepo,
+		syncStateRepo:   &memorySyncStateRepo{},
+		sources:         registry,
+	}
+
+	job := &domain.Job{ID: uuid.New(), Source: "test"}
+	checkpoint, err := s.runSync(context.Background(), job)
+	if err == nil {
+		t.Fatal("expected the cancelled run to fail")
+	}
+	if checkpoint.Progress != 3 || checkpoint.Pages != 1 || checkpoint.Cursor != "p2" || checkpoint.Result.Inserted != 3 {
+		t.Fatalf("cancelled run reported %+v, want the counters of the first page", checkpoint)
+	}
+	if *jobRepo.saved != *checkpoint {
+		t.Fatalf("cancelled run reported %+v, but %+v was saved", checkpoint, jobRepo.saved)
+	}
+
+	// Resume from what the queue records for a cancelled job
+	job.Cursor = checkpoint.Cursor
+	job.LatestItemTime = checkpoint.LatestItemTime
+	job.Progress = checkpoint.Progress
+	job.Pages = checkpoint.Pages
+	job.RejectedItems = checkpoint.Rejected
+	job.SkippedItems = checkpoint.Skipped
+	job.InsertedItems = checkpoint.Result.Inserted
+
+	checkpoint, err = s.runSync(context.Background(), job)
+	if err != nil {
+		t.Fatalf("resumed run failed: %v", err)
+	}
+	if checkpoint.Progress != 153 || checkpoint.Result.Inserted != 153 {
+		t.Errorf("resumed run counted %d items (%d inserted), want 153", checkpoint.Progress, checkpoint.Result.Inserted)
+	}
+	if checkpoint.Pages != 2 || checkpoint.Skipped != 2 {
+		t.Errorf("resumed run counted %d pages and %d skipped, want 2 and 2", checkpoint.Pages, checkpoint.Skipped)
+	}
+	want := start.Add(time.Hour + 149*time.Minute)
+	if checkpoint.LatestItemTime == nil || !checkpoint.LatestItemTime.Equal(want) {
+		t.Errorf("latest item time is %v, want %v", checkpoint.LatestItemTime, want)
+	}
+}
@@ -0,0 +1,461 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/truora/microservice/internal/domain"
+	"github.com/truora/microservice/internal/dto"
+	"github.com/truora/microservice/internal/repository"
+)
+
+const (
+	// webhookSignatureHeader carries the hex HMAC-SHA256 of
+	// "<timestamp>.<body>", prefixed with "sha256="
+	webhookSignatureHeader = "X-Webhook-Signature"
+	// webhookTimestampHeader carries the Unix time the request was signed at
+	webhookTimestampHeader = "X-Webhook-Timestamp"
+	webhookEventHeader     = "X-Webhook-Event"
+	webhookDeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// WebhookConfig controls webhook delivery. Zero values fall back to the
+// defaults below, except Secret: without it webhooks are disabled.
+type WebhookConfig struct {
+	// Secret is the HMAC key payloads are signed with
+	Secret string
+	// AllowedHosts may receive webhooks even though they resolve to
+	// loopback, private or link-local addresses
+	AllowedHosts []string
+	// Timeout bounds a single delivery attempt
+	Timeout time.Duration
+	// MaxAttempts is the number of attempts before a delivery is given up
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// PollInterval is how often dispatchers look for due deliveries
+	PollInterval time.Duration
+}
+
+const (
+	defaultWebhookTimeout        = 10 * time.Second
+	defaultWebhookMaxAttempts    = 8
+	defaultWebhookInitialBackoff = 10 * time.Second
+	defaultWebhookMaxBackoff     = time.Hour
+	defaultWebhookPollInterval   = 5 * time.Second
+	webhookBatchSize             = 20
+	// Finished jobs are left to their own hook for webhookReconcileDelay
+	// before the reconciler queues their webhooks, and given up on once they
+	// finished more than webhookReconcileWindow ago
+	webhookReconcileDelay  = time.Minute
+	webhookReconcileWindow = 24 * time.Hour
+)
+
+// sharedAddressSpace is the carrier-grade NAT range, which IsPrivate leaves out
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func (c WebhookConfig) withDefaults() WebhookConfig {
+	if c.Timeout <= 0 {
+		c.Timeout = defaultWebhookTimeout
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = defaultWebhookMaxAttempts
+	}
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = defaultWebhookInitialBackoff
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = defaultWebhookMaxBackoff
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = defaultWebhookPollInterval
+	}
+	return c
+}
+
+type WebhookService interface {
+	CreateSubscription(ctx context.Context, request *dto.WebhookSubscriptionRequest) (*domain.WebhookSubscription, error)
+	ListSubscriptions(ctx context.Context) ([]*domain.WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, id uint) error
+	GetDeliveries(ctx context.Context, jobID uuid.UUID) ([]*domain.WebhookDelivery, error)
+	// ValidateCallbackURL checks that raw may receive the webhooks of a job
+	ValidateCallbackURL(ctx context.Context, raw string) error
+	// Run delivers queued webhooks until ctx is done
+	Run(ctx context.Context)
+}
+
+type webhookService struct {
+	jobRepo      repository.JobRepository
+	webhookRepo  repository.WebhookRepository
+	httpClient   *http.Client
+	config       WebhookConfig
+	allowedHosts map[string]bool
+	wake         chan struct{}
+}
+
+// NewWebhookService creates the webhook service and hooks it into the queue,
+// so every job that completes or fails queues a delivery to its callback URL
+// and to the matching subscriptions. Without a secret the service refuses
+// callback URLs and subscriptions and delivers nothing.
+func NewWebhookService(jobRepo repository.JobRepository, webhookRepo repository.WebhookRepository, queue *JobQueue, config WebhookConfig) WebhookService {
+	config = config.withDefaults()
+	s := &webhookService{
+		jobRepo:      jobRepo,
+		webhookRepo:  webhookRepo,
+		config:       config,
+		allowedHosts: make(map[string]bool, len(config.AllowedHosts)),
+		wake:         make(chan struct{}, 1),
+	}
+	for _, host := range config.AllowedHosts {
+		s.allowedHosts[strings.ToLower(host)] = true
+	}
+
+	// Deliveries bypass proxies and only dial addresses lookup accepted, so
+	// a host cannot be rebound to an internal address once it was validated
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = s.dialContext
+	s.httpClient = &http.Client{Timeout: config.Timeout, Transport: transport}
+
+	if config.Secret != "" {
+		queue.OnFinished(s.jobFinished)
+	}
+	return s
+}
+
+func (s *webhookService) CreateSubscription(ctx context.Context, request *dto.WebhookSubscriptionRequest) (*domain.WebhookSubscription, error) {
+	if err := s.ValidateCallbackURL(ctx, request.URL); err != nil {
+		return nil, err
+	}
+
+	subscription := &domain.WebhookSubscription{
+		URL:     request.URL,
+		JobType: request.JobType,
+	}
+	if err := s.webhookRepo.CreateSubscription(ctx, subscription); err != nil {
+		return nil, fmt.Errorf("failed to create subscription: %w", err)
+	}
+	return subscription, nil
+}
+
+func (s *webhookService) ListSubscriptions(ctx context.Context) ([]*domain.WebhookSubscription, error) {
+	return s.webhookRepo.ListSubscriptions(ctx)
+}
+
+func (s *webhookService) DeleteSubscription(ctx context.Context, id uint) error {
+	deleted, err := s.webhookRepo.DeleteSubscription(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete subscription: %w", err)
+	}
+	if !deleted {
+		return ErrSubscriptionNotFound
+	}
+	return nil
+}
+
+func (s *webhookService) GetDeliveries(ctx context.Context, jobID uuid.UUID) ([]*domain.WebhookDelivery, error) {
+	job, err := s.jobRepo.GetByID(ctx, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+	if job == nil {
+		return nil, ErrJobNotFound
+	}
+	return s.webhookRepo.GetDeliveriesByJobID(ctx, jobID)
+}
+
+// ValidateCallbackURL accepts absolute http and https URLs whose host only
+// resolves to public addresses, or is one of the allowed hosts. It returns
+// ErrWebhooksDisabled when no secret is configured.
+func (s *webhookService) ValidateCallbackURL(ctx context.Context, raw string) error {
+	if s.config.Secret == "" {
+		return ErrWebhooksDisabled
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return ErrInvalidCallbackURL
+	}
+	_, err = s.lookup(ctx, parsed.Hostname())
+	return err
+}
+
+func (s *webhookService) jobFinished(ctx context.Context, jobID uuid.UUID) {
+	if err := s.notify(ctx, jobID); err != nil {
+		log.Printf("Failed to queue webhooks for job %s: %v", jobID, err)
+	}
+}
+
+// notify queues one delivery of the finished job per target URL, unless
+// they were queued already. The payload is rendered now, so retries send
+// exactly the same body.
+func (s *webhookService) notify(ctx context.Context, jobID uuid.UUID) error {
+	job, err := s.jobRepo.GetByID(ctx, jobID)
+	if err != nil {
+		return fmt.Errorf("failed to load job: %w", err)
+	}
+	if job == nil {
+		return nil
+	}
+
+	subscriptions, err := s.webhookRepo.GetSubscriptionsForJobType(ctx, job.Type)
+	if err != nil {
+		return fmt.Errorf("failed to load subscriptions: %w", err)
+	}
+
+	// A job without targets is still marked as notified
+	var deliveries []*domain.WebhookDelivery
+	if job.CallbackURL != "" || len(subscriptions) > 0 {
+		deliveries, err = newDeliveries(job, subscriptions)
+		if err != nil {
+			return err
+		}
+	}
+
+	queued, err := s.webhookRepo.QueueDeliveries(ctx, job.ID, deliveries)
+	if err != nil {
+		return fmt.Errorf("failed to store deliveries: %w", err)
+	}
+	if queued && len(deliveries) > 0 {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// newDeliveries renders the deliveries of a finished job to its callback URL
+// and to subscriptions
+func newDeliveries(job *domain.Job, subscriptions []*domain.WebhookSubscription) ([]*domain.WebhookDelivery, error) {
+	event := domain.WebhookEvent(job.Status)
+	payload, err := json.Marshal(&dto.WebhookPayload{Event: event, Job: job})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render payload: %w", err)
+	}
+
+	var deliveries []*domain.WebhookDelivery
+	newDelivery := func(url string, subscriptionID *uint) *domain.WebhookDelivery {
+		return &domain.WebhookDelivery{
+			JobID:          job.ID,
+			SubscriptionID: subscriptionID,
+			URL:            url,
+			Event:          event,
+			Payload:        string(payload),
+			Status:         domain.WebhookDeliveryPending,
+			NextAttemptAt:  time.Now(),
+		}
+	}
+	if job.CallbackURL != "" {
+		deliveries = append(deliveries, newDelivery(job.CallbackURL, nil))
+	}
+	for _, subscription := range subscriptions {
+		id := subscription.ID
+		deliveries = append(deliveries, newDelivery(subscription.URL, &id))
+	}
+	return deliveries, nil
+}
+
+func (s *webhookService) Run(ctx context.Context) {
+	if s.config.Secret == "" {
+		return
+	}
+
+	ticker := time.NewTicker(s.config.PollInterval)
+	defer ticker.Stop()
+	reconcileTicker := time.NewTicker(webhookReconcileDelay)
+	defer reconcileTicker.Stop()
+
+	for {
+		s.dispatchDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		case <-ticker.C:
+		case <-reconcileTicker.C:
+			s.reconcile(ctx)
+		}
+	}
+}
+
+// reconcile queues the webhooks of jobs that finished without them, as when
+// the replica that finished a job died before its hook ran
+func (s *webhookService) reconcile(ctx context.Context) {
+	now := time.Now()
+	for {
+		jobIDs, err := s.webhookRepo.GetUnnotifiedJobIDs(ctx, now.Add(-webhookReconcileWindow), now.Add(-webhookReconcileDelay), webhookBatchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Failed to look for jobs without webhooks: %v", err)
+			}
+			return
+		}
+
+		for _, jobID := range jobIDs {
+			if err := s.notify(ctx, jobID); err != nil {
+				log.Printf("Failed to queue webhooks for job %s: %v", jobID, err)
+				return
+			}
+		}
+		if len(jobIDs) < webhookBatchSize {
+			return
+		}
+	}
+}
+
+// dispatchDue sends every due delivery, batch by batch. Deliveries are
+// claimed for twice the request timeout, which is plenty for one attempt.
+func (s *webhookService) dispatchDue(ctx context.Context) {
+	for {
+		deliveries, err := s.webhookRepo.ClaimDueDeliveries(ctx, webhookBatchSize, 2*s.config.Timeout)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Failed to claim webhook deliveries: %v", err)
+			}
+			return
+		}
+
+		for _, delivery := range deliveries {
+			s.deliver(ctx, delivery)
+		}
+		if len(deliveries) < webhookBatchSize {
+			return
+		}
+	}
+}
+
+// deliver makes one attempt and records its outcome, scheduling a retry
+// with exponential backoff until the attempts run out
+func (s *webhookService) deliver(ctx context.Context, delivery *domain.WebhookDelivery) {
+	statusCode, err := s.send(ctx, delivery)
+	if err == nil {
+		if err := s.webhookRepo.MarkDelivered(ctx, delivery.ID, statusCode); err != nil {
+			log.Printf("Failed to record webhook delivery %d: %v", delivery.ID, err)
+		}
+		return
+	}
+
+	var code *int
+	if statusCode != 0 {
+		code = &statusCode
+	}
+	var nextAttemptAt *time.Time
+	if delivery.Attempts < s.config.MaxAttempts {
+		next := time.Now().Add(s.backoff(delivery.Attempts))
+		nextAttemptAt = &next
+	}
+	if err := s.webhookRepo.MarkAttemptFailed(ctx, delivery.ID, code, err.Error(), nextAttemptAt); err != nil {
+		log.Printf("Failed to record webhook attempt %d: %v", delivery.ID, err)
+	}
+}
+
+// send POSTs the signed payload. Any 2xx response counts as delivered.
+func (s *webhookService) send(ctx context.Context, delivery *domain.WebhookDelivery) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewBufferString(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, delivery.Event)
+	req.Header.Set(webhookDeliveryHeader, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(webhookSignatureHeader, "sha256="+signWebhook(s.config.Secret, timestamp, []byte(delivery.Payload)))
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook endpoint returned status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff is the delay before retrying a delivery that failed its given
+// attempt
+func (s *webhookService) backoff(attempt int) time.Duration {
+	backoff := s.config.InitialBackoff
+	for i := 1; i < attempt && backoff < s.config.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > s.config.MaxBackoff {
+		backoff = s.config.MaxBackoff
+	}
+	return backoff
+}
+
+// signWebhook returns the hex HMAC-SHA256 of "<timestamp>.<body>" under
+// secret, as sent in webhookSignatureHeader
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// lookup resolves the host of a webhook URL. Hosts resolving to any
+// loopback, private, link-local or otherwise internal address are refused
+// with ErrInvalidCallbackURL unless they are allowed by the configuration.
+func (s *webhookService) lookup(ctx context.Context, host string) ([]net.IP, error) {
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCallbackURL, err)
+	}
+	if s.allowedHosts[strings.ToLower(host)] {
+		return ips, nil
+	}
+	for _, ip := range ips {
+		if !isPublicIP(ip) {
+			return nil, fmt.Errorf("%w: %s resolves to %s", ErrInvalidCallbackURL, host, ip)
+		}
+	}
+	return ips, nil
+}
+
+// dialContext connects to the first reachable address lookup accepts for
+// the host of addr
+func (s *webhookService) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := s.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var dialer net.Dialer
+	for _, ip := range ips {
+		var conn net.Conn
+		conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+func isPublicIP(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddressSpace.Contains(ip)
+}
@@ -0,0 +1,175 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/truora/microservice/internal/domain"
+	"github.com/truora/microservice/internal/dto"
+	"github.com/truora/microservice/internal/repository"
+)
+
+type finishedJobRepo struct {
+	repository.JobRepository
+	jobs map[uuid.UUID]*domain.Job
+}
+
+func (r *finishedJobRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Job, error) {
+	return r.jobs[id], nil
+}
+
+// memoryWebhookRepo queues the deliveries of a job once, like the notified_at
+// claim of the real repository
+type memoryWebhookRepo struct {
+	repository.WebhookRepository
+	subscriptions []*domain.WebhookSubscription
+	notified      map[uuid.UUID]bool
+	unnotified    []uuid.UUID
+	deliveries    []*domain.WebhookDelivery
+}
+
+func (r *memoryWebhookRepo) GetSubscriptionsForJobType(ctx context.Context, jobType string) ([]*domain.WebhookSubscription, error) {
+	return r.subscriptions, nil
+}
+
+func (r *memoryWebhookRepo) QueueDeliveries(ctx context.Context, jobID uuid.UUID, deliveries []*domain.WebhookDelivery) (bool, error) {
+	if r.notified[jobID] {
+		return false, nil
+	}
+	r.notified[jobID] = true
+	r.deliveries = append(r.deliveries, deliveries...)
+	return true, nil
+}
+
+func (r *memoryWebhookRepo) GetUnnotifiedJobIDs(ctx context.Context, finishedAfter, finishedBefore time.Time, limit int) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	for _, id := range r.unnotified {
+		if !r.notified[id] {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func newTestWebhookService(jobs []*domain.Job, webhookRepo *memoryWebhookRepo, config WebhookConfig) *webhookService {
+	jobRepo := &finishedJobRepo{jobs: make(map[uuid.UUID]*domain.Job)}
+	for _, job := range jobs {
+		jobRepo.jobs[job.ID] = job
+	}
+	if webhookRepo.notified == nil {
+		webhookRepo.notified = make(map[uuid.UUID]bool)
+	}
+	queue := NewJobQueue(jobRepo, nil, QueueConfig{})
+	return NewWebhookService(jobRepo, webhookRepo, queue, config).(*webhookService)
+}
+
+func TestValidateCallbackURL(t *testing.T) {
+	s := newTestWebhookService(nil, &memoryWebhookRepo{}, WebhookConfig{
+		Secret:       "secret",
+		AllowedHosts: []string{"10.1.2.3"},
+	})
+
+	tests := []struct {
+		url  string
+		want error
+	}{
+		{"https://93.184.216.34/hooks", nil},
+		{"http://10.1.2.3:8080/hooks", nil},
+		{"ftp://93.184.216.34/hooks", ErrInvalidCallbackURL},
+		{"/hooks", ErrInvalidCallbackURL},
+		{"http://127.0.0.1/hooks", ErrInvalidCallbackURL},
+		{"http://localhost/hooks", ErrInvalidCallbackURL},
+		{"http://[::1]/hooks", ErrInvalidCallbackURL},
+		{"http://169.254.169.254/latest/meta-data", ErrInvalidCallbackURL},
+		{"http://10.0.0.1/hooks", ErrInvalidCallbackURL},
+		{"http://172.16.5.4/hooks", ErrInvalidCallbackURL},
+		{"http://192.168.1.1/hooks", ErrInvalidCallbackURL},
+		{"http://100.64.0.1/hooks", ErrInvalidCallbackURL},
+		{"http://0.0.0.0/hooks", ErrInvalidCallbackURL},
+		{"http://[::ffff:127.0.0.1]/hooks", ErrInvalidCallbackURL},
+		{"http://[fd00::1]/hooks", ErrInvalidCallbackURL},
+	}
+	for _, tt := range tests {
+		err := s.ValidateCallbackURL(context.Background(), tt.url)
+		if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+			t.Errorf("ValidateCallbackURL(%q) = %v, want %v", tt.url, err, tt.want)
+		}
+	}
+}
+
+func TestWebhooksWithoutSecretAreDisabled(t *testing.T) {
+	s := newTestWebhookService(nil, &memoryWebhookRepo{}, WebhookConfig{})
+
+	if err := s.ValidateCallbackURL(context.Background(), "https://93.184.216.34/hooks"); !errors.Is(err, ErrWebhooksDisabled) {
+		t.Errorf("got %v for a callback URL, want ErrWebhooksDisabled", err)
+	}
+	if _, err := s.CreateSubscription(context.Background(), &dto.WebhookSubscriptionRequest{URL: "https://93.184.216.34/hooks"}); !errors.Is(err, ErrWebhooksDisabled) {
+		t.Errorf("got %v for a subscription, want ErrWebhooksDisabled", err)
+	}
+}
+
+func TestNotifyQueuesDeliveriesOfAJobOnce(t *testing.T) {
+	job := &domain.Job{ID: uuid.New(), Type: "external_api_sync", Status: domain.JobStatusCompleted, CallbackURL: "https://93.184.216.34/hooks"}
+	webhookRepo := &memoryWebhookRepo{
+		subscriptions: []*domain.WebhookSubscription{{ID: 7, URL: "https://93.184.216.35/hooks"}},
+		unnotified:    []uuid.UUID{job.ID},
+	}
+	s := newTestWebhookService([]*domain.Job{job}, webhookRepo, WebhookConfig{Secret: "secret"})
+
+	// The hook and the reconciler both get to the job
+	s.jobFinished(context.Background(), job.ID)
+	s.reconcile(context.Background())
+
+	if len(webhookRepo.deliveries) != 2 {
+		t.Fatalf("queued %d deliveries, want one per target", len(webhookRepo.deliveries))
+	}
+	if webhookRepo.deliveries[0].SubscriptionID != nil || *webhookRepo.deliveries[1].SubscriptionID != 7 {
+		t.Errorf("queued deliveries for the wrong targets: %+v", webhookRepo.deliveries)
+	}
+}
+
+func TestReconcileQueuesDeliveriesOfJobsTheHookMissed(t *testing.T) {
+	missed := &domain.Job{ID: uuid.New(), Status: domain.JobStatusFailed, CallbackURL: "https://93.184.216.34/hooks"}
+	webhookRepo := &memoryWebhookRepo{unnotified: []uuid.UUID{missed.ID}}
+	s := newTestWebhookService([]*domain.Job{missed}, webhookRepo, WebhookConfig{Secret: "secret"})
+
+	s.reconcile(context.Background())
+
+	if len(webhookRepo.deliveries) != 1 || webhookRepo.deliveries[0].Event != "job.failed" {
+		t.Fatalf("reconciler queued %+v, want the job.failed delivery", webhookRepo.deliveries)
+	}
+}
+
+func TestSendOnlyDialsAllowedAddresses(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get(webhookSignatureHeader) == "" {
+			t.Error("delivery was not signed")
+		}
+	}))
+	defer server.Close()
+	host := server.Listener.Addr().String()
+	delivery := &domain.WebhookDelivery{ID: 1, URL: (&url.URL{Scheme: "http", Host: host}).String(), Payload: "{}"}
+
+	// The loopback test server stands in for an internal host a validated
+	// name was rebound to
+	blocked := newTestWebhookService(nil, &memoryWebhookRepo{}, WebhookConfig{Secret: "secret"})
+	if _, err := blocked.send(context.Background(), delivery); !errors.Is(err, ErrInvalidCallbackURL) {
+		t.Errorf("delivery to a loopback address returned %v, want ErrInvalidCallbackURL", err)
+	}
+
+	allowed := newTestWebhookService(nil, &memoryWebhookRepo{}, WebhookConfig{Secret: "secret", AllowedHosts: []string{"127.0.0.1"}})
+	if status, err := allowed.send(context.Background(), delivery); err != nil || status != http.StatusOK {
+		t.Errorf("delivery to an allowed host returned %d, %v", status, err)
+	}
+	if requests != 1 {
+		t.Errorf("server received %d requests, want 1", requests)
+	}
+}
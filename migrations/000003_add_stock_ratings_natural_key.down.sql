@@ -0,0 +1 @@
+DROP INDEX IF EXISTS uq_stock_ratings_natural_key;
\ No newline at end of file
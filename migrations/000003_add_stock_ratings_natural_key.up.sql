@@ -0,0 +1,44 @@
+-- Key columns must be NOT NULL so the unique index treats blank values as
+-- equal. Ratings stored without a time take the time they were stored at.
+UPDATE stock_ratings SET
+    target_from = COALESCE(target_from, ''),
+    target_to = COALESCE(target_to, ''),
+    action = COALESCE(action, ''),
+    brokerage = COALESCE(brokerage, ''),
+    rating_from = COALESCE(rating_from, ''),
+    rating_to = COALESCE(rating_to, ''),
+    time = COALESCE(time, created_at, CURRENT_TIMESTAMP)
+WHERE target_from IS NULL OR target_to IS NULL OR action IS NULL
+    OR brokerage IS NULL OR rating_from IS NULL OR rating_to IS NULL OR time IS NULL;
+
+ALTER TABLE stock_ratings
+    ALTER COLUMN target_from SET DEFAULT '',
+    ALTER COLUMN target_from SET NOT NULL,
+    ALTER COLUMN target_to SET DEFAULT '',
+    ALTER COLUMN target_to SET NOT NULL,
+    ALTER COLUMN action SET DEFAULT '',
+    ALTER COLUMN action SET NOT NULL,
+    ALTER COLUMN brokerage SET DEFAULT '',
+    ALTER COLUMN brokerage SET NOT NULL,
+    ALTER COLUMN rating_from SET DEFAULT '',
+    ALTER COLUMN rating_from SET NOT NULL,
+    ALTER COLUMN rating_to SET DEFAULT '',
+    ALTER COLUMN rating_to SET NOT NULL,
+    ALTER COLUMN time SET NOT NULL;
+
+-- Remove duplicates left behind by earlier syncs, keeping the oldest row
+DELETE FROM stock_ratings a
+USING stock_ratings b
+WHERE a.id > b.id
+    AND a.ticker = b.ticker
+    AND a.brokerage = b.brokerage
+    AND a.time = b.time
+    AND a.action = b.action
+    AND a.rating_from = b.rating_from
+    AND a.rating_to = b.rating_to
+    AND a.target_from = b.target_from
+    AND a.target_to = b.target_to;
+
+-- Natural key used by sync upserts
+CREATE UNIQUE INDEX IF NOT EXISTS uq_stock_ratings_natural_key
+    ON stock_ratings(ticker, brokerage, time, action, rating_from, rating_to, target_from, target_to);
@@ -0,0 +1 @@
+ALTER TABLE jobs DROP COLUMN IF EXISTS inserted_items, DROP COLUMN IF EXISTS updated_items, DROP COLUMN IF EXISTS unchanged_items;
\ No newline at end of file
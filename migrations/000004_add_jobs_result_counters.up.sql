@@ -0,0 +1,4 @@
+ALTER TABLE jobs
+    ADD COLUMN IF NOT EXISTS inserted_items INTEGER DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS updated_items INTEGER DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS unchanged_items INTEGER DEFAULT 0;
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS sync_states (
+    source VARCHAR(50) PRIMARY KEY,
+    high_water_mark TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
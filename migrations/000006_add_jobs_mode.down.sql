@@ -0,0 +1 @@
+ALTER TABLE jobs DROP COLUMN IF EXISTS mode;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE jobs DROP COLUMN IF EXISTS cursor, DROP COLUMN IF EXISTS since, DROP COLUMN IF EXISTS latest_item_time;
\ No newline at end of file
@@ -0,0 +1,4 @@
+ALTER TABLE jobs
+    ADD COLUMN IF NOT EXISTS cursor VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS since TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS latest_item_time TIMESTAMP WITH TIME ZONE;
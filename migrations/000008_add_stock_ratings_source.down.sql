@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_stock_ratings_source; ALTER TABLE stock_ratings DROP COLUMN IF EXISTS source, DROP COLUMN IF EXISTS source_job_id;
\ No newline at end of file
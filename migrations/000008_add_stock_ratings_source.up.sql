@@ -0,0 +1,9 @@
+-- Rows stored before provenance was tracked may come from the external API
+-- sync or the manual endpoints alike, so they are marked 'unknown'
+ALTER TABLE stock_ratings
+    ADD COLUMN IF NOT EXISTS source VARCHAR(50) NOT NULL DEFAULT 'unknown',
+    ADD COLUMN IF NOT EXISTS source_job_id UUID;
+
+ALTER TABLE stock_ratings ALTER COLUMN source SET DEFAULT 'manual';
+
+CREATE INDEX IF NOT EXISTS idx_stock_ratings_source ON stock_ratings(source);
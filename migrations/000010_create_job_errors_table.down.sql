@@ -0,0 +1 @@
+DROP TABLE IF EXISTS job_errors;
\ No newline at end of file
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS job_errors (
+    id BIGSERIAL PRIMARY KEY,
+    job_id UUID NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+    line INTEGER NOT NULL DEFAULT 0,
+    reason TEXT NOT NULL,
+    raw_payload TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_errors_job_id ON job_errors(job_id, id);
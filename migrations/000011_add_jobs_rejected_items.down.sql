@@ -0,0 +1 @@
+ALTER TABLE jobs DROP COLUMN IF EXISTS rejected_items;
\ No newline at end of file
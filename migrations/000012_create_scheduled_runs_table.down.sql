@@ -0,0 +1 @@
+DROP TABLE IF EXISTS scheduled_runs;
\ No newline at end of file
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS scheduled_runs (
+    id BIGSERIAL PRIMARY KEY,
+    schedule VARCHAR(100) NOT NULL,
+    source VARCHAR(50) NOT NULL,
+    scheduled_for TIMESTAMP WITH TIME ZONE NOT NULL,
+    job_id UUID REFERENCES jobs(id) ON DELETE SET NULL,
+    error_message TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One run per schedule slot, whichever replica gets there first
+CREATE UNIQUE INDEX IF NOT EXISTS uq_scheduled_runs_slot ON scheduled_runs(schedule, scheduled_for);
+CREATE INDEX IF NOT EXISTS idx_scheduled_runs_scheduled_for ON scheduled_runs(scheduled_for DESC);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_jobs_pending_queue, idx_jobs_processing_lease; ALTER TABLE jobs DROP COLUMN IF EXISTS attempts, DROP COLUMN IF EXISTS max_attempts, DROP COLUMN IF EXISTS run_after, DROP COLUMN IF EXISTS locked_by, DROP COLUMN IF EXISTS heartbeat_at, DROP COLUMN IF EXISTS lease_expires_at, DROP COLUMN IF EXISTS input_path;
\ No newline at end of file
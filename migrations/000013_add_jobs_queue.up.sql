@@ -0,0 +1,12 @@
+ALTER TABLE jobs
+    ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS max_attempts INTEGER NOT NULL DEFAULT 3,
+    ADD COLUMN IF NOT EXISTS run_after TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS locked_by VARCHAR(100),
+    ADD COLUMN IF NOT EXISTS heartbeat_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS lease_expires_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS input_path TEXT NOT NULL DEFAULT '';
+
+-- Workers claim pending jobs oldest first and reap expired leases
+CREATE INDEX IF NOT EXISTS idx_jobs_pending_queue ON jobs(created_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_jobs_processing_lease ON jobs(lease_expires_at) WHERE status = 'processing';
@@ -0,0 +1 @@
+DROP TRIGGER IF EXISTS jobs_notify_event ON jobs; DROP FUNCTION IF EXISTS notify_job_event();
\ No newline at end of file
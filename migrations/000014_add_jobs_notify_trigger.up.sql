@@ -0,0 +1,29 @@
+-- Publish status and progress changes of jobs so every replica can stream them
+CREATE OR REPLACE FUNCTION notify_job_event() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT'
+        OR NEW.status IS DISTINCT FROM OLD.status
+        OR NEW.progress IS DISTINCT FROM OLD.progress
+        OR NEW.total_items IS DISTINCT FROM OLD.total_items THEN
+        PERFORM pg_notify('job_events', json_build_object(
+            'job_id', NEW.id,
+            'status', NEW.status,
+            'progress', NEW.progress,
+            'total_items', NEW.total_items,
+            'inserted_items', NEW.inserted_items,
+            'updated_items', NEW.updated_items,
+            'unchanged_items', NEW.unchanged_items,
+            'rejected_items', NEW.rejected_items,
+            -- NOTIFY payloads are capped at 8000 bytes
+            'error_message', left(NEW.error_message, 1000),
+            'updated_at', NEW.updated_at
+        )::text);
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS jobs_notify_event ON jobs;
+CREATE TRIGGER jobs_notify_event
+    AFTER INSERT OR UPDATE ON jobs
+    FOR EACH ROW EXECUTE FUNCTION notify_job_event();
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS webhook_deliveries; DROP TABLE IF EXISTS webhook_subscriptions; DROP INDEX IF EXISTS idx_jobs_unnotified; ALTER TABLE jobs DROP COLUMN IF EXISTS callback_url, DROP COLUMN IF EXISTS notified_at;
\ No newline at end of file
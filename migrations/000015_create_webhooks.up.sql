@@ -0,0 +1,38 @@
+ALTER TABLE jobs
+    ADD COLUMN IF NOT EXISTS callback_url TEXT NOT NULL DEFAULT '',
+    -- Set once the webhooks of a finished job are queued
+    ADD COLUMN IF NOT EXISTS notified_at TIMESTAMP WITH TIME ZONE;
+
+-- Jobs that finished before webhooks existed are not notified
+UPDATE jobs SET notified_at = COALESCE(completed_at, updated_at) WHERE status IN ('completed', 'failed');
+
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id BIGSERIAL PRIMARY KEY,
+    url TEXT NOT NULL,
+    job_type VARCHAR(50) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    job_id UUID NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+    subscription_id BIGINT REFERENCES webhook_subscriptions(id) ON DELETE SET NULL,
+    url TEXT NOT NULL,
+    event VARCHAR(50) NOT NULL,
+    payload TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_status_code INTEGER,
+    last_error TEXT,
+    delivered_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Dispatchers pick due deliveries; the log is read per job
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_job_id ON webhook_deliveries(job_id, id);
+
+-- Finished jobs whose webhooks were never queued, picked up by the reconciler
+CREATE INDEX IF NOT EXISTS idx_jobs_unnotified ON jobs(updated_at) WHERE notified_at IS NULL AND status IN ('completed', 'failed');
@@ -0,0 +1 @@
+ALTER TABLE job_errors DROP COLUMN IF EXISTS page; ALTER TABLE jobs DROP COLUMN IF EXISTS skipped_items, DROP COLUMN IF EXISTS duplicate_items, DROP COLUMN IF EXISTS pages;
\ No newline at end of file
@@ -0,0 +1,7 @@
+ALTER TABLE jobs
+    ADD COLUMN IF NOT EXISTS skipped_items INTEGER DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS duplicate_items INTEGER DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS pages INTEGER DEFAULT 0;
+
+-- Page of the job the failed item arrived in (chunk of the upload for imports)
+ALTER TABLE job_errors ADD COLUMN IF NOT EXISTS page INTEGER NOT NULL DEFAULT 0;
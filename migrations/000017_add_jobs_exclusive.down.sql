@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_jobs_active_exclusive; ALTER TABLE jobs DROP COLUMN IF EXISTS exclusive;
\ No newline at end of file
@@ -0,0 +1,4 @@
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS exclusive BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- At most one unfinished exclusive job per type, enforced across replicas
+CREATE UNIQUE INDEX IF NOT EXISTS idx_jobs_active_exclusive ON jobs(type) WHERE exclusive AND status IN ('pending', 'processing');
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_jobs_parent_job_id; ALTER TABLE jobs DROP COLUMN IF EXISTS parent_job_id, DROP COLUMN IF EXISTS child_job_id, DROP COLUMN IF EXISTS chain_attempt;
\ No newline at end of file
@@ -0,0 +1,7 @@
+ALTER TABLE jobs
+    ADD COLUMN IF NOT EXISTS parent_job_id UUID REFERENCES jobs(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS child_job_id UUID REFERENCES jobs(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS chain_attempt INTEGER NOT NULL DEFAULT 1;
+
+-- A job is retried at most once; later retries extend the chain from its child
+CREATE UNIQUE INDEX IF NOT EXISTS idx_jobs_parent_job_id ON jobs(parent_job_id) WHERE parent_job_id IS NOT NULL;
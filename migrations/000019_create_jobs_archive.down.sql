@@ -0,0 +1 @@
+DROP TABLE IF EXISTS jobs_archive;
\ No newline at end of file
@@ -0,0 +1,13 @@
+-- Finished jobs removed by the retention janitor when archiving is enabled.
+-- The whole row is kept as JSON so the archive survives changes to jobs.
+CREATE TABLE IF NOT EXISTS jobs_archive (
+    id UUID PRIMARY KEY,
+    type VARCHAR(50) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    data JSONB NOT NULL,
+    archived_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_archive_type_status ON jobs_archive(type, status);
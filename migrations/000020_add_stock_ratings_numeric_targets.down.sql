@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_stock_ratings_target_to_value; ALTER TABLE stock_ratings DROP COLUMN IF EXISTS target_from_value, DROP COLUMN IF EXISTS target_to_value, DROP COLUMN IF EXISTS target_currency, DROP COLUMN IF EXISTS target_currency_mixed;
\ No newline at end of file
@@ -0,0 +1,12 @@
+ALTER TABLE stock_ratings
+    ADD COLUMN IF NOT EXISTS target_from_value NUMERIC(14,4),
+    ADD COLUMN IF NOT EXISTS target_to_value NUMERIC(14,4),
+    ADD COLUMN IF NOT EXISTS target_currency VARCHAR(3) NOT NULL DEFAULT '',
+    -- Set on ratings whose targets are prices in different currencies, which
+    -- are left without values
+    ADD COLUMN IF NOT EXISTS target_currency_mixed BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Existing rows are parsed at startup by the same Go code that parses new
+-- rows at ingest (StockRatingRepository.ReparseTargets)
+
+CREATE INDEX IF NOT EXISTS idx_stock_ratings_target_to_value ON stock_ratings(target_to_value);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_stock_ratings_rating_to_normalized; ALTER TABLE stock_ratings DROP COLUMN IF EXISTS rating_from_normalized, DROP COLUMN IF EXISTS rating_from_score, DROP COLUMN IF EXISTS rating_to_normalized, DROP COLUMN IF EXISTS rating_to_score;
\ No newline at end of file
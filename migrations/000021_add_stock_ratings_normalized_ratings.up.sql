@@ -0,0 +1,9 @@
+-- Ratings mapped to the canonical five-level scale. The mapping is
+-- configurable, so the service fills these in at startup rather than here.
+ALTER TABLE stock_ratings
+    ADD COLUMN IF NOT EXISTS rating_from_normalized VARCHAR(20) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS rating_from_score SMALLINT,
+    ADD COLUMN IF NOT EXISTS rating_to_normalized VARCHAR(20) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS rating_to_score SMALLINT;
+
+CREATE INDEX IF NOT EXISTS idx_stock_ratings_rating_to_normalized ON stock_ratings(rating_to_normalized);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_stock_ratings_action_type; ALTER TABLE stock_ratings DROP COLUMN IF EXISTS action_type;
\ No newline at end of file
@@ -0,0 +1,6 @@
+ALTER TABLE stock_ratings ADD COLUMN IF NOT EXISTS action_type VARCHAR(20) NOT NULL DEFAULT '';
+
+-- Existing rows are classified at startup by the same Go rules that classify
+-- new rows at ingest (StockRatingRepository.ReclassifyActions)
+
+CREATE INDEX IF NOT EXISTS idx_stock_ratings_action_type ON stock_ratings(action_type);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_stock_ratings_brokerage_id_time; ALTER TABLE stock_ratings DROP COLUMN IF EXISTS brokerage_id; DROP TABLE IF EXISTS brokerage_aliases; DROP TABLE IF EXISTS brokerages;
\ No newline at end of file
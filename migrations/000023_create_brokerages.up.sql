@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS brokerages (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Every spelling of a brokerage, keyed by domain.BrokerageKey
+CREATE TABLE IF NOT EXISTS brokerage_aliases (
+    alias_key VARCHAR(255) PRIMARY KEY,
+    alias VARCHAR(255) NOT NULL,
+    brokerage_id BIGINT NOT NULL REFERENCES brokerages(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_brokerage_aliases_brokerage_id ON brokerage_aliases(brokerage_id);
+
+-- Linked at ingest; existing ratings are linked by the service at startup,
+-- since keys are computed in Go
+ALTER TABLE stock_ratings ADD COLUMN IF NOT EXISTS brokerage_id BIGINT REFERENCES brokerages(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_stock_ratings_brokerage_id_time ON stock_ratings(brokerage_id, time DESC);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS company_names; DROP TABLE IF EXISTS companies;
\ No newline at end of file
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS companies (
+    ticker VARCHAR(10) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    exchange VARCHAR(20) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Every name a ticker was rated under
+CREATE TABLE IF NOT EXISTS company_names (
+    id BIGSERIAL PRIMARY KEY,
+    ticker VARCHAR(10) NOT NULL REFERENCES companies(ticker) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    first_seen_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_seen_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    UNIQUE (ticker, name)
+);
+
+-- Companies are filled in from the stored ratings by the service at startup,
+-- once their tickers are normalized with the configured aliases
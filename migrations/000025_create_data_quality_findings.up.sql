@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS data_quality_findings (
+    job_id UUID NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+    rule VARCHAR(50) NOT NULL,
+    count BIGINT NOT NULL DEFAULT 0,
+    -- IDs of the most recent offending ratings
+    sample_ids JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (job_id, rule)
+);
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS idx_stock_ratings_time ON stock_ratings(time); DROP INDEX IF EXISTS idx_stock_ratings_time_id;
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- Keyset pagination seeks on (time, id); the index supersedes the one on time
+CREATE INDEX IF NOT EXISTS idx_stock_ratings_time_id ON stock_ratings(time, id);
+DROP INDEX IF EXISTS idx_stock_ratings_time;
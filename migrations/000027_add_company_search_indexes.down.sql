@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_company_names_name_trgm; DROP INDEX IF EXISTS idx_companies_name_trgm; DROP INDEX IF EXISTS idx_companies_ticker_trgm;
\ No newline at end of file
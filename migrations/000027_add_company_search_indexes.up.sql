@@ -0,0 +1,18 @@
+-- Trigram indexes serve both the prefix and the fuzzy matches of the company
+-- search, on current and former names alike.
+--
+-- Creating pg_trgm takes a superuser, or from PostgreSQL 13 the database owner
+-- or a role with CREATE on the database. When the migration role has neither,
+-- enable the extension beforehand and this migration skips it.
+DO $$
+BEGIN
+    CREATE EXTENSION IF NOT EXISTS pg_trgm;
+EXCEPTION WHEN insufficient_privilege THEN
+    RAISE EXCEPTION 'the company search needs the pg_trgm extension, which the migration role may not create'
+        USING HINT = 'Run CREATE EXTENSION pg_trgm as a superuser or the database owner, then run the migrations again.';
+END
+$$;
+
+CREATE INDEX IF NOT EXISTS idx_companies_ticker_trgm ON companies USING GIN (ticker gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_companies_name_trgm ON companies USING GIN (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_company_names_name_trgm ON company_names USING GIN (name gin_trgm_ops);